@@ -44,6 +44,16 @@ func (svr *Service) RunAdminServer(addr string, port int) (err error) {
 	router.HandleFunc("/api/status", svr.apiStatus).Methods("GET")
 	router.HandleFunc("/api/config", svr.apiGetConfig).Methods("GET")
 	router.HandleFunc("/api/config", svr.apiPutConfig).Methods("PUT")
+	router.HandleFunc("/api/proxies/{name}", svr.apiGetProxy).Methods("GET")
+	router.HandleFunc("/api/proxies/{name}", svr.apiPutProxy).Methods("POST", "PUT")
+	router.HandleFunc("/api/proxies/{name}", svr.apiDeleteProxy).Methods("DELETE")
+	router.HandleFunc("/api/visitors/{name}", svr.apiGetVisitor).Methods("GET")
+	router.HandleFunc("/api/visitors/{name}", svr.apiPutVisitor).Methods("POST", "PUT")
+	router.HandleFunc("/api/visitors/{name}", svr.apiDeleteVisitor).Methods("DELETE")
+	router.HandleFunc("/api/sites", svr.apiGetSites).Methods("GET")
+	router.HandleFunc("/api/sites", svr.apiUpdateSite).Methods("POST")
+	router.HandleFunc("/api/sites/{mac}", svr.apiGetSite).Methods("GET")
+	router.HandleFunc("/api/sites/{mac}", svr.apiUpdateSite).Methods("PUT", "DELETE")
 
 	// view
 	router.Handle("/favicon.ico", http.FileServer(assets.FileSystem)).Methods("GET")
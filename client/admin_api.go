@@ -19,13 +19,21 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 
 	"github.com/whysmx/frp/client/proxy"
 	"github.com/whysmx/frp/g"
 	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/consts"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
+
+	"github.com/gorilla/mux"
+	ini "github.com/vaughan0/go-ini"
 )
 
 type GeneralResponse struct {
@@ -38,9 +46,15 @@ type GeneralResponse struct {
 func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 	res := GeneralResponse{Code: 200}
 
+	auditFields := audit.Fields{"remote_addr": r.RemoteAddr}
 	log.Info("Http request [/api/reload]")
 	defer func() {
 		log.Info("Http response [/api/reload], code [%d]", res.Code)
+		auditFields["code"] = res.Code
+		if res.Code != 200 {
+			auditFields["error"] = res.Msg
+		}
+		audit.Record(audit.EventReload, auditFields)
 		w.WriteHeader(res.Code)
 		if len(res.Msg) > 0 {
 			w.Write([]byte(res.Msg))
@@ -71,6 +85,18 @@ func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	visitorPorts, err := svr.visitorPorts.Assign(visitorCfgs)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		log.Warn("reload frpc visitor config error: %s", res.Msg)
+		return
+	}
+
+	svr.cfgMu.RLock()
+	auditFields["diff"] = diffConfs(svr.pxyCfgs, svr.visitorCfgs, pxyCfgs, visitorCfgs)
+	svr.cfgMu.RUnlock()
+
 	err = svr.ReloadConf(pxyCfgs, visitorCfgs)
 	if err != nil {
 		res.Code = 500
@@ -78,6 +104,12 @@ func (svr *Service) apiReload(w http.ResponseWriter, r *http.Request) {
 		log.Warn("reload frpc proxy config error: %s", res.Msg)
 		return
 	}
+	if err = svr.visitorPorts.Commit(visitorPorts); err != nil {
+		res.Code = 500
+		res.Msg = err.Error()
+		log.Warn("reload frpc visitor config error: %s", res.Msg)
+		return
+	}
 	log.Info("success reload conf")
 	return
 }
@@ -89,6 +121,8 @@ type StatusResp struct {
 	Https []ProxyStatusResp `json:"https"`
 	Stcp  []ProxyStatusResp `json:"stcp"`
 	Xtcp  []ProxyStatusResp `json:"xtcp"`
+
+	Visitors []VisitorStatusResp `json:"visitors"`
 }
 
 type ProxyStatusResp struct {
@@ -101,6 +135,23 @@ type ProxyStatusResp struct {
 	RemoteAddr string `json:"remote_addr"`
 }
 
+type VisitorStatusResp struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	ServerName    string `json:"server_name"`
+	BindAddr      string `json:"bind_addr"`
+	BindPort      int    `json:"bind_port"`
+	BindPortAuto  bool   `json:"bind_port_auto"`
+	Status        string `json:"status"`
+	Err           string `json:"err"`
+	CurConns      int64  `json:"cur_conns"`
+	TotalConns    int64  `json:"total_conns"`
+	TrafficIn     int64  `json:"traffic_in"`
+	TrafficOut    int64  `json:"traffic_out"`
+	LastConnErr   string `json:"last_conn_err"`
+	SkFingerprint string `json:"sk_fingerprint"`
+}
+
 type ByProxyStatusResp []ProxyStatusResp
 
 func (a ByProxyStatusResp) Len() int           { return len(a) }
@@ -160,6 +211,26 @@ func NewProxyStatusResp(status *proxy.ProxyStatus) ProxyStatusResp {
 	return psr
 }
 
+func NewVisitorStatusResp(status *VisitorStatus) VisitorStatusResp {
+	base := status.Cfg.GetBaseInfo()
+	return VisitorStatusResp{
+		Name:          status.Name,
+		Type:          status.Type,
+		ServerName:    base.ServerName,
+		BindAddr:      base.BindAddr,
+		BindPort:      base.BindPort,
+		BindPortAuto:  base.BindPortAuto,
+		Status:        status.Status,
+		Err:           status.Err,
+		CurConns:      status.CurConns,
+		TotalConns:    status.TotalConns,
+		TrafficIn:     status.TrafficIn,
+		TrafficOut:    status.TrafficOut,
+		LastConnErr:   status.LastConnErr,
+		SkFingerprint: status.SkFingerprint,
+	}
+}
+
 // GET api/status
 func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -172,6 +243,7 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	res.Https = make([]ProxyStatusResp, 0)
 	res.Stcp = make([]ProxyStatusResp, 0)
 	res.Xtcp = make([]ProxyStatusResp, 0)
+	res.Visitors = make([]VisitorStatusResp, 0)
 
 	log.Info("Http request [/api/status]")
 	defer func() {
@@ -180,7 +252,12 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 		w.Write(buf)
 	}()
 
-	ps := svr.ctl.pm.GetAllProxyStatus()
+	ctl := svr.GetController()
+	if ctl == nil {
+		return
+	}
+
+	ps := ctl.pm.GetAllProxyStatus()
 	for _, status := range ps {
 		switch status.Type {
 		case "tcp":
@@ -203,6 +280,11 @@ func (svr *Service) apiStatus(w http.ResponseWriter, r *http.Request) {
 	sort.Sort(ByProxyStatusResp(res.Https))
 	sort.Sort(ByProxyStatusResp(res.Stcp))
 	sort.Sort(ByProxyStatusResp(res.Xtcp))
+
+	for _, status := range ctl.vm.GetAllVisitorStatus() {
+		res.Visitors = append(res.Visitors, NewVisitorStatusResp(status))
+	}
+	sort.Slice(res.Visitors, func(i, j int) bool { return res.Visitors[i].Name < res.Visitors[j].Name })
 	return
 }
 
@@ -250,15 +332,24 @@ func (svr *Service) apiGetConfig(w http.ResponseWriter, r *http.Request) {
 func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
 	res := GeneralResponse{Code: 200}
 
+	auditFields := audit.Fields{"remote_addr": r.RemoteAddr}
 	log.Info("Http put request [/api/config]")
 	defer func() {
 		log.Info("Http put response [/api/config], code [%d]", res.Code)
+		auditFields["code"] = res.Code
+		if res.Code != 200 {
+			auditFields["error"] = res.Msg
+		}
+		audit.Record(audit.EventConfigUpdate, auditFields)
 		w.WriteHeader(res.Code)
 		if len(res.Msg) > 0 {
 			w.Write([]byte(res.Msg))
 		}
 	}()
 
+	svr.cfgFileMu.Lock()
+	defer svr.cfgFileMu.Unlock()
+
 	// get new config content
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -314,9 +405,10 @@ func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
 	} else {
 		newRows = tmpRows
 	}
+	auditFields["diff"] = diffIniSections(content, strings.Join(newRows, "\n"))
 	content = strings.Join(newRows, "\n")
 
-	err = ioutil.WriteFile(g.GlbClientCfg.CfgFile, []byte(content), 0644)
+	err = writeConfFile(g.GlbClientCfg.CfgFile, content)
 	if err != nil {
 		res.Code = 500
 		res.Msg = fmt.Sprintf("write content to frpc config file error: %v", err)
@@ -324,3 +416,398 @@ func (svr *Service) apiPutConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// writeConfFile writes content to a temporary file in the same directory and
+// renames it to file, so frpc never reads a config file written halfway.
+func writeConfFile(file string, content string) (err error) {
+	// keep the symlink if config file is linked to another one
+	if realFile, errRet := filepath.EvalSymlinks(file); errRet == nil {
+		file = realFile
+	}
+	mode := os.FileMode(0644)
+	if info, errRet := os.Stat(file); errRet == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.WriteString(content); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Chmod(mode); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// confDiff is the summary of changes written to audit log.
+type confDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func newConfDiff() *confDiff {
+	return &confDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]string, 0),
+	}
+}
+
+// diffIniSections returns names of sections changed between two ini contents.
+func diffIniSections(oldContent string, newContent string) *confDiff {
+	diff := newConfDiff()
+	oldConf, err := ini.Load(strings.NewReader(oldContent))
+	if err != nil {
+		oldConf = make(ini.File)
+	}
+	newConf, err := ini.Load(strings.NewReader(newContent))
+	if err != nil {
+		newConf = make(ini.File)
+	}
+
+	for name, section := range newConf {
+		if oldSection, ok := oldConf[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !reflect.DeepEqual(section, oldSection) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range oldConf {
+		if _, ok := newConf[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// diffConfs returns names of proxies and visitors changed by reloading.
+func diffConfs(oldPxyCfgs map[string]config.ProxyConf, oldVisitorCfgs map[string]config.VisitorConf,
+	newPxyCfgs map[string]config.ProxyConf, newVisitorCfgs map[string]config.VisitorConf) *confDiff {
+
+	diff := newConfDiff()
+	for name, cfg := range newPxyCfgs {
+		if oldCfg, ok := oldPxyCfgs[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !cfg.Compare(oldCfg) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range oldPxyCfgs {
+		if _, ok := newPxyCfgs[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for name, cfg := range newVisitorCfgs {
+		if oldCfg, ok := oldVisitorCfgs[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !cfg.Compare(oldCfg) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range oldVisitorCfgs {
+		if _, ok := newVisitorCfgs[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+const (
+	confKindProxy   = "proxy"
+	confKindVisitor = "visitor"
+)
+
+func getConfPrefix() string {
+	if g.GlbClientCfg.User != "" {
+		return g.GlbClientCfg.User + "."
+	}
+	return ""
+}
+
+// GET api/proxies/{name}
+func (svr *Service) apiGetProxy(w http.ResponseWriter, r *http.Request) {
+	svr.handleGetConf(w, r, confKindProxy)
+}
+
+// POST api/proxies/{name} to create a proxy, PUT to update it
+func (svr *Service) apiPutProxy(w http.ResponseWriter, r *http.Request) {
+	svr.handleUpdateConf(w, r, confKindProxy)
+}
+
+// DELETE api/proxies/{name}
+func (svr *Service) apiDeleteProxy(w http.ResponseWriter, r *http.Request) {
+	svr.handleUpdateConf(w, r, confKindProxy)
+}
+
+// GET api/visitors/{name}
+func (svr *Service) apiGetVisitor(w http.ResponseWriter, r *http.Request) {
+	svr.handleGetConf(w, r, confKindVisitor)
+}
+
+// POST api/visitors/{name} to create a visitor, PUT to update it
+func (svr *Service) apiPutVisitor(w http.ResponseWriter, r *http.Request) {
+	svr.handleUpdateConf(w, r, confKindVisitor)
+}
+
+// DELETE api/visitors/{name}
+func (svr *Service) apiDeleteVisitor(w http.ResponseWriter, r *http.Request) {
+	svr.handleUpdateConf(w, r, confKindVisitor)
+}
+
+func (svr *Service) handleGetConf(w http.ResponseWriter, r *http.Request, kind string) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+
+	log.Info("Http get request [%s]", r.URL.Path)
+	defer func() {
+		log.Info("Http get response [%s], code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	var (
+		cfg interface{}
+		ok  bool
+	)
+	svr.cfgMu.RLock()
+	if kind == confKindProxy {
+		cfg, ok = svr.pxyCfgs[getConfPrefix()+name]
+	} else {
+		cfg, ok = svr.visitorCfgs[getConfPrefix()+name]
+	}
+	svr.cfgMu.RUnlock()
+	if !ok {
+		res.Code = 404
+		res.Msg = fmt.Sprintf("%s [%s] not found", kind, name)
+		return
+	}
+	buf, _ := json.Marshal(cfg)
+	res.Msg = string(buf)
+}
+
+// handleUpdateConf creates, updates or deletes section [name] in config file
+// by the request method.
+func (svr *Service) handleUpdateConf(w http.ResponseWriter, r *http.Request, kind string) {
+	res := GeneralResponse{Code: 200}
+	name := mux.Vars(r)["name"]
+	method := strings.ToLower(r.Method)
+
+	auditFields := audit.Fields{"remote_addr": r.RemoteAddr}
+	log.Info("Http %s request [%s]", method, r.URL.Path)
+	defer func() {
+		log.Info("Http %s response [%s], code [%d]", method, r.URL.Path, res.Code)
+		auditFields["code"] = res.Code
+		if res.Code != 200 {
+			auditFields["error"] = res.Msg
+		}
+		audit.Record(audit.EventConfigUpdate, auditFields)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	if name == "common" || strings.HasPrefix(name, "range:") || strings.ContainsAny(name, "[]=") {
+		res.Code = 400
+		res.Msg = fmt.Sprintf("invalid %s name [%s]", kind, name)
+		log.Warn("%s", res.Msg)
+		return
+	}
+
+	// section is nil for deleting
+	var (
+		section ini.Section
+		cfg     interface{}
+	)
+	if r.Method != "DELETE" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			res.Code = 400
+			res.Msg = fmt.Sprintf("read request body error: %v", err)
+			log.Warn("%s", res.Msg)
+			return
+		}
+		if section, cfg, err = parseConfSection(kind, name, body); err != nil {
+			res.Code = 400
+			res.Msg = err.Error()
+			log.Warn("%s", res.Msg)
+			return
+		}
+	}
+
+	diff, code, err := svr.updateConfSection(kind, name, section, r.Method == "POST")
+	if err != nil {
+		res.Code = code
+		res.Msg = err.Error()
+		log.Warn("%s", res.Msg)
+		return
+	}
+	auditFields["diff"] = diff
+	if cfg != nil {
+		buf, _ := json.Marshal(cfg)
+		res.Msg = string(buf)
+	}
+}
+
+// parseConfSection converts a proxy or visitor conf in json to an ini section
+// and checks it.
+func parseConfSection(kind string, name string, body []byte) (section ini.Section, cfg interface{}, err error) {
+	prefix := getConfPrefix()
+	section = make(ini.Section)
+	if kind == confKindProxy {
+		base := &config.BaseProxyConf{}
+		if err = json.Unmarshal(body, base); err != nil {
+			return nil, nil, fmt.Errorf("parse proxy conf error: %v", err)
+		}
+		if base.ProxyType == "" {
+			base.ProxyType = consts.TcpProxy
+		}
+		pxyCfg := config.NewConfByType(base.ProxyType)
+		if pxyCfg == nil {
+			return nil, nil, fmt.Errorf("proxy [%s] type [%s] error", name, base.ProxyType)
+		}
+		if err = json.Unmarshal(body, pxyCfg); err != nil {
+			return nil, nil, fmt.Errorf("parse proxy conf error: %v", err)
+		}
+		pxyCfg.GetBaseInfo().ProxyType = base.ProxyType
+		pxyCfg.MarshalToIni(prefix, section)
+		// load it from the section as frpc does, CheckForCli is called
+		cfg, err = config.NewProxyConfFromIni(prefix, name, section)
+	} else {
+		base := &config.BaseVisitorConf{}
+		if err = json.Unmarshal(body, base); err != nil {
+			return nil, nil, fmt.Errorf("parse visitor conf error: %v", err)
+		}
+		visitorCfg := config.NewVisitorConfByType(base.ProxyType)
+		if visitorCfg == nil {
+			return nil, nil, fmt.Errorf("visitor [%s] type [%s] error", name, base.ProxyType)
+		}
+		if err = json.Unmarshal(body, visitorCfg); err != nil {
+			return nil, nil, fmt.Errorf("parse visitor conf error: %v", err)
+		}
+		visitorCfg.MarshalToIni(prefix, section)
+		cfg, err = config.NewVisitorConfFromIni(prefix, name, section)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// updateConfSection writes section [name] to config file, or removes it if
+// section is nil.
+func (svr *Service) updateConfSection(kind string, name string, section ini.Section, create bool) (diff *confDiff, code int, err error) {
+	return svr.editConfFile(func(content string) (string, int, error) {
+		conf, err := ini.Load(strings.NewReader(content))
+		if err != nil {
+			return "", 400, fmt.Errorf("parse frpc config file error: %v", err)
+		}
+
+		oldSection, exist := conf[name]
+		if exist {
+			oldKind := confKindProxy
+			if oldSection["role"] == "visitor" {
+				oldKind = confKindVisitor
+			}
+			if create {
+				return "", 400, fmt.Errorf("%s [%s] already exists", oldKind, name)
+			}
+			if oldKind != kind {
+				exist = false
+			}
+		}
+		if !create && !exist {
+			return "", 404, fmt.Errorf("%s [%s] not found in frpc config file", kind, name)
+		}
+
+		if section == nil {
+			content, _ = config.DeleteIniSection(content, name)
+		} else {
+			content = config.SetIniSection(content, name, section)
+		}
+		return content, 200, nil
+	})
+}
+
+// editConfFile changes content of config file by edit, then reloads all
+// proxies and visitors from the new content. Nothing is written if edit
+// returns an error or the new content is invalid, and the old content is
+// written back if reloading fails.
+func (svr *Service) editConfFile(edit func(content string) (string, int, error)) (diff *confDiff, code int, err error) {
+	if g.GlbClientCfg.CfgFile == "" {
+		return nil, 400, fmt.Errorf("frpc has no config file path")
+	}
+
+	svr.cfgFileMu.Lock()
+	defer svr.cfgFileMu.Unlock()
+
+	b, err := ioutil.ReadFile(g.GlbClientCfg.CfgFile)
+	if err != nil {
+		return nil, 400, fmt.Errorf("load frpc config file error: %v", err)
+	}
+	oldContent := string(b)
+	content, code, err := edit(oldContent)
+	if err != nil {
+		return nil, code, err
+	}
+
+	rendered, err := config.RenderContent(content)
+	if err != nil {
+		return nil, 400, err
+	}
+	newCommonCfg, err := config.UnmarshalClientConfFromIni(nil, rendered)
+	if err != nil {
+		return nil, 400, err
+	}
+	pxyCfgs, visitorCfgs, err := config.LoadAllConfFromIni(g.GlbClientCfg.User, rendered, newCommonCfg.Start)
+	if err != nil {
+		return nil, 400, err
+	}
+
+	visitorPorts, err := svr.visitorPorts.Assign(visitorCfgs)
+	if err != nil {
+		return nil, 400, err
+	}
+
+	if err = writeConfFile(g.GlbClientCfg.CfgFile, content); err != nil {
+		return nil, 500, fmt.Errorf("write content to frpc config file error: %v", err)
+	}
+
+	svr.cfgMu.RLock()
+	diff = diffConfs(svr.pxyCfgs, svr.visitorCfgs, pxyCfgs, visitorCfgs)
+	svr.cfgMu.RUnlock()
+
+	if err = svr.ReloadConf(pxyCfgs, visitorCfgs); err != nil {
+		// keep config file the same as the config applied
+		if errRet := writeConfFile(g.GlbClientCfg.CfgFile, oldContent); errRet != nil {
+			log.Warn("restore frpc config file error: %v", errRet)
+		}
+		return diff, 500, err
+	}
+	if err = svr.visitorPorts.Commit(visitorPorts); err != nil {
+		return diff, 500, err
+	}
+	return diff, 200, nil
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteConfFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frpc_conf")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "frpc.ini")
+	assert.NoError(ioutil.WriteFile(file, []byte("old"), 0600))
+	link := filepath.Join(dir, "link.ini")
+	assert.NoError(os.Symlink(file, link))
+
+	assert.NoError(writeConfFile(link, "new"))
+	buf, err := ioutil.ReadFile(file)
+	assert.NoError(err)
+	assert.Equal("new", string(buf))
+
+	// mode and symlink are kept, no temporary file is left
+	info, err := os.Stat(file)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Lstat(link)
+	assert.NoError(err)
+	assert.True(info.Mode()&os.ModeSymlink != 0)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 2)
+
+	// new file
+	assert.NoError(writeConfFile(filepath.Join(dir, "new.ini"), "content"))
+	info, err = os.Stat(filepath.Join(dir, "new.ini"))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0644), info.Mode().Perm())
+
+	assert.Error(writeConfFile(filepath.Join(dir, "not_exist", "frpc.ini"), "content"))
+}
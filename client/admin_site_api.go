@@ -0,0 +1,325 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/consts"
+	"github.com/whysmx/frp/utils/audit"
+	"github.com/whysmx/frp/utils/log"
+
+	"github.com/gorilla/mux"
+	ini "github.com/vaughan0/go-ini"
+)
+
+// Visitors generated for sites only listen on localhost by default like other
+// visitors, bind_addr must be set to expose devices of a site to other hosts.
+const defaultSiteBindAddr = "127.0.0.1"
+
+type SiteResp struct {
+	*config.SiteConf
+
+	// stcp visitors whose sk is the MAC of this site
+	Visitors []config.VisitorConf `json:"visitors"`
+}
+
+type GetSitesResp struct {
+	Sites []SiteResp `json:"sites"`
+}
+
+type SitePortReq struct {
+	Port int `json:"port"`
+
+	// 127.0.0.1 if empty
+	BindAddr string `json:"bind_addr"`
+	BindPort int    `json:"bind_port"`
+}
+
+// SiteReq replaces all fields of a site when updating.
+type SiteReq struct {
+	config.SiteConf
+
+	// Visitors R-{MAC}-{port} are generated from ports and other visitors of
+	// this site are removed. Visitors are not changed if ports is not set.
+	Ports []SitePortReq `json:"ports"`
+}
+
+func loadSites() (sites []*config.SiteConf, err error) {
+	if g.GlbClientCfg.CfgFile == "" {
+		return nil, fmt.Errorf("frpc has no config file path")
+	}
+	b, err := ioutil.ReadFile(g.GlbClientCfg.CfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("load frpc config file error: %v", err)
+	}
+	return config.LoadAllSiteConfFromIni(string(b))
+}
+
+func (svr *Service) newSiteResp(site *config.SiteConf) SiteResp {
+	res := SiteResp{
+		SiteConf: site,
+		Visitors: make([]config.VisitorConf, 0),
+	}
+	svr.cfgMu.RLock()
+	for _, cfg := range svr.visitorCfgs {
+		if cfg.GetBaseInfo().ProxyType == consts.StcpProxy && cfg.GetBaseInfo().Sk == site.Mac {
+			res.Visitors = append(res.Visitors, cfg)
+		}
+	}
+	svr.cfgMu.RUnlock()
+	sort.Slice(res.Visitors, func(i, j int) bool {
+		return res.Visitors[i].GetBaseInfo().ProxyName < res.Visitors[j].GetBaseInfo().ProxyName
+	})
+	return res
+}
+
+// GET api/sites, sites having any of tags are returned if tag is set, e.g. ?tag=a,b
+func (svr *Service) apiGetSites(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+
+	log.Info("Http get request [/api/sites]")
+	defer func() {
+		log.Info("Http get response [/api/sites], code [%d]", res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	tags := make([]string, 0)
+	for _, v := range r.URL.Query()["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	sites, err := loadSites()
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		log.Warn("%s", res.Msg)
+		return
+	}
+
+	resp := GetSitesResp{
+		Sites: make([]SiteResp, 0, len(sites)),
+	}
+	for _, site := range sites {
+		if len(tags) > 0 && !site.HasAnyTag(tags) {
+			continue
+		}
+		resp.Sites = append(resp.Sites, svr.newSiteResp(site))
+	}
+	buf, _ := json.Marshal(&resp)
+	res.Msg = string(buf)
+}
+
+// GET api/sites/{mac}
+func (svr *Service) apiGetSite(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	mac := mux.Vars(r)["mac"]
+
+	log.Info("Http get request [/api/sites/%s]", mac)
+	defer func() {
+		log.Info("Http get response [/api/sites/%s], code [%d]", mac, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	sites, err := loadSites()
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		log.Warn("%s", res.Msg)
+		return
+	}
+	for _, site := range sites {
+		if site.Mac == mac {
+			buf, _ := json.Marshal(svr.newSiteResp(site))
+			res.Msg = string(buf)
+			return
+		}
+	}
+	res.Code = 404
+	res.Msg = fmt.Sprintf("site [%s] not found", mac)
+}
+
+// POST api/sites to create a site, PUT api/sites/{mac} to update it and
+// DELETE api/sites/{mac} to delete it with its visitors.
+func (svr *Service) apiUpdateSite(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	mac := mux.Vars(r)["mac"]
+	method := strings.ToLower(r.Method)
+
+	auditFields := audit.Fields{"remote_addr": r.RemoteAddr}
+	log.Info("Http %s request [%s]", method, r.URL.Path)
+	defer func() {
+		log.Info("Http %s response [%s], code [%d]", method, r.URL.Path, res.Code)
+		auditFields["code"] = res.Code
+		if res.Code != 200 {
+			auditFields["error"] = res.Msg
+		}
+		audit.Record(audit.EventConfigUpdate, auditFields)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+
+	req := &SiteReq{}
+	if r.Method != "DELETE" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			res.Code = 400
+			res.Msg = fmt.Sprintf("read request body error: %v", err)
+			log.Warn("%s", res.Msg)
+			return
+		}
+		if err = json.Unmarshal(body, req); err != nil {
+			res.Code = 400
+			res.Msg = fmt.Sprintf("parse site error: %v", err)
+			log.Warn("%s", res.Msg)
+			return
+		}
+		// MAC is the key of visitors, it can't be changed
+		if r.Method == "PUT" {
+			if req.Mac != "" && req.Mac != mac {
+				res.Code = 400
+				res.Msg = fmt.Sprintf("mac of site [%s] can't be changed", mac)
+				log.Warn("%s", res.Msg)
+				return
+			}
+			req.Mac = mac
+		}
+		if err = req.Check(); err != nil {
+			res.Code = 400
+			res.Msg = err.Error()
+			log.Warn("%s", res.Msg)
+			return
+		}
+		mac = req.Mac
+	}
+
+	diff, code, err := svr.editConfFile(func(content string) (string, int, error) {
+		sites, err := config.LoadAllSiteConfFromIni(content)
+		if err != nil {
+			return "", 400, err
+		}
+		exist := false
+		for _, site := range sites {
+			if site.Mac == mac {
+				exist = true
+				break
+			}
+		}
+		if r.Method == "POST" && exist {
+			return "", 400, fmt.Errorf("site [%s] already exists", mac)
+		}
+		if r.Method != "POST" && !exist {
+			return "", 404, fmt.Errorf("site [%s] not found", mac)
+		}
+
+		if r.Method == "DELETE" {
+			content, _ = config.DeleteSiteFromIni(content, mac)
+			return setSiteVisitors(content, &config.SiteConf{Mac: mac}, []SitePortReq{})
+		}
+		if content, err = config.SetSiteInIni(content, &req.SiteConf); err != nil {
+			return "", 400, err
+		}
+		if req.Ports == nil {
+			return content, 200, nil
+		}
+		return setSiteVisitors(content, &req.SiteConf, req.Ports)
+	})
+	if err != nil {
+		res.Code = code
+		res.Msg = err.Error()
+		log.Warn("%s", res.Msg)
+		return
+	}
+	auditFields["diff"] = diff
+	if r.Method != "DELETE" {
+		buf, _ := json.Marshal(svr.newSiteResp(&req.SiteConf))
+		res.Msg = string(buf)
+	}
+}
+
+// setSiteVisitors makes visitors of site the ones generated from ports,
+// visitors of this site not generated are removed.
+func setSiteVisitors(content string, site *config.SiteConf, ports []SitePortReq) (string, int, error) {
+	prefix := getConfPrefix()
+	sections := make(map[string]ini.Section)
+	names := make([]string, 0, len(ports))
+	for _, p := range ports {
+		if p.Port <= 0 || p.Port > 65535 {
+			return "", 400, fmt.Errorf("site [%s] port [%d] is invalid", site.Mac, p.Port)
+		}
+		name := site.VisitorName(p.Port)
+		if _, ok := sections[name]; ok {
+			return "", 400, fmt.Errorf("site [%s] port [%d] is duplicated", site.Mac, p.Port)
+		}
+		if p.BindAddr == "" {
+			p.BindAddr = defaultSiteBindAddr
+		}
+
+		cfg := &config.StcpVisitorConf{
+			BaseVisitorConf: config.BaseVisitorConf{
+				ProxyType:  consts.StcpProxy,
+				Role:       "visitor",
+				Sk:         site.Mac,
+				ServerName: name,
+				BindAddr:   p.BindAddr,
+				BindPort:   p.BindPort,
+			},
+		}
+		section := make(ini.Section)
+		cfg.MarshalToIni(prefix, section)
+		if _, err := config.NewVisitorConfFromIni(prefix, name, section); err != nil {
+			return "", 400, fmt.Errorf("site [%s] port [%d] error: %v", site.Mac, p.Port, err)
+		}
+		sections[name] = section
+		names = append(names, name)
+	}
+
+	conf, err := ini.Load(strings.NewReader(content))
+	if err != nil {
+		return "", 400, fmt.Errorf("parse frpc config file error: %v", err)
+	}
+	for name, section := range conf {
+		isSiteVisitor := section["role"] == "visitor" && section["type"] == consts.StcpProxy && section["sk"] == site.Mac
+		if _, ok := sections[name]; ok && !isSiteVisitor {
+			return "", 400, fmt.Errorf("section [%s] already exists and it's not a visitor of site [%s]", name, site.Mac)
+		}
+		if _, ok := sections[name]; !ok && isSiteVisitor {
+			content, _ = config.DeleteIniSection(content, name)
+		}
+	}
+	for _, name := range names {
+		content = config.SetIniSection(content, name, sections[name])
+	}
+	return content, 200, nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/whysmx/frp/models/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSiteVisitorsBindAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	site := &config.SiteConf{Mac: "AABBCCDDEEFF"}
+	content, code, err := setSiteVisitors("[common]\nserver_addr = 127.0.0.1\n", site, []SitePortReq{
+		{Port: 22, BindPort: 6022},
+		{Port: 80, BindAddr: "0.0.0.0", BindPort: 6080},
+	})
+	if !assert.NoError(err) || !assert.Equal(200, code) {
+		return
+	}
+
+	_, visitorCfgs, err := config.LoadAllConfFromIni("", content, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	// only listen on localhost unless bind_addr is set
+	if assert.Contains(visitorCfgs, "R-AABBCCDDEEFF-22") {
+		assert.Equal("127.0.0.1", visitorCfgs["R-AABBCCDDEEFF-22"].GetBaseInfo().BindAddr)
+	}
+	if assert.Contains(visitorCfgs, "R-AABBCCDDEEFF-80") {
+		assert.Equal("0.0.0.0", visitorCfgs["R-AABBCCDDEEFF-80"].GetBaseInfo().BindAddr)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/whysmx/frp/models/msg"
 	"github.com/whysmx/frp/utils/log"
 	frpNet "github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
 
 	"github.com/fatedier/golib/control/shutdown"
 	"github.com/fatedier/golib/crypto"
@@ -51,6 +52,9 @@ type Control struct {
 	// tcp stream multiplexing, if enabled
 	session *fmux.Session
 
+	// TLS config used by new connections to server, nil if TLS is disabled
+	tlsConfig *tls.Config
+
 	// put a message in this channel to send it over control connection to server
 	sendCh chan (msg.Message)
 
@@ -62,6 +66,9 @@ type Control struct {
 
 	closedDoneCh chan struct{}
 
+	// closed when server is draining, a new control should login to another server
+	drainCh chan struct{}
+
 	// last time got the Pong message
 	lastPong time.Time
 
@@ -74,16 +81,21 @@ type Control struct {
 	log.Logger
 }
 
-func NewControl(runId string, conn frpNet.Conn, session *fmux.Session, pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]config.VisitorConf) *Control {
+func NewControl(runId string, conn frpNet.Conn, session *fmux.Session, tlsConfig *tls.Config,
+	pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]config.VisitorConf,
+	visitorStatuses *visitorStatusStore) *Control {
+
 	ctl := &Control{
 		runId:              runId,
 		conn:               conn,
 		session:            session,
+		tlsConfig:          tlsConfig,
 		pxyCfgs:            pxyCfgs,
 		sendCh:             make(chan msg.Message, 100),
 		readCh:             make(chan msg.Message, 100),
 		closedCh:           make(chan struct{}),
 		closedDoneCh:       make(chan struct{}),
+		drainCh:            make(chan struct{}),
 		readerShutdown:     shutdown.New(),
 		writerShutdown:     shutdown.New(),
 		msgHandlerShutdown: shutdown.New(),
@@ -91,7 +103,7 @@ func NewControl(runId string, conn frpNet.Conn, session *fmux.Session, pxyCfgs m
 	}
 	ctl.pm = proxy.NewProxyManager(ctl.sendCh, runId)
 
-	ctl.vm = NewVisitorManager(ctl)
+	ctl.vm = NewVisitorManager(ctl, visitorStatuses)
 	ctl.vm.Reload(visitorCfgs)
 	return ctl
 }
@@ -116,6 +128,11 @@ func (ctl *Control) HandleReqWorkConn(inMsg *msg.ReqWorkConn) {
 	m := &msg.NewWorkConn{
 		RunId: ctl.runId,
 	}
+	if g.GlbClientCfg.AuthenticateNewWorkConns {
+		m.Timestamp = time.Now().Unix()
+		m.PrivilegeKey = util.GetPrivilegeKey(g.GlbClientCfg.AuthScheme, g.GlbClientCfg.Token,
+			util.AuthPurposeNewWorkConn, ctl.runId, m.Timestamp)
+	}
 	if err = msg.WriteMsg(workConn, m); err != nil {
 		ctl.Warn("work connection write to server error: %v", err)
 		workConn.Close()
@@ -145,6 +162,17 @@ func (ctl *Control) HandleNewProxyResp(inMsg *msg.NewProxyResp) {
 	}
 }
 
+// HandleCloseProxy is called when the proxy is closed by server, it will be
+// registered again after a while.
+func (ctl *Control) HandleCloseProxy(inMsg *msg.CloseProxy) {
+	err := ctl.pm.CloseProxyByServer(inMsg.ProxyName)
+	if err != nil {
+		ctl.Warn("[%s] close by server error: %v", inMsg.ProxyName, err)
+	} else {
+		ctl.Warn("[%s] proxy closed by server", inMsg.ProxyName)
+	}
+}
+
 func (ctl *Control) Close() error {
 	ctl.pm.Close()
 	ctl.conn.Close()
@@ -154,6 +182,25 @@ func (ctl *Control) Close() error {
 	return nil
 }
 
+// HandleServerDrain closes all visitors so a new control can listen on their
+// ports. Work connections in use are kept until server closes this control.
+func (ctl *Control) HandleServerDrain(inMsg *msg.ServerDrain) {
+	select {
+	case <-ctl.drainCh:
+		return
+	default:
+	}
+	ctl.Info("server is draining, this connection will be closed before %s",
+		time.Unix(inMsg.Deadline, 0).Format("01-02 15:04:05"))
+	ctl.vm.Close()
+	close(ctl.drainCh)
+}
+
+// DrainCh returns a channel which will be closed when server is draining
+func (ctl *Control) DrainCh() <-chan struct{} {
+	return ctl.drainCh
+}
+
 // ClosedDoneCh returns a channel which will be closed after all resources are released
 func (ctl *Control) ClosedDoneCh() <-chan struct{} {
 	return ctl.closedDoneCh
@@ -170,14 +217,8 @@ func (ctl *Control) connectServer() (conn frpNet.Conn, err error) {
 		}
 		conn = frpNet.WrapConn(stream)
 	} else {
-		var tlsConfig *tls.Config
-		if g.GlbClientCfg.TLSEnable {
-			tlsConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
-		}
 		conn, err = frpNet.ConnectServerByProxyWithTLS(g.GlbClientCfg.HttpProxy, g.GlbClientCfg.Protocol,
-			fmt.Sprintf("%s:%d", g.GlbClientCfg.ServerAddr, g.GlbClientCfg.ServerPort), tlsConfig)
+			fmt.Sprintf("%s:%d", g.GlbClientCfg.ServerAddr, g.GlbClientCfg.ServerPort), ctl.tlsConfig)
 		if err != nil {
 			ctl.Warn("start new connection to server error: %v", err)
 			return
@@ -258,7 +299,13 @@ func (ctl *Control) msgHandler() {
 		case <-hbSend.C:
 			// send heartbeat to server
 			ctl.Debug("send heartbeat to server")
-			ctl.sendCh <- &msg.Ping{}
+			pingMsg := &msg.Ping{}
+			if g.GlbClientCfg.AuthenticateHeartBeats {
+				pingMsg.Timestamp = time.Now().Unix()
+				pingMsg.PrivilegeKey = util.GetPrivilegeKey(g.GlbClientCfg.AuthScheme, g.GlbClientCfg.Token,
+					util.AuthPurposePing, ctl.runId, pingMsg.Timestamp)
+			}
+			ctl.sendCh <- pingMsg
 		case <-hbCheck.C:
 			if time.Since(ctl.lastPong) > time.Duration(g.GlbClientCfg.HeartBeatTimeout)*time.Second {
 				ctl.Warn("heartbeat timeout")
@@ -276,7 +323,16 @@ func (ctl *Control) msgHandler() {
 				go ctl.HandleReqWorkConn(m)
 			case *msg.NewProxyResp:
 				ctl.HandleNewProxyResp(m)
+			case *msg.CloseProxy:
+				ctl.HandleCloseProxy(m)
+			case *msg.ServerDrain:
+				ctl.HandleServerDrain(m)
 			case *msg.Pong:
+				if m.Error != "" {
+					ctl.Error("pong contains error: %v", m.Error)
+					ctl.conn.Close()
+					return
+				}
 				ctl.lastPong = time.Now()
 				ctl.Debug("receive heartbeat from server")
 			}
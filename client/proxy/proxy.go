@@ -32,6 +32,7 @@ import (
 	"github.com/whysmx/frp/models/proto/udp"
 	"github.com/whysmx/frp/utils/log"
 	frpNet "github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
 
 	"github.com/fatedier/golib/errors"
 	frpIo "github.com/fatedier/golib/io"
@@ -354,7 +355,17 @@ func (pxy *XtcpProxy) InWorkConn(conn frpNet.Conn, m *msg.StartWorkConn) {
 	}
 
 	HandleTcpWorkConnection(&pxy.cfg.LocalSvrConf, pxy.proxyPlugin, &pxy.cfg.BaseProxyConf,
-		frpNet.WrapConn(muxConn), []byte(pxy.cfg.Sk), m)
+		frpNet.WrapConn(muxConn), []byte(pxy.getSk(natHoleSidMsg.SkFingerprint)), m)
+}
+
+// getSk returns the secret key used by the visitor, it's sk if not found.
+func (pxy *XtcpProxy) getSk(skFingerprint string) string {
+	for _, v := range pxy.cfg.Sks {
+		if util.GetSkFingerprint(v.Sk) == skFingerprint {
+			return v.Sk
+		}
+	}
+	return pxy.cfg.Sk
 }
 
 func (pxy *XtcpProxy) sendDetectMsg(addr string, port int, laddr *net.UDPAddr, content []byte) (err error) {
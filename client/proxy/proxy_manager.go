@@ -49,6 +49,16 @@ func (pm *ProxyManager) StartProxy(name string, remoteAddr string, serverRespErr
 	return nil
 }
 
+func (pm *ProxyManager) CloseProxyByServer(name string) error {
+	pm.mu.RLock()
+	pxy, ok := pm.proxies[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("proxy [%s] not found", name)
+	}
+	return pxy.SetClosedByServer()
+}
+
 func (pm *ProxyManager) Close() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -121,6 +121,23 @@ func (pw *ProxyWrapper) SetRunningStatus(remoteAddr string, respErr string) erro
 	return nil
 }
 
+// SetClosedByServer marks a running proxy as start error, so it will be
+// registered again after startErrTimeout.
+func (pw *ProxyWrapper) SetClosedByServer() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.Status != ProxyStatusRunning {
+		return fmt.Errorf("status not running, ignore close message")
+	}
+
+	pw.pxy.Close()
+	pw.Trace("change status from [%s] to [%s]", pw.Status, ProxyStatusStartErr)
+	pw.Status = ProxyStatusStartErr
+	pw.Err = "closed by server"
+	pw.lastStartErr = time.Now()
+	return nil
+}
+
 func (pw *ProxyWrapper) Start() {
 	go pw.checkWorker()
 	if pw.monitor != nil {
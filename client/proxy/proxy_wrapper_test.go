@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/client/event"
+	"github.com/whysmx/frp/models/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyWrapperClosedByServer(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &config.TcpProxyConf{}
+	cfg.ProxyName = "test"
+	cfg.ProxyType = "tcp"
+	pw := NewProxyWrapper(cfg, func(evType event.EventType, payload interface{}) error { return nil }, "")
+
+	// not running yet
+	assert.Error(pw.SetClosedByServer())
+
+	pw.Status = ProxyStatusWaitStart
+	assert.NoError(pw.SetRunningStatus(":6000", ""))
+	assert.Equal(ProxyStatusRunning, pw.Status)
+
+	assert.NoError(pw.SetClosedByServer())
+	assert.Equal(ProxyStatusStartErr, pw.Status)
+	assert.Equal("closed by server", pw.Err)
+	assert.WithinDuration(time.Now(), pw.lastStartErr, time.Second)
+
+	// ignore duplicate close messages
+	assert.Error(pw.SetClosedByServer())
+}
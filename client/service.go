@@ -39,6 +39,10 @@ type Service struct {
 	// uniq id got from frps, attach it in loginMsg
 	runId string
 
+	// auth scheme of login, it's downgraded to md5 if frps is too old to
+	// support the one of this frpc and upgraded again after frps is upgraded
+	loginAuthScheme string
+
 	// manager control connection with server
 	ctl   *Control
 	ctlMu sync.RWMutex
@@ -47,6 +51,18 @@ type Service struct {
 	visitorCfgs map[string]config.VisitorConf
 	cfgMu       sync.RWMutex
 
+	// serializes changes of config file made by admin api
+	cfgFileMu sync.Mutex
+
+	// assign bind ports of visitors with bind_port = auto
+	visitorPorts *VisitorPortAllocator
+
+	// statuses of visitors, kept when reconnecting to server
+	visitorStatuses *visitorStatusStore
+
+	// TLS config used by all connections to frps, nil if tls_enable is false
+	tlsConfig *tls.Config
+
 	exit     uint32 // 0 means not exit
 	closedCh chan int
 }
@@ -60,10 +76,39 @@ func NewService(pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]conf
 	}
 
 	svr = &Service{
-		pxyCfgs:     pxyCfgs,
-		visitorCfgs: visitorCfgs,
-		exit:        0,
-		closedCh:    make(chan int),
+		pxyCfgs:         pxyCfgs,
+		visitorCfgs:     visitorCfgs,
+		loginAuthScheme: util.NegotiateAuthScheme(version.Full()),
+		visitorStatuses: newVisitorStatusStore(),
+		exit:            0,
+		closedCh:        make(chan int),
+	}
+
+	// ports are saved next to config file by default
+	stateFile := g.GlbClientCfg.VisitorPortStateFile
+	if stateFile == "" && g.GlbClientCfg.CfgFile != "" {
+		stateFile = g.GlbClientCfg.CfgFile + ".visitor_ports.json"
+	}
+	svr.visitorPorts = NewVisitorPortAllocator(g.GlbClientCfg.VisitorPortRange, stateFile)
+	visitorPorts, err := svr.visitorPorts.Assign(visitorCfgs)
+	if err != nil {
+		return
+	}
+	if err = svr.visitorPorts.Commit(visitorPorts); err != nil {
+		return
+	}
+
+	if g.GlbClientCfg.TLSEnable {
+		serverName := g.GlbClientCfg.TLSServerName
+		if serverName == "" {
+			serverName = g.GlbClientCfg.ServerAddr
+		}
+		svr.tlsConfig, err = frpNet.NewClientTLSConfig(g.GlbClientCfg.TLSCertFile, g.GlbClientCfg.TLSKeyFile,
+			g.GlbClientCfg.TLSTrustedCaFile, serverName)
+		if err != nil {
+			err = fmt.Errorf("Create TLS config error: %v", err)
+			return
+		}
 	}
 	return
 }
@@ -90,7 +135,7 @@ func (svr *Service) Run() error {
 			}
 		} else {
 			// login success
-			ctl := NewControl(svr.runId, conn, session, svr.pxyCfgs, svr.visitorCfgs)
+			ctl := NewControl(svr.runId, conn, session, svr.tlsConfig, svr.pxyCfgs, svr.visitorCfgs, svr.visitorStatuses)
 			ctl.Run()
 			svr.ctlMu.Lock()
 			svr.ctl = ctl
@@ -118,7 +163,16 @@ func (svr *Service) keepControllerWorking() {
 	delayTime := time.Second
 
 	for {
-		<-svr.ctl.ClosedDoneCh()
+		svr.ctlMu.RLock()
+		ctl := svr.ctl
+		svr.ctlMu.RUnlock()
+
+		// When server is draining, the old control is kept until server closes
+		// it, so work connections in use are not interrupted.
+		select {
+		case <-ctl.ClosedDoneCh():
+		case <-ctl.DrainCh():
+		}
 		if atomic.LoadUint32(&svr.exit) != 0 {
 			return
 		}
@@ -138,7 +192,7 @@ func (svr *Service) keepControllerWorking() {
 			// reconnect success, init delayTime
 			delayTime = time.Second
 
-			ctl := NewControl(svr.runId, conn, session, svr.pxyCfgs, svr.visitorCfgs)
+			ctl := NewControl(svr.runId, conn, session, svr.tlsConfig, svr.pxyCfgs, svr.visitorCfgs, svr.visitorStatuses)
 			ctl.Run()
 			svr.ctlMu.Lock()
 			svr.ctl = ctl
@@ -152,14 +206,30 @@ func (svr *Service) keepControllerWorking() {
 // conn: control connection
 // session: if it's not nil, using tcp mux
 func (svr *Service) login() (conn frpNet.Conn, session *fmux.Session, err error) {
-	var tlsConfig *tls.Config
-	if g.GlbClientCfg.TLSEnable {
-		tlsConfig = &tls.Config{
-			InsecureSkipVerify: true,
+	conn, session, serverVersion, err := svr.loginWithAuthScheme(svr.loginAuthScheme)
+	if err != nil && serverVersion != "" {
+		// Login again if frps expects another auth scheme, e.g. frps older
+		// than this frpc only accepts md5.
+		if scheme := util.NegotiateAuthScheme(serverVersion); scheme != svr.loginAuthScheme {
+			log.Warn("login to frps [%s] with auth scheme [%s] failed, try [%s]",
+				serverVersion, svr.loginAuthScheme, scheme)
+			svr.loginAuthScheme = scheme
+			conn, session, serverVersion, err = svr.loginWithAuthScheme(scheme)
 		}
 	}
+	if err == nil {
+		svr.loginAuthScheme = util.NegotiateAuthScheme(serverVersion)
+	}
+	return
+}
+
+// loginWithAuthScheme returns the version of frps if a login response is
+// received, even if the login is rejected.
+func (svr *Service) loginWithAuthScheme(authScheme string) (conn frpNet.Conn, session *fmux.Session,
+	serverVersion string, err error) {
+
 	conn, err = frpNet.ConnectServerByProxyWithTLS(g.GlbClientCfg.HttpProxy, g.GlbClientCfg.Protocol,
-		fmt.Sprintf("%s:%d", g.GlbClientCfg.ServerAddr, g.GlbClientCfg.ServerPort), tlsConfig)
+		fmt.Sprintf("%s:%d", g.GlbClientCfg.ServerAddr, g.GlbClientCfg.ServerPort), svr.tlsConfig)
 	if err != nil {
 		return
 	}
@@ -194,7 +264,7 @@ func (svr *Service) login() (conn frpNet.Conn, session *fmux.Session, err error)
 		PoolCount:    g.GlbClientCfg.PoolCount,
 		User:         g.GlbClientCfg.User,
 		Version:      version.Full(),
-		PrivilegeKey: util.GetAuthKey(g.GlbClientCfg.Token, now),
+		PrivilegeKey: util.GetAuthKeyWithScheme(authScheme, g.GlbClientCfg.Token, now),
 		Timestamp:    now,
 		RunId:        svr.runId,
 	}
@@ -209,6 +279,7 @@ func (svr *Service) login() (conn frpNet.Conn, session *fmux.Session, err error)
 		return
 	}
 	conn.SetReadDeadline(time.Time{})
+	serverVersion = loginRespMsg.Version
 
 	if loginRespMsg.Error != "" {
 		err = fmt.Errorf("%s", loginRespMsg.Error)
@@ -218,6 +289,7 @@ func (svr *Service) login() (conn frpNet.Conn, session *fmux.Session, err error)
 
 	svr.runId = loginRespMsg.RunId
 	g.GlbClientCfg.ServerUdpPort = loginRespMsg.ServerUdpPort
+	g.GlbClientCfg.AuthScheme = util.NegotiateAuthScheme(loginRespMsg.Version)
 	log.Info("login to server success, get run id [%s], server udp port [%d]", loginRespMsg.RunId, loginRespMsg.ServerUdpPort)
 	return
 }
@@ -228,11 +300,11 @@ func (svr *Service) ReloadConf(pxyCfgs map[string]config.ProxyConf, visitorCfgs
 	svr.visitorCfgs = visitorCfgs
 	svr.cfgMu.Unlock()
 
-	return svr.ctl.ReloadConf(pxyCfgs, visitorCfgs)
+	return svr.GetController().ReloadConf(pxyCfgs, visitorCfgs)
 }
 
 func (svr *Service) Close() {
 	atomic.StoreUint32(&svr.exit, 1)
-	svr.ctl.Close()
+	svr.GetController().Close()
 	close(svr.closedCh)
 }
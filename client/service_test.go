@@ -0,0 +1,94 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/msg"
+	"github.com/whysmx/frp/utils/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runMockServer accepts logins like frps of serverVersion, only keys of
+// authScheme are accepted. It returns the listen port and auth schemes of
+// received logins.
+func runMockServer(t *testing.T, serverVersion string, authScheme string, token string) (int, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemes := make(chan string, 10)
+	go func() {
+		defer l.Close()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var loginMsg msg.Login
+			if err = msg.ReadMsgInto(conn, &loginMsg); err != nil {
+				conn.Close()
+				continue
+			}
+			resp := &msg.LoginResp{Version: serverVersion}
+			switch loginMsg.PrivilegeKey {
+			case util.GetAuthKeyWithScheme(util.AuthSchemeMd5, token, loginMsg.Timestamp):
+				schemes <- util.AuthSchemeMd5
+			case util.GetAuthKeyWithScheme(util.AuthSchemeHmacSha256, token, loginMsg.Timestamp):
+				schemes <- util.AuthSchemeHmacSha256
+			}
+			if loginMsg.PrivilegeKey == util.GetAuthKeyWithScheme(authScheme, token, loginMsg.Timestamp) {
+				resp.RunId = "run-id"
+			} else {
+				resp.Error = "authorization failed"
+			}
+			msg.WriteMsg(conn, resp)
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, schemes
+}
+
+func TestLoginAuthScheme(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		serverVersion string
+		serverScheme  string
+		// auth schemes of logins sent by frpc
+		expected []string
+	}{
+		// frps older than 0.28.0 only accepts md5
+		{"0.27.1", util.AuthSchemeMd5, []string{util.AuthSchemeHmacSha256, util.AuthSchemeMd5, util.AuthSchemeMd5}},
+		{"0.28.0", util.AuthSchemeHmacSha256, []string{util.AuthSchemeHmacSha256, util.AuthSchemeHmacSha256}},
+	}
+	for _, c := range cases {
+		port, schemes := runMockServer(t, c.serverVersion, c.serverScheme, "123")
+		g.GlbClientCfg = &g.ClientCfg{ClientCommonConf: *config.GetDefaultClientConf()}
+		g.GlbClientCfg.ServerAddr = "127.0.0.1"
+		g.GlbClientCfg.ServerPort = port
+		g.GlbClientCfg.TcpMux = false
+		g.GlbClientCfg.Token = "123"
+
+		svr := &Service{loginAuthScheme: util.AuthSchemeHmacSha256}
+		conn, _, err := svr.login()
+		if assert.NoError(err, c.serverVersion) {
+			conn.Close()
+		}
+		assert.Equal(c.serverScheme, g.GlbClientCfg.AuthScheme)
+
+		// the scheme accepted is used in next login directly
+		conn, _, err = svr.login()
+		if assert.NoError(err, c.serverVersion) {
+			conn.Close()
+		}
+
+		for _, expected := range c.expected {
+			assert.Equal(expected, <-schemes, c.serverVersion)
+		}
+		assert.Len(schemes, 0)
+	}
+}
@@ -42,9 +42,10 @@ type Visitor interface {
 	log.Logger
 }
 
-func NewVisitor(ctl *Control, cfg config.VisitorConf) (visitor Visitor) {
+func NewVisitor(ctl *Control, cfg config.VisitorConf, status *visitorStatusWrapper) (visitor Visitor) {
 	baseVisitor := BaseVisitor{
 		ctl:    ctl,
+		status: status,
 		Logger: log.NewPrefixLogger(cfg.GetBaseInfo().ProxyName),
 	}
 	switch cfg := cfg.(type) {
@@ -64,6 +65,7 @@ func NewVisitor(ctl *Control, cfg config.VisitorConf) (visitor Visitor) {
 
 type BaseVisitor struct {
 	ctl    *Control
+	status *visitorStatusWrapper
 	l      frpNet.Listener
 	closed bool
 	mu     sync.RWMutex
@@ -95,6 +97,7 @@ func (sv *StcpVisitor) worker() {
 		conn, err := sv.l.Accept()
 		if err != nil {
 			sv.Warn("stcp local listener closed")
+			sv.status.SetClosed()
 			return
 		}
 
@@ -103,6 +106,9 @@ func (sv *StcpVisitor) worker() {
 }
 
 func (sv *StcpVisitor) handleConn(userConn frpNet.Conn) {
+	sv.status.OpenConn()
+	defer sv.status.CloseConn()
+	userConn = newVisitorUserConn(userConn, sv.status)
 	defer userConn.Close()
 
 	sv.Debug("get a new stcp user connection")
@@ -113,10 +119,19 @@ func (sv *StcpVisitor) handleConn(userConn frpNet.Conn) {
 	defer visitorConn.Close()
 
 	now := time.Now().Unix()
+	nonce, err := util.RandId()
+	if err != nil {
+		return
+	}
+	privilegeKey := util.GetPrivilegeKey(g.GlbClientCfg.AuthScheme, g.GlbClientCfg.Token,
+		util.AuthPurposeNewVisitorConn, sv.ctl.runId, now)
 	newVisitorConnMsg := &msg.NewVisitorConn{
+		RunId:          sv.ctl.runId,
+		PrivilegeKey:   privilegeKey,
 		ProxyName:      sv.cfg.ServerName,
-		SignKey:        util.GetAuthKey(sv.cfg.Sk, now),
+		SignKey:        util.GetVisitorAuthKey(g.GlbClientCfg.AuthScheme, sv.cfg.Sk, now, nonce),
 		Timestamp:      now,
+		Nonce:          nonce,
 		UseEncryption:  sv.cfg.UseEncryption,
 		UseCompression: sv.cfg.UseCompression,
 	}
@@ -137,8 +152,11 @@ func (sv *StcpVisitor) handleConn(userConn frpNet.Conn) {
 
 	if newVisitorConnRespMsg.Error != "" {
 		sv.Warn("start new visitor connection error: %s", newVisitorConnRespMsg.Error)
+		sv.status.SetLastConnErr(newVisitorConnRespMsg.Error)
 		return
 	}
+	sv.Debug("visitor connection uses sk [%s]", newVisitorConnRespMsg.SkFingerprint)
+	sv.status.SetSkFingerprint(newVisitorConnRespMsg.SkFingerprint)
 
 	var remote io.ReadWriteCloser
 	remote = visitorConn
@@ -182,6 +200,7 @@ func (sv *XtcpVisitor) worker() {
 		conn, err := sv.l.Accept()
 		if err != nil {
 			sv.Warn("xtcp local listener closed")
+			sv.status.SetClosed()
 			return
 		}
 
@@ -190,6 +209,9 @@ func (sv *XtcpVisitor) worker() {
 }
 
 func (sv *XtcpVisitor) handleConn(userConn frpNet.Conn) {
+	sv.status.OpenConn()
+	defer sv.status.CloseConn()
+	userConn = newVisitorUserConn(userConn, sv.status)
 	defer userConn.Close()
 
 	sv.Debug("get a new xtcp user connection")
@@ -213,10 +235,19 @@ func (sv *XtcpVisitor) handleConn(userConn frpNet.Conn) {
 	defer visitorConn.Close()
 
 	now := time.Now().Unix()
+	nonce, err := util.RandId()
+	if err != nil {
+		return
+	}
+	privilegeKey := util.GetPrivilegeKey(g.GlbClientCfg.AuthScheme, g.GlbClientCfg.Token,
+		util.AuthPurposeNatHoleVisitor, sv.ctl.runId, now)
 	natHoleVisitorMsg := &msg.NatHoleVisitor{
-		ProxyName: sv.cfg.ServerName,
-		SignKey:   util.GetAuthKey(sv.cfg.Sk, now),
-		Timestamp: now,
+		RunId:        sv.ctl.runId,
+		PrivilegeKey: privilegeKey,
+		ProxyName:    sv.cfg.ServerName,
+		SignKey:      util.GetVisitorAuthKey(g.GlbClientCfg.AuthScheme, sv.cfg.Sk, now, nonce),
+		Timestamp:    now,
+		Nonce:        nonce,
 	}
 	err = msg.WriteMsg(visitorConn, natHoleVisitorMsg)
 	if err != nil {
@@ -244,6 +275,7 @@ func (sv *XtcpVisitor) handleConn(userConn frpNet.Conn) {
 
 	if natHoleRespMsg.Error != "" {
 		sv.Error("natHoleRespMsg get error info: %s", natHoleRespMsg.Error)
+		sv.status.SetLastConnErr(natHoleRespMsg.Error)
 		return
 	}
 
@@ -284,6 +316,7 @@ func (sv *XtcpVisitor) handleConn(userConn frpNet.Conn) {
 	pool.PutBuf(sidBuf)
 
 	sv.Info("nat hole connection make success, sid [%s]", natHoleRespMsg.Sid)
+	sv.status.SetSkFingerprint(util.GetSkFingerprint(sv.cfg.Sk))
 
 	// wrap kcp connection
 	var remote io.ReadWriteCloser
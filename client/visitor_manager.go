@@ -27,17 +27,23 @@ type VisitorManager struct {
 
 	cfgs     map[string]config.VisitorConf
 	visitors map[string]Visitor
+	statuses map[string]*visitorStatusWrapper
+
+	// statuses kept across control connections
+	statusStore *visitorStatusStore
 
 	checkInterval time.Duration
 
 	mu sync.Mutex
 }
 
-func NewVisitorManager(ctl *Control) *VisitorManager {
+func NewVisitorManager(ctl *Control, statusStore *visitorStatusStore) *VisitorManager {
 	return &VisitorManager{
 		ctl:           ctl,
+		statusStore:   statusStore,
 		cfgs:          make(map[string]config.VisitorConf),
 		visitors:      make(map[string]Visitor),
+		statuses:      make(map[string]*visitorStatusWrapper),
 		checkInterval: 10 * time.Second,
 	}
 }
@@ -60,8 +66,10 @@ func (vm *VisitorManager) Run() {
 // Hold lock before calling this function.
 func (vm *VisitorManager) startVisitor(cfg config.VisitorConf) (err error) {
 	name := cfg.GetBaseInfo().ProxyName
-	visitor := NewVisitor(vm.ctl, cfg)
+	status := vm.statuses[name]
+	visitor := NewVisitor(vm.ctl, cfg, status)
 	err = visitor.Run()
+	status.SetListenResult(err)
 	if err != nil {
 		visitor.Warn("start error: %v", err)
 	} else {
@@ -94,6 +102,10 @@ func (vm *VisitorManager) Reload(cfgs map[string]config.VisitorConf) {
 				visitor.Close()
 			}
 			delete(vm.visitors, name)
+			delete(vm.statuses, name)
+			if _, ok := cfgs[name]; !ok {
+				vm.statusStore.Remove(name)
+			}
 		}
 	}
 	if len(delNames) > 0 {
@@ -104,6 +116,7 @@ func (vm *VisitorManager) Reload(cfgs map[string]config.VisitorConf) {
 	for name, cfg := range cfgs {
 		if _, ok := vm.cfgs[name]; !ok {
 			vm.cfgs[name] = cfg
+			vm.statuses[name] = vm.statusStore.GetOrCreate(cfg)
 			addNames = append(addNames, name)
 			vm.startVisitor(cfg)
 		}
@@ -114,6 +127,16 @@ func (vm *VisitorManager) Reload(cfgs map[string]config.VisitorConf) {
 	return
 }
 
+func (vm *VisitorManager) GetAllVisitorStatus() []*VisitorStatus {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	ss := make([]*VisitorStatus, 0, len(vm.statuses))
+	for _, status := range vm.statuses {
+		ss = append(ss, status.GetStatus())
+	}
+	return ss
+}
+
 func (vm *VisitorManager) Close() {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
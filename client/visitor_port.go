@@ -0,0 +1,200 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/utils/log"
+)
+
+// VisitorPortAllocator assigns bind ports to visitors with bind_port = auto.
+// Assigned ports are saved in a state file, so a visitor gets the same port
+// after frpc restarts.
+type VisitorPortAllocator struct {
+	// ports assigned indexed by visitor name
+	ports map[string]int
+
+	// ports can be assigned, any free port is used if it's empty
+	portRange []int
+
+	// empty means ports are not saved
+	stateFile string
+
+	mu sync.Mutex
+}
+
+func NewVisitorPortAllocator(portRange []int, stateFile string) *VisitorPortAllocator {
+	pa := &VisitorPortAllocator{
+		ports:     make(map[string]int),
+		portRange: portRange,
+		stateFile: stateFile,
+	}
+	if stateFile == "" {
+		return pa
+	}
+
+	b, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn("read visitor port state file [%s] error: %v", stateFile, err)
+		}
+		return pa
+	}
+	if err = json.Unmarshal(b, &pa.ports); err != nil {
+		log.Warn("parse visitor port state file [%s] error: %v", stateFile, err)
+		pa.ports = make(map[string]int)
+	}
+	return pa
+}
+
+func (pa *VisitorPortAllocator) inRange(port int) bool {
+	if len(pa.portRange) == 0 {
+		return port > 0
+	}
+	for _, p := range pa.portRange {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Assign sets bind ports of visitors with bind_port = auto in cfgs and
+// returns them. Visitors keep the ports assigned before if they are not taken
+// by others. Ports returned are only kept after Commit is called, so nothing
+// is changed if cfgs are not applied.
+func (pa *VisitorPortAllocator) Assign(cfgs map[string]config.VisitorConf) (ports map[string]int, err error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	// ports set in config file can't be assigned
+	used := make(map[int]struct{})
+	autoNames := make([]string, 0)
+	for name, cfg := range cfgs {
+		if cfg.GetBaseInfo().BindPortAuto {
+			autoNames = append(autoNames, name)
+		} else {
+			used[cfg.GetBaseInfo().BindPort] = struct{}{}
+		}
+	}
+	sort.Strings(autoNames)
+
+	ports = make(map[string]int)
+	for _, name := range autoNames {
+		port, ok := pa.ports[name]
+		if !ok || !pa.inRange(port) {
+			continue
+		}
+		if _, ok := used[port]; ok {
+			continue
+		}
+		ports[name] = port
+		used[port] = struct{}{}
+	}
+	for _, name := range autoNames {
+		if _, ok := ports[name]; ok {
+			continue
+		}
+		port, errRet := pa.pickFreePort(cfgs[name].GetBaseInfo().BindAddr, used)
+		if errRet != nil {
+			return nil, fmt.Errorf("assign bind_port of visitor [%s] error: %v", name, errRet)
+		}
+		log.Info("visitor [%s] is assigned bind_port [%d]", name, port)
+		ports[name] = port
+		used[port] = struct{}{}
+	}
+
+	for name, port := range ports {
+		cfgs[name].GetBaseInfo().BindPort = port
+	}
+	return ports, nil
+}
+
+// Commit keeps ports returned by Assign after visitors are applied, ports of
+// other visitors are released. Ports are kept in memory even if they can't be
+// saved to state file.
+func (pa *VisitorPortAllocator) Commit(ports map[string]int) error {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	changed := len(ports) != len(pa.ports)
+	for name, port := range ports {
+		if pa.ports[name] != port {
+			changed = true
+		}
+	}
+	pa.ports = ports
+	if changed {
+		return pa.save()
+	}
+	return nil
+}
+
+// pickFreePort returns the first port in range not used and can be listened.
+func (pa *VisitorPortAllocator) pickFreePort(bindAddr string, used map[int]struct{}) (int, error) {
+	if len(pa.portRange) == 0 {
+		for i := 0; i < 10; i++ {
+			l, err := net.Listen("tcp", net.JoinHostPort(bindAddr, "0"))
+			if err != nil {
+				return 0, err
+			}
+			port := l.Addr().(*net.TCPAddr).Port
+			l.Close()
+			if _, ok := used[port]; !ok {
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("no free port")
+	}
+
+	for _, port := range pa.portRange {
+		if _, ok := used[port]; ok {
+			continue
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort(bindAddr, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		l.Close()
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port in visitor_port_range")
+}
+
+// save writes state file atomically, so assigned ports are not lost if frpc
+// crashes while writing.
+// Hold lock before calling this function.
+func (pa *VisitorPortAllocator) save() error {
+	if pa.stateFile == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(pa.ports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeConfFile(pa.stateFile, string(buf)); err != nil {
+		return fmt.Errorf("write visitor port state file [%s] error: %v", pa.stateFile, err)
+	}
+	return nil
+}
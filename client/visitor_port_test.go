@@ -0,0 +1,133 @@
+package client
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whysmx/frp/models/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVisitorConfs(autoNames []string, fixedPorts map[string]int) map[string]config.VisitorConf {
+	cfgs := make(map[string]config.VisitorConf)
+	for _, name := range autoNames {
+		cfg := &config.StcpVisitorConf{}
+		cfg.ProxyName = name
+		cfg.BindAddr = "127.0.0.1"
+		cfg.BindPortAuto = true
+		cfgs[name] = cfg
+	}
+	for name, port := range fixedPorts {
+		cfg := &config.StcpVisitorConf{}
+		cfg.ProxyName = name
+		cfg.BindAddr = "127.0.0.1"
+		cfg.BindPort = port
+		cfgs[name] = cfg
+	}
+	return cfgs
+}
+
+func TestVisitorPortAllocatorNoFreePort(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frpc_visitor_ports")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "visitor_ports.json")
+
+	portRange := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(err) {
+			return
+		}
+		portRange = append(portRange, l.Addr().(*net.TCPAddr).Port)
+		defer l.Close()
+	}
+	// ports which can't be listened are not assigned
+	pa := NewVisitorPortAllocator(portRange, stateFile)
+	_, err = pa.Assign(newTestVisitorConfs([]string{"a"}, nil))
+	assert.Error(err)
+}
+
+func TestVisitorPortAllocatorSticky(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frpc_visitor_ports")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "visitor_ports.json")
+
+	portRange := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(err) {
+			return
+		}
+		portRange = append(portRange, l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+	}
+	r0, r1 := portRange[0], portRange[1]
+
+	pa := NewVisitorPortAllocator(portRange, stateFile)
+	cfgs := newTestVisitorConfs([]string{"a", "b"}, nil)
+	ports, err := pa.Assign(cfgs)
+	assert.NoError(err)
+	assert.Equal(map[string]int{"a": r0, "b": r1}, ports)
+	assert.Equal(r0, cfgs["a"].GetBaseInfo().BindPort)
+	assert.Equal(r1, cfgs["b"].GetBaseInfo().BindPort)
+
+	// nothing is saved before Commit
+	_, err = os.Stat(stateFile)
+	assert.True(os.IsNotExist(err))
+	assert.NoError(pa.Commit(ports))
+
+	// b keeps its port after restarting even if a is removed
+	pa = NewVisitorPortAllocator(portRange, stateFile)
+	ports, err = pa.Assign(newTestVisitorConfs([]string{"b", "c"}, nil))
+	assert.NoError(err)
+	assert.Equal(map[string]int{"b": r1, "c": r0}, ports)
+
+	// b gets another port if its port is set for other visitors in config file,
+	// the ports are not kept without Commit
+	ports, err = pa.Assign(newTestVisitorConfs([]string{"b"}, map[string]int{"x": r1}))
+	assert.NoError(err)
+	assert.Equal(map[string]int{"b": r0}, ports)
+	ports, err = pa.Assign(newTestVisitorConfs([]string{"a", "b"}, nil))
+	assert.NoError(err)
+	assert.Equal(map[string]int{"a": r0, "b": r1}, ports)
+
+	assert.NoError(pa.Commit(map[string]int{"b": r1, "c": r0}))
+	pa = NewVisitorPortAllocator(portRange, stateFile)
+	ports, err = pa.Assign(newTestVisitorConfs([]string{"c"}, nil))
+	assert.NoError(err)
+	assert.Equal(map[string]int{"c": r0}, ports)
+}
+
+func TestVisitorPortAllocatorSaveError(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frpc_visitor_ports")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "visitor_ports.json")
+
+	// state file is replaced as a whole, no temporary files are left
+	pa := NewVisitorPortAllocator(nil, stateFile)
+	assert.NoError(pa.Commit(map[string]int{"a": 6000}))
+	assert.NoError(pa.Commit(map[string]int{"a": 6000, "b": 6001}))
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 1)
+	buf, err := ioutil.ReadFile(stateFile)
+	assert.NoError(err)
+	assert.JSONEq(`{"a": 6000, "b": 6001}`, string(buf))
+
+	// error of writing state file is returned
+	pa = NewVisitorPortAllocator(nil, filepath.Join(dir, "not_exist", "visitor_ports.json"))
+	assert.Error(pa.Commit(map[string]int{"a": 6000}))
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/whysmx/frp/models/config"
+	frpNet "github.com/whysmx/frp/utils/net"
+)
+
+const (
+	VisitorStatusNew       = "new"
+	VisitorStatusListening = "listening"
+	VisitorStatusListenErr = "listen error"
+	VisitorStatusClosed    = "closed"
+)
+
+type VisitorStatus struct {
+	Name   string             `json:"name"`
+	Type   string             `json:"type"`
+	Status string             `json:"status"`
+	Err    string             `json:"err"`
+	Cfg    config.VisitorConf `json:"cfg"`
+
+	// user connections not closed
+	CurConns   int64 `json:"cur_conns"`
+	TotalConns int64 `json:"total_conns"`
+
+	// bytes from server and bytes to server, counted as they flow
+	TrafficIn  int64 `json:"traffic_in"`
+	TrafficOut int64 `json:"traffic_out"`
+
+	// last error returned by server when creating visitor connections
+	LastConnErr string `json:"last_conn_err"`
+
+	// fingerprint of the secret key used by the last visitor connection
+	// accepted by server
+	SkFingerprint string `json:"sk_fingerprint"`
+}
+
+// visitorStatusWrapper keeps status of a visitor when its listener is
+// restarted, it's shared by the visitor and VisitorManager.
+type visitorStatusWrapper struct {
+	// accessed atomically
+	trafficIn  int64
+	trafficOut int64
+
+	VisitorStatus
+
+	mu sync.RWMutex
+}
+
+func newVisitorStatusWrapper(cfg config.VisitorConf) *visitorStatusWrapper {
+	return &visitorStatusWrapper{
+		VisitorStatus: VisitorStatus{
+			Name:   cfg.GetBaseInfo().ProxyName,
+			Type:   cfg.GetBaseInfo().ProxyType,
+			Status: VisitorStatusNew,
+			Cfg:    cfg,
+		},
+	}
+}
+
+func (sw *visitorStatusWrapper) SetListenResult(err error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if err != nil {
+		sw.Status = VisitorStatusListenErr
+		sw.Err = err.Error()
+	} else {
+		sw.Status = VisitorStatusListening
+		sw.Err = ""
+	}
+}
+
+func (sw *visitorStatusWrapper) SetClosed() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.Status = VisitorStatusClosed
+}
+
+func (sw *visitorStatusWrapper) OpenConn() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.CurConns++
+	sw.TotalConns++
+}
+
+func (sw *visitorStatusWrapper) CloseConn() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.CurConns--
+}
+
+func (sw *visitorStatusWrapper) AddTrafficIn(n int64) {
+	atomic.AddInt64(&sw.trafficIn, n)
+}
+
+func (sw *visitorStatusWrapper) AddTrafficOut(n int64) {
+	atomic.AddInt64(&sw.trafficOut, n)
+}
+
+func (sw *visitorStatusWrapper) SetLastConnErr(errStr string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.LastConnErr = errStr
+}
+
+func (sw *visitorStatusWrapper) SetSkFingerprint(skFingerprint string) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.SkFingerprint = skFingerprint
+}
+
+func (sw *visitorStatusWrapper) GetStatus() *VisitorStatus {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+	status := sw.VisitorStatus
+	status.TrafficIn = atomic.LoadInt64(&sw.trafficIn)
+	status.TrafficOut = atomic.LoadInt64(&sw.trafficOut)
+	return &status
+}
+
+// visitorUserConn counts bytes of a user connection of visitor, bytes
+// written to user come from server and bytes read from user go to server.
+type visitorUserConn struct {
+	frpNet.Conn
+
+	status *visitorStatusWrapper
+}
+
+func newVisitorUserConn(conn frpNet.Conn, status *visitorStatusWrapper) *visitorUserConn {
+	return &visitorUserConn{
+		Conn:   conn,
+		status: status,
+	}
+}
+
+func (c *visitorUserConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.status.AddTrafficOut(int64(n))
+	return
+}
+
+func (c *visitorUserConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	c.status.AddTrafficIn(int64(n))
+	return
+}
+
+// visitorStatusStore is owned by Service, so statuses of visitors are not
+// lost when the control connection with server is recreated.
+type visitorStatusStore struct {
+	statuses map[string]*visitorStatusWrapper
+	mu       sync.Mutex
+}
+
+func newVisitorStatusStore() *visitorStatusStore {
+	return &visitorStatusStore{
+		statuses: make(map[string]*visitorStatusWrapper),
+	}
+}
+
+// GetOrCreate returns the status kept for visitor with the same config or a
+// new one if config is changed.
+func (s *visitorStatusStore) GetOrCreate(cfg config.VisitorConf) *visitorStatusWrapper {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := cfg.GetBaseInfo().ProxyName
+	if sw, ok := s.statuses[name]; ok && sw.Cfg.Compare(cfg) {
+		return sw
+	}
+	sw := newVisitorStatusWrapper(cfg)
+	s.statuses[name] = sw
+	return sw
+}
+
+func (s *visitorStatusStore) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.statuses, name)
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/whysmx/frp/models/config"
+	frpNet "github.com/whysmx/frp/utils/net"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisitorUserConnTraffic(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &config.StcpVisitorConf{}
+	cfg.ProxyName = "test"
+	status := newVisitorStatusWrapper(cfg)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	status.OpenConn()
+	userConn := newVisitorUserConn(frpNet.WrapConn(c1), status)
+
+	// traffic is counted before connection is closed
+	go c2.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err := io.ReadFull(userConn, buf)
+	assert.NoError(err)
+
+	go io.ReadFull(c2, make([]byte, 3))
+	_, err = userConn.Write([]byte("abc"))
+	assert.NoError(err)
+
+	s := status.GetStatus()
+	assert.EqualValues(1, s.CurConns)
+	assert.EqualValues(3, s.TrafficIn)
+	assert.EqualValues(5, s.TrafficOut)
+
+	userConn.Close()
+	status.CloseConn()
+	s = status.GetStatus()
+	assert.EqualValues(0, s.CurConns)
+	assert.EqualValues(1, s.TotalConns)
+	assert.EqualValues(3, s.TrafficIn)
+	assert.EqualValues(5, s.TrafficOut)
+}
+
+func TestVisitorStatusStore(t *testing.T) {
+	assert := assert.New(t)
+
+	newCfg := func(port int) *config.StcpVisitorConf {
+		cfg := &config.StcpVisitorConf{}
+		cfg.ProxyName = "test"
+		cfg.BindPort = port
+		return cfg
+	}
+
+	store := newVisitorStatusStore()
+	sw := store.GetOrCreate(newCfg(10000))
+	sw.OpenConn()
+	sw.AddTrafficIn(10)
+
+	// a new control connection gets the same status
+	assert.True(sw == store.GetOrCreate(newCfg(10000)))
+	s := store.GetOrCreate(newCfg(10000)).GetStatus()
+	assert.EqualValues(1, s.TotalConns)
+	assert.EqualValues(10, s.TrafficIn)
+
+	// config changed
+	sw2 := store.GetOrCreate(newCfg(10001))
+	assert.False(sw == sw2)
+	assert.EqualValues(0, sw2.GetStatus().TotalConns)
+
+	store.Remove("test")
+	assert.False(sw2 == store.GetOrCreate(newCfg(10001)))
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/whysmx/frp/client"
 	"github.com/whysmx/frp/g"
 	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
 	"github.com/whysmx/frp/utils/version"
 )
@@ -192,6 +193,10 @@ func runClient(cfgFilePath string) (err error) {
 
 func startService(pxyCfgs map[string]config.ProxyConf, visitorCfgs map[string]config.VisitorConf) (err error) {
 	log.InitLog(g.GlbClientCfg.LogWay, g.GlbClientCfg.LogFile, g.GlbClientCfg.LogLevel, g.GlbClientCfg.LogMaxDays)
+	if err = audit.InitAudit(g.GlbClientCfg.AuditLogFile); err != nil {
+		err = fmt.Errorf("Open audit log file error: %v", err)
+		return
+	}
 	if g.GlbClientCfg.DnsServer != "" {
 		s := g.GlbClientCfg.DnsServer
 		if !strings.Contains(s, ":") {
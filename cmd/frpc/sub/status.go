@@ -151,5 +151,20 @@ func status() error {
 		fmt.Println("")
 	}
 
+	if len(res.Visitors) > 0 {
+		fmt.Println("Visitor Status...")
+		tbl := table.New("Name", "Type", "ServerName", "BindAddr", "Status", "Conns", "TotalConns", "TrafficIn", "TrafficOut", "Sk", "Error")
+		for _, vs := range res.Visitors {
+			errStr := vs.Err
+			if errStr == "" {
+				errStr = vs.LastConnErr
+			}
+			tbl.AddRow(vs.Name, vs.Type, vs.ServerName, fmt.Sprintf("%s:%d", vs.BindAddr, vs.BindPort), vs.Status,
+				vs.CurConns, vs.TotalConns, vs.TrafficIn, vs.TrafficOut, vs.SkFingerprint, errStr)
+		}
+		tbl.Print()
+		fmt.Println("")
+	}
+
 	return nil
 }
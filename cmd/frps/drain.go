@@ -0,0 +1,128 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/server"
+	"github.com/whysmx/frp/utils/log"
+)
+
+var drainTimeout int64
+
+func init() {
+	drainCmd.PersistentFlags().Int64VarP(&drainTimeout, "timeout", "", -1, "max seconds to wait for user connections, drain_timeout is used if not set")
+	rootCmd.AddCommand(drainCmd)
+}
+
+var drainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Drain frps gracefully before stopping it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		iniContent, err := config.GetRenderedConfFromFile(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = parseServerCommonCfg(CfgFileTypeIni, iniContent)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		res, err := drain()
+		if err != nil {
+			fmt.Printf("frps drain error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("frps is draining, it will exit before %s\n", res.Deadline)
+		return nil
+	},
+}
+
+func drain() (res *server.DrainResp, err error) {
+	if g.GlbServerCfg.DashboardPort == 0 {
+		return nil, fmt.Errorf("dashboard_port shoud be set if you want to use drain feature")
+	}
+
+	url := "http://" + g.GlbServerCfg.DashboardAddr + ":" + fmt.Sprintf("%d", g.GlbServerCfg.DashboardPort) + "/api/drain"
+	if drainTimeout >= 0 {
+		url += fmt.Sprintf("?timeout=%d", drainTimeout)
+	}
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return
+	}
+
+	authStr := "Basic " + base64.StdEncoding.EncodeToString([]byte(g.GlbServerCfg.DashboardUser+":"+
+		g.GlbServerCfg.DashboardPwd))
+
+	req.Header.Add("Authorization", authStr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("code [%d], %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	res = &server.DrainResp{}
+	err = json.Unmarshal(body, res)
+	return
+}
+
+// handleDrainSignal drains frps when SIGTERM is received, frps exits at once
+// if SIGTERM is received again or SIGINT is received.
+func handleDrainSignal(svr *server.Service) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT)
+	for sig := range ch {
+		if sig == syscall.SIGINT {
+			log.Info("receive SIGINT, exit now")
+			svr.Exit(fmt.Errorf("frps exits by SIGINT"))
+			continue
+		}
+		if svr.IsDraining() {
+			log.Info("receive SIGTERM again, exit now")
+			svr.Exit(fmt.Errorf("frps exits before draining finished"))
+			continue
+		}
+		log.Info("receive SIGTERM, start draining")
+		if _, err := svr.Drain(time.Duration(g.GetServerCfg().DrainTimeout)*time.Second, "signal"); err != nil {
+			log.Warn("drain frps error: %v", err)
+		}
+	}
+}
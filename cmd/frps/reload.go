@@ -0,0 +1,129 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/server"
+	"github.com/whysmx/frp/utils/log"
+)
+
+func init() {
+	rootCmd.AddCommand(reloadCmd)
+}
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Hot-Reload frps configuration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		iniContent, err := config.GetRenderedConfFromFile(cfgFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = parseServerCommonCfg(CfgFileTypeIni, iniContent)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// If dashboard_user or dashboard_pwd is changed in config file, frps
+		// still requires the old ones until reloaded, they can be set by flags.
+		if cmd.Flags().Changed("dashboard_user") {
+			g.GlbServerCfg.DashboardUser = dashboardUser
+		}
+		if cmd.Flags().Changed("dashboard_pwd") {
+			g.GlbServerCfg.DashboardPwd = dashboardPwd
+		}
+
+		res, err := reload()
+		if err != nil {
+			fmt.Printf("frps reload error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("reload success\n")
+		if len(res.Applied) > 0 {
+			fmt.Printf("applied: %s\n", strings.Join(res.Applied, ", "))
+		}
+		if len(res.NeedRestart) > 0 {
+			fmt.Printf("need restart to take effect: %s\n", strings.Join(res.NeedRestart, ", "))
+		}
+		return nil
+	},
+}
+
+func reload() (res *server.ReloadResult, err error) {
+	if g.GlbServerCfg.DashboardPort == 0 {
+		return nil, fmt.Errorf("dashboard_port shoud be set if you want to use reload feature")
+	}
+
+	req, err := http.NewRequest("POST", "http://"+
+		g.GlbServerCfg.DashboardAddr+":"+fmt.Sprintf("%d", g.GlbServerCfg.DashboardPort)+"/api/reload", nil)
+	if err != nil {
+		return
+	}
+
+	authStr := "Basic " + base64.StdEncoding.EncodeToString([]byte(g.GlbServerCfg.DashboardUser+":"+
+		g.GlbServerCfg.DashboardPwd))
+
+	req.Header.Add("Authorization", authStr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("code [%d], if dashboard_user or dashboard_pwd is changed, "+
+			"set the old ones by --dashboard_user and --dashboard_pwd", resp.StatusCode)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("code [%d], %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	res = &server.ReloadResult{}
+	err = json.Unmarshal(body, res)
+	return
+}
+
+// handleReloadSignal reloads frps configuration when SIGHUP is received.
+func handleReloadSignal(svr *server.Service) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		log.Info("receive SIGHUP, reload frps conf")
+		if _, err := svr.ReloadConf("signal"); err != nil {
+			log.Warn("reload frps conf error: %v", err)
+		}
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"github.com/whysmx/frp/g"
 	"github.com/whysmx/frp/models/config"
 	"github.com/whysmx/frp/server"
+	"github.com/whysmx/frp/utils/accesslog"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
 	"github.com/whysmx/frp/utils/util"
 	"github.com/whysmx/frp/utils/version"
@@ -197,12 +199,19 @@ func parseServerCommonCfgFromCmd() (err error) {
 func runServer() (err error) {
 	log.InitLog(g.GlbServerCfg.LogWay, g.GlbServerCfg.LogFile, g.GlbServerCfg.LogLevel,
 		g.GlbServerCfg.LogMaxDays)
+	if err = audit.InitAudit(g.GlbServerCfg.AuditLogFile); err != nil {
+		return fmt.Errorf("Open audit log file error: %v", err)
+	}
+	if err = accesslog.InitAccessLog(g.GlbServerCfg.AccessLogFile); err != nil {
+		return fmt.Errorf("Open access log file error: %v", err)
+	}
 	svr, err := server.NewService()
 	if err != nil {
 		return err
 	}
 	log.Info("Start frps success")
 	server.ServerService = svr
-	svr.Run()
-	return
+	go handleReloadSignal(svr)
+	go handleDrainSignal(svr)
+	return svr.Run()
 }
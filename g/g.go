@@ -1,12 +1,16 @@
 package g
 
 import (
+	"sync"
+
 	"github.com/whysmx/frp/models/config"
 )
 
 var (
 	GlbClientCfg *ClientCfg
 	GlbServerCfg *ServerCfg
+
+	glbServerCfgMu sync.RWMutex
 )
 
 func init() {
@@ -22,7 +26,8 @@ type ClientCfg struct {
 	config.ClientCommonConf
 
 	CfgFile       string
-	ServerUdpPort int // this is configured by login response from frps
+	ServerUdpPort int    // this is configured by login response from frps
+	AuthScheme    string // this is negotiated by login response from frps
 }
 
 type ServerCfg struct {
@@ -30,3 +35,18 @@ type ServerCfg struct {
 
 	CfgFile string
 }
+
+// GetServerCfg returns the server config in use. It is replaced as a whole
+// when frps reloads config, so it must not be modified by callers.
+func GetServerCfg() *ServerCfg {
+	glbServerCfgMu.RLock()
+	defer glbServerCfgMu.RUnlock()
+	return GlbServerCfg
+}
+
+// SetServerCfg replaces the server config in use.
+func SetServerCfg(cfg *ServerCfg) {
+	glbServerCfgMu.Lock()
+	defer glbServerCfgMu.Unlock()
+	GlbServerCfg = cfg
+}
@@ -20,59 +20,85 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/whysmx/frp/utils/util"
+
 	ini "github.com/vaughan0/go-ini"
 )
 
 // client common config
 type ClientCommonConf struct {
-	ServerAddr        string              `json:"server_addr"`
-	ServerPort        int                 `json:"server_port"`
-	HttpProxy         string              `json:"http_proxy"`
-	LogFile           string              `json:"log_file"`
-	LogWay            string              `json:"log_way"`
-	LogLevel          string              `json:"log_level"`
-	LogMaxDays        int64               `json:"log_max_days"`
-	Token             string              `json:"token"`
-	AdminAddr         string              `json:"admin_addr"`
-	AdminPort         int                 `json:"admin_port"`
-	AdminUser         string              `json:"admin_user"`
-	AdminPwd          string              `json:"admin_pwd"`
-	PoolCount         int                 `json:"pool_count"`
-	TcpMux            bool                `json:"tcp_mux"`
-	User              string              `json:"user"`
-	DnsServer         string              `json:"dns_server"`
-	LoginFailExit     bool                `json:"login_fail_exit"`
-	Start             map[string]struct{} `json:"start"`
-	Protocol          string              `json:"protocol"`
-	TLSEnable         bool                `json:"tls_enable"`
-	HeartBeatInterval int64               `json:"heartbeat_interval"`
-	HeartBeatTimeout  int64               `json:"heartbeat_timeout"`
+	ServerAddr               string              `json:"server_addr"`
+	ServerPort               int                 `json:"server_port"`
+	HttpProxy                string              `json:"http_proxy"`
+	LogFile                  string              `json:"log_file"`
+	LogWay                   string              `json:"log_way"`
+	LogLevel                 string              `json:"log_level"`
+	LogMaxDays               int64               `json:"log_max_days"`
+	AuditLogFile             string              `json:"audit_log_file"`
+	Token                    string              `json:"token"`
+	AdminAddr                string              `json:"admin_addr"`
+	AdminPort                int                 `json:"admin_port"`
+	AdminUser                string              `json:"admin_user"`
+	AdminPwd                 string              `json:"admin_pwd"`
+	PoolCount                int                 `json:"pool_count"`
+	TcpMux                   bool                `json:"tcp_mux"`
+	User                     string              `json:"user"`
+	DnsServer                string              `json:"dns_server"`
+	LoginFailExit            bool                `json:"login_fail_exit"`
+	Start                    map[string]struct{} `json:"start"`
+	Protocol                 string              `json:"protocol"`
+	TLSEnable                bool                `json:"tls_enable"`
+	TLSCertFile              string              `json:"tls_cert_file"`
+	TLSKeyFile               string              `json:"tls_key_file"`
+	TLSTrustedCaFile         string              `json:"tls_trusted_ca_file"`
+	TLSServerName            string              `json:"tls_server_name"`
+	AuthenticateHeartBeats   bool                `json:"authenticate_heartbeats"`
+	AuthenticateNewWorkConns bool                `json:"authenticate_new_work_conns"`
+	HeartBeatInterval        int64               `json:"heartbeat_interval"`
+	HeartBeatTimeout         int64               `json:"heartbeat_timeout"`
+
+	// VisitorPortRange are ports assigned to visitors with bind_port = auto,
+	// any free port is used if it's empty.
+	VisitorPortRange []int `json:"visitor_port_range"`
+
+	// VisitorPortStateFile saves ports assigned to visitors, so visitors use
+	// the same ports after restarting.
+	VisitorPortStateFile string `json:"visitor_port_state_file"`
 }
 
 func GetDefaultClientConf() *ClientCommonConf {
 	return &ClientCommonConf{
-		ServerAddr:        "0.0.0.0",
-		ServerPort:        7000,
-		HttpProxy:         os.Getenv("http_proxy"),
-		LogFile:           "console",
-		LogWay:            "console",
-		LogLevel:          "info",
-		LogMaxDays:        3,
-		Token:             "",
-		AdminAddr:         "127.0.0.1",
-		AdminPort:         0,
-		AdminUser:         "",
-		AdminPwd:          "",
-		PoolCount:         1,
-		TcpMux:            true,
-		User:              "",
-		DnsServer:         "",
-		LoginFailExit:     true,
-		Start:             make(map[string]struct{}),
-		Protocol:          "tcp",
-		TLSEnable:         false,
-		HeartBeatInterval: 30,
-		HeartBeatTimeout:  90,
+		ServerAddr:               "0.0.0.0",
+		ServerPort:               7000,
+		HttpProxy:                os.Getenv("http_proxy"),
+		LogFile:                  "console",
+		LogWay:                   "console",
+		LogLevel:                 "info",
+		LogMaxDays:               3,
+		AuditLogFile:             "",
+		Token:                    "",
+		AdminAddr:                "127.0.0.1",
+		AdminPort:                0,
+		AdminUser:                "",
+		AdminPwd:                 "",
+		PoolCount:                1,
+		TcpMux:                   true,
+		User:                     "",
+		DnsServer:                "",
+		LoginFailExit:            true,
+		Start:                    make(map[string]struct{}),
+		Protocol:                 "tcp",
+		TLSEnable:                false,
+		TLSCertFile:              "",
+		TLSKeyFile:               "",
+		TLSTrustedCaFile:         "",
+		TLSServerName:            "",
+		AuthenticateHeartBeats:   false,
+		AuthenticateNewWorkConns: false,
+		HeartBeatInterval:        30,
+		HeartBeatTimeout:         90,
+		VisitorPortRange:         make([]int, 0),
+		VisitorPortStateFile:     "",
 	}
 }
 
@@ -129,6 +155,10 @@ func UnmarshalClientConfFromIni(defaultCfg *ClientCommonConf, content string) (c
 		}
 	}
 
+	if tmpStr, ok = conf.Get("common", "audit_log_file"); ok {
+		cfg.AuditLogFile = tmpStr
+	}
+
 	if tmpStr, ok = conf.Get("common", "token"); ok {
 		cfg.Token = tmpStr
 	}
@@ -202,6 +232,34 @@ func UnmarshalClientConfFromIni(defaultCfg *ClientCommonConf, content string) (c
 		cfg.TLSEnable = false
 	}
 
+	if tmpStr, ok = conf.Get("common", "tls_cert_file"); ok {
+		cfg.TLSCertFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "tls_key_file"); ok {
+		cfg.TLSKeyFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "tls_trusted_ca_file"); ok {
+		cfg.TLSTrustedCaFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "tls_server_name"); ok {
+		cfg.TLSServerName = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "authenticate_heartbeats"); ok && tmpStr == "true" {
+		cfg.AuthenticateHeartBeats = true
+	} else {
+		cfg.AuthenticateHeartBeats = false
+	}
+
+	if tmpStr, ok = conf.Get("common", "authenticate_new_work_conns"); ok && tmpStr == "true" {
+		cfg.AuthenticateNewWorkConns = true
+	} else {
+		cfg.AuthenticateNewWorkConns = false
+	}
+
 	if tmpStr, ok = conf.Get("common", "heartbeat_timeout"); ok {
 		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil {
 			err = fmt.Errorf("Parse conf error: invalid heartbeat_timeout")
@@ -219,6 +277,26 @@ func UnmarshalClientConfFromIni(defaultCfg *ClientCommonConf, content string) (c
 			cfg.HeartBeatInterval = v
 		}
 	}
+
+	if tmpStr, ok = conf.Get("common", "visitor_port_range"); ok {
+		// e.g. 18000-18999,19001
+		ports, errRet := util.ParseRangeNumbers(tmpStr)
+		if errRet != nil {
+			err = fmt.Errorf("Parse conf error: visitor_port_range: %v", errRet)
+			return
+		}
+		for _, port := range ports {
+			if port <= 0 || port > 65535 {
+				err = fmt.Errorf("Parse conf error: visitor_port_range: invalid port [%d]", port)
+				return
+			}
+			cfg.VisitorPortRange = append(cfg.VisitorPortRange, int(port))
+		}
+	}
+
+	if tmpStr, ok = conf.Get("common", "visitor_port_state_file"); ok {
+		cfg.VisitorPortStateFile = tmpStr
+	}
 	return
 }
 
@@ -232,5 +310,15 @@ func (cfg *ClientCommonConf) Check() (err error) {
 		err = fmt.Errorf("Parse conf error: invalid heartbeat_timeout, heartbeat_timeout is less than heartbeat_interval")
 		return
 	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		err = fmt.Errorf("Parse conf error: tls_cert_file and tls_key_file must be specified together")
+		return
+	}
+
+	if !cfg.TLSEnable && (cfg.TLSCertFile != "" || cfg.TLSTrustedCaFile != "") {
+		err = fmt.Errorf("Parse conf error: tls_enable must be true if tls_cert_file or tls_trusted_ca_file is set")
+		return
+	}
 	return
 }
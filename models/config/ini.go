@@ -0,0 +1,195 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ini "github.com/vaughan0/go-ini"
+)
+
+// Same rules as the ini parser, so sections found here are the same as loaded.
+var (
+	iniSectionRegex = regexp.MustCompile(`^\[(.*)\]$`)
+	iniAssignRegex  = regexp.MustCompile(`^([^=]+)=(.*)$`)
+)
+
+// parseIniLine returns the key if line is an assignment or the name if line
+// is a section header, both are empty for blank lines and comments.
+func parseIniLine(line string) (key string, value string, name string, isSection bool) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || line[0] == ';' || line[0] == '#' {
+		return
+	}
+	if groups := iniAssignRegex.FindStringSubmatch(line); groups != nil {
+		return strings.TrimSpace(groups[1]), strings.TrimSpace(groups[2]), "", false
+	}
+	if groups := iniSectionRegex.FindStringSubmatch(line); groups != nil {
+		return "", "", strings.TrimSpace(groups[1]), true
+	}
+	return
+}
+
+// findIniSection returns the index of the header line of section [name] and
+// the index after its last key, start is -1 if the section is not found.
+func findIniSection(lines []string, name string) (start int, end int) {
+	start, end = -1, -1
+	for i, line := range lines {
+		key, _, sectionName, isSection := parseIniLine(line)
+		if isSection {
+			if start >= 0 {
+				break
+			}
+			if sectionName == name {
+				start, end = i, i+1
+			}
+			continue
+		}
+		if start >= 0 && key != "" {
+			end = i + 1
+		}
+	}
+	return
+}
+
+// sortedIniKeys returns keys of section, "type" and "role" are put first.
+func sortedIniKeys(section ini.Section) []string {
+	keys := make([]string, 0, len(section))
+	for k := range section {
+		if k != "type" && k != "role" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range []string{"role", "type"} {
+		if _, ok := section[k]; ok {
+			keys = append([]string{k}, keys...)
+		}
+	}
+	return keys
+}
+
+// SetIniSection replaces keys of section [name] in content with section and
+// returns the new content. Changed keys are updated in place, keys not in
+// section are removed and comments are kept. Other sections are not touched.
+// Values are compared after rendering, so templates like {{ .Envs.PORT }} are
+// kept if the value is not changed.
+// The section is appended to the end if it doesn't exist.
+func SetIniSection(content string, name string, section ini.Section) string {
+	lines := strings.Split(content, "\n")
+	start, end := findIniSection(lines, name)
+
+	newLines := make([]string, 0, len(lines)+len(section)+2)
+	written := make(map[string]struct{})
+	if start < 0 {
+		newLines = append(newLines, lines...)
+		// drop the empty line after the last newline, it's added back at the end
+		if len(newLines) > 0 && newLines[len(newLines)-1] == "" {
+			newLines = newLines[:len(newLines)-1]
+		}
+		if len(newLines) > 0 && strings.TrimSpace(newLines[len(newLines)-1]) != "" {
+			newLines = append(newLines, "")
+		}
+		newLines = append(newLines, "["+name+"]")
+		for _, k := range sortedIniKeys(section) {
+			newLines = append(newLines, k+" = "+section[k])
+		}
+		return strings.Join(newLines, "\n") + "\n"
+	}
+
+	newLines = append(newLines, lines[:start+1]...)
+	for _, line := range lines[start+1 : end] {
+		key, value, _, _ := parseIniLine(line)
+		if key == "" {
+			newLines = append(newLines, line)
+			continue
+		}
+		newValue, ok := section[key]
+		if !ok {
+			continue
+		}
+		if _, ok := written[key]; ok {
+			continue
+		}
+		written[key] = struct{}{}
+		if newValue == value || renderIniValue(value) == newValue {
+			newLines = append(newLines, line)
+		} else {
+			newLines = append(newLines, key+" = "+newValue)
+		}
+	}
+	for _, k := range sortedIniKeys(section) {
+		if _, ok := written[k]; !ok {
+			newLines = append(newLines, k+" = "+section[k])
+		}
+	}
+	newLines = append(newLines, lines[end:]...)
+	return strings.Join(newLines, "\n")
+}
+
+// renderIniValue returns the value rendered as the config file, or value
+// itself if it can't be rendered.
+func renderIniValue(value string) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	out, err := RenderContent(value)
+	if err != nil {
+		return value
+	}
+	return out
+}
+
+// DeleteIniSection removes the header and keys of section [name] from content,
+// comments after its last key are kept since they usually belong to the next
+// section. It returns false if the section doesn't exist.
+func DeleteIniSection(content string, name string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	start, end := findIniSection(lines, name)
+	if start < 0 {
+		return content, false
+	}
+
+	// don't leave two blank lines where the section was
+	if start > 0 && strings.TrimSpace(lines[start-1]) == "" &&
+		(end == len(lines) || strings.TrimSpace(lines[end]) == "") {
+		start--
+	}
+	newLines := make([]string, 0, len(lines))
+	newLines = append(newLines, lines[:start]...)
+	newLines = append(newLines, lines[end:]...)
+	return strings.Join(newLines, "\n"), true
+}
+
+func setIniString(section ini.Section, key string, value string) {
+	if value != "" {
+		section[key] = value
+	}
+}
+
+func setIniBool(section ini.Section, key string, value bool) {
+	if value {
+		section[key] = "true"
+	}
+}
+
+func setIniInt(section ini.Section, key string, value int) {
+	if value != 0 {
+		section[key] = strconv.Itoa(value)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ini "github.com/vaughan0/go-ini"
+)
+
+const testIniContent = `[common]
+server_addr = 127.0.0.1
+
+# ssh of the gateway
+[ssh]
+type = tcp
+# local sshd
+local_port = 22
+remote_port = 6000
+
+# web console
+[web]
+type = http
+local_port = 80
+`
+
+func TestSetIniSection(t *testing.T) {
+	assert := assert.New(t)
+
+	content := SetIniSection(testIniContent, "ssh", ini.Section{
+		"type":        "tcp",
+		"local_port":  "22",
+		"remote_port": "6001",
+		"local_ip":    "192.168.1.2",
+	})
+	assert.Equal(`[common]
+server_addr = 127.0.0.1
+
+# ssh of the gateway
+[ssh]
+type = tcp
+# local sshd
+local_port = 22
+remote_port = 6001
+local_ip = 192.168.1.2
+
+# web console
+[web]
+type = http
+local_port = 80
+`, content)
+
+	content = SetIniSection(testIniContent, "ssh", ini.Section{
+		"type":       "tcp",
+		"local_port": "22",
+	})
+	assert.Equal(`[common]
+server_addr = 127.0.0.1
+
+# ssh of the gateway
+[ssh]
+type = tcp
+# local sshd
+local_port = 22
+
+# web console
+[web]
+type = http
+local_port = 80
+`, content)
+
+	content = SetIniSection(testIniContent, "db", ini.Section{
+		"type":        "tcp",
+		"local_port":  "3306",
+		"remote_port": "6002",
+	})
+	assert.Equal(testIniContent+`
+[db]
+type = tcp
+local_port = 3306
+remote_port = 6002
+`, content)
+}
+
+func TestSetIniSectionWithTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	glbEnvs["FRP_TEST_LOCAL_PORT"] = "22"
+	glbEnvs["FRP_TEST_REMOTE_PORT"] = "6000"
+	defer func() {
+		delete(glbEnvs, "FRP_TEST_LOCAL_PORT")
+		delete(glbEnvs, "FRP_TEST_REMOTE_PORT")
+	}()
+
+	content := `[ssh]
+type = tcp
+local_port = {{ .Envs.FRP_TEST_LOCAL_PORT }}
+remote_port = {{ .Envs.FRP_TEST_REMOTE_PORT }}
+`
+	// templates are kept if rendered values are not changed
+	assert.Equal(`[ssh]
+type = tcp
+local_port = {{ .Envs.FRP_TEST_LOCAL_PORT }}
+remote_port = 6001
+`, SetIniSection(content, "ssh", ini.Section{
+		"type":        "tcp",
+		"local_port":  "22",
+		"remote_port": "6001",
+	}))
+}
+
+func TestDeleteIniSection(t *testing.T) {
+	assert := assert.New(t)
+
+	content, ok := DeleteIniSection(testIniContent, "ssh")
+	assert.True(ok)
+	assert.Equal(`[common]
+server_addr = 127.0.0.1
+
+# ssh of the gateway
+
+# web console
+[web]
+type = http
+local_port = 80
+`, content)
+
+	content, ok = DeleteIniSection(testIniContent, "web")
+	assert.True(ok)
+	assert.Equal(`[common]
+server_addr = 127.0.0.1
+
+# ssh of the gateway
+[ssh]
+type = tcp
+# local sshd
+local_port = 22
+remote_port = 6000
+
+# web console
+`, content)
+
+	_, ok = DeleteIniSection(testIniContent, "db")
+	assert.False(ok)
+}
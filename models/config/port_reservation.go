@@ -0,0 +1,100 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/whysmx/frp/utils/util"
+
+	ini "github.com/vaughan0/go-ini"
+)
+
+// PortReservationConf is one section in port_reservations_file of frps.
+// Ports are reserved for the user or the proxy, both must match if both are set.
+type PortReservationConf struct {
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	ProxyName string `json:"proxy_name"`
+	Ports     []int  `json:"ports"`
+}
+
+func (cfg *PortReservationConf) UnmarshalFromIni(name string, section ini.Section) (err error) {
+	cfg.Name = name
+	cfg.User = strings.TrimSpace(section["user"])
+	cfg.ProxyName = strings.TrimSpace(section["proxy_name"])
+	if cfg.User == "" && cfg.ProxyName == "" {
+		return fmt.Errorf("Parse port reservations conf error: [%s] user or proxy_name is required", name)
+	}
+
+	// e.g. 6000-6010,6100
+	tmpStr := section["ports"]
+	if tmpStr == "" {
+		return fmt.Errorf("Parse port reservations conf error: [%s] ports is required", name)
+	}
+	ports, errRet := util.ParseRangeNumbers(tmpStr)
+	if errRet != nil {
+		return fmt.Errorf("Parse port reservations conf error: [%s] ports error, %v", name, errRet)
+	}
+	cfg.Ports = make([]int, 0, len(ports))
+	for _, port := range ports {
+		if port == 0 || port > 65535 {
+			return fmt.Errorf("Parse port reservations conf error: [%s] invalid port [%d]", name, port)
+		}
+		cfg.Ports = append(cfg.Ports, int(port))
+	}
+	return
+}
+
+// LoadAllPortReservationConfFromIni loads all reservations from content of
+// port_reservations_file, one port can't be reserved by different sections.
+func LoadAllPortReservationConfFromIni(content string) (reservationConfs map[string]*PortReservationConf, err error) {
+	conf, errRet := ini.Load(strings.NewReader(content))
+	if errRet != nil {
+		err = fmt.Errorf("parse ini port reservations file error: %v", errRet)
+		return
+	}
+
+	// sections are checked in order so errors are stable
+	sections := make([]string, 0, len(conf))
+	for section := range conf {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	reservationConfs = make(map[string]*PortReservationConf)
+	reservedBy := make(map[int]string)
+	for _, section := range sections {
+		name := strings.TrimSpace(section)
+		if name == "" {
+			continue
+		}
+		cfg := &PortReservationConf{}
+		if err = cfg.UnmarshalFromIni(name, conf[section]); err != nil {
+			return
+		}
+		for _, port := range cfg.Ports {
+			if other, ok := reservedBy[port]; ok {
+				err = fmt.Errorf("Parse port reservations conf error: port [%d] is reserved in both [%s] and [%s]", port, other, name)
+				return
+			}
+			reservedBy[port] = name
+		}
+		reservationConfs[name] = cfg
+	}
+	return
+}
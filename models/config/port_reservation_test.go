@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAllPortReservationConfFromIni(t *testing.T) {
+	assert := assert.New(t)
+
+	confs, err := LoadAllPortReservationConfFromIni(`
+[alice_db]
+user = alice
+ports = 6000-6002,6100
+
+[bob_mysql]
+proxy_name = bob.mysql
+ports = 3306
+`)
+	assert.NoError(err)
+	assert.Equal(map[string]*PortReservationConf{
+		"alice_db": {
+			Name:  "alice_db",
+			User:  "alice",
+			Ports: []int{6000, 6001, 6002, 6100},
+		},
+		"bob_mysql": {
+			Name:      "bob_mysql",
+			ProxyName: "bob.mysql",
+			Ports:     []int{3306},
+		},
+	}, confs)
+
+	testcases := []struct {
+		content string
+		err     string
+	}{
+		{"[a]\nuser = alice\nports = 6000-6010\n[b]\nuser = bob\nports = 6010\n",
+			"Parse port reservations conf error: port [6010] is reserved in both [a] and [b]"},
+		{"[a]\nuser = alice\nports = 6000,6000\n",
+			"Parse port reservations conf error: port [6000] is reserved in both [a] and [a]"},
+		{"[a]\nports = 6000\n",
+			"Parse port reservations conf error: [a] user or proxy_name is required"},
+		{"[a]\nuser = alice\n",
+			"Parse port reservations conf error: [a] ports is required"},
+		{"[a]\nuser = alice\nports = 70000\n",
+			"Parse port reservations conf error: [a] invalid port [70000]"},
+	}
+	for _, tc := range testcases {
+		_, err = LoadAllPortReservationConfFromIni(tc.content)
+		if assert.Error(err, tc.content) {
+			assert.Equal(tc.err, err.Error())
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/whysmx/frp/models/consts"
 	"github.com/whysmx/frp/models/msg"
@@ -57,6 +58,7 @@ type ProxyConf interface {
 	UnmarshalFromMsg(pMsg *msg.NewProxy)
 	UnmarshalFromIni(prefix string, name string, conf ini.Section) error
 	MarshalToMsg(pMsg *msg.NewProxy)
+	MarshalToIni(prefix string, section ini.Section)
 	CheckForCli() error
 	CheckForSvr() error
 	Compare(conf ProxyConf) bool
@@ -197,6 +199,22 @@ func (cfg *BaseProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	pMsg.GroupKey = cfg.GroupKey
 }
 
+func (cfg *BaseProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	section["type"] = cfg.ProxyType
+	setIniBool(section, "use_encryption", cfg.UseEncryption)
+	setIniBool(section, "use_compression", cfg.UseCompression)
+	setIniString(section, "group", cfg.Group)
+	setIniString(section, "group_key", cfg.GroupKey)
+	setIniString(section, "proxy_protocol_version", cfg.ProxyProtocolVersion)
+
+	cfg.LocalSvrConf.MarshalToIni(prefix, section)
+	cfg.HealthCheckConf.MarshalToIni(prefix, section)
+	// health_check_url is prefixed with local address when loaded
+	if url, ok := section["health_check_url"]; ok && cfg.Plugin == "" {
+		section["health_check_url"] = strings.TrimPrefix(url, fmt.Sprintf("http://%s:%d", cfg.LocalIp, cfg.LocalPort))
+	}
+}
+
 func (cfg *BaseProxyConf) checkForCli() (err error) {
 	if cfg.ProxyProtocolVersion != "" {
 		if cfg.ProxyProtocolVersion != "v1" && cfg.ProxyProtocolVersion != "v2" {
@@ -251,6 +269,10 @@ func (cfg *BindInfoConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	pMsg.RemotePort = cfg.RemotePort
 }
 
+func (cfg *BindInfoConf) MarshalToIni(prefix string, section ini.Section) {
+	section["remote_port"] = strconv.Itoa(cfg.RemotePort)
+}
+
 // Domain info
 type DomainConf struct {
 	CustomDomains []string `json:"custom_domains"`
@@ -293,6 +315,11 @@ func (cfg *DomainConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	pMsg.SubDomain = cfg.SubDomain
 }
 
+func (cfg *DomainConf) MarshalToIni(prefix string, section ini.Section) {
+	setIniString(section, "custom_domains", strings.Join(cfg.CustomDomains, ","))
+	setIniString(section, "subdomain", cfg.SubDomain)
+}
+
 func (cfg *DomainConf) check() (err error) {
 	if len(cfg.CustomDomains) == 0 && cfg.SubDomain == "" {
 		err = fmt.Errorf("custom_domains and subdomain should set at least one of them")
@@ -313,6 +340,7 @@ func (cfg *DomainConf) checkForSvr() (err error) {
 		return
 	}
 
+	subDomainHost := getSubDomainHost()
 	for _, domain := range cfg.CustomDomains {
 		if subDomainHost != "" && len(strings.Split(subDomainHost, ".")) < len(strings.Split(domain, ".")) {
 			if strings.Contains(domain, subDomainHost) {
@@ -385,6 +413,18 @@ func (cfg *LocalSvrConf) UnmarshalFromIni(prefix string, name string, section in
 	return
 }
 
+func (cfg *LocalSvrConf) MarshalToIni(prefix string, section ini.Section) {
+	if cfg.Plugin != "" {
+		section["plugin"] = cfg.Plugin
+		for k, v := range cfg.PluginParams {
+			section[k] = v
+		}
+	} else {
+		setIniString(section, "local_ip", cfg.LocalIp)
+		section["local_port"] = strconv.Itoa(cfg.LocalPort)
+	}
+}
+
 func (cfg *LocalSvrConf) checkForCli() (err error) {
 	if cfg.Plugin == "" {
 		if cfg.LocalIp == "" {
@@ -446,6 +486,14 @@ func (cfg *HealthCheckConf) UnmarshalFromIni(prefix string, name string, section
 	return
 }
 
+func (cfg *HealthCheckConf) MarshalToIni(prefix string, section ini.Section) {
+	setIniString(section, "health_check_type", cfg.HealthCheckType)
+	setIniInt(section, "health_check_timeout_s", cfg.HealthCheckTimeoutS)
+	setIniInt(section, "health_check_max_failed", cfg.HealthCheckMaxFailed)
+	setIniInt(section, "health_check_interval_s", cfg.HealthCheckIntervalS)
+	setIniString(section, "health_check_url", cfg.HealthCheckUrl)
+}
+
 func (cfg *HealthCheckConf) checkForCli() error {
 	if cfg.HealthCheckType != "" && cfg.HealthCheckType != "tcp" && cfg.HealthCheckType != "http" {
 		return fmt.Errorf("unsupport health check type")
@@ -497,6 +545,11 @@ func (cfg *TcpProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	cfg.BindInfoConf.MarshalToMsg(pMsg)
 }
 
+func (cfg *TcpProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	cfg.BindInfoConf.MarshalToIni(prefix, section)
+}
+
 func (cfg *TcpProxyConf) CheckForCli() (err error) {
 	if err = cfg.BaseProxyConf.checkForCli(); err != nil {
 		return err
@@ -545,6 +598,11 @@ func (cfg *UdpProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	cfg.BindInfoConf.MarshalToMsg(pMsg)
 }
 
+func (cfg *UdpProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	cfg.BindInfoConf.MarshalToIni(prefix, section)
+}
+
 func (cfg *UdpProxyConf) CheckForCli() (err error) {
 	if err = cfg.BaseProxyConf.checkForCli(); err != nil {
 		return
@@ -647,6 +705,19 @@ func (cfg *HttpProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	pMsg.Headers = cfg.Headers
 }
 
+func (cfg *HttpProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	cfg.DomainConf.MarshalToIni(prefix, section)
+
+	setIniString(section, "locations", strings.Join(cfg.Locations, ","))
+	setIniString(section, "host_header_rewrite", cfg.HostHeaderRewrite)
+	setIniString(section, "http_user", cfg.HttpUser)
+	setIniString(section, "http_pwd", cfg.HttpPwd)
+	for k, v := range cfg.Headers {
+		section["header_"+k] = v
+	}
+}
+
 func (cfg *HttpProxyConf) CheckForCli() (err error) {
 	if err = cfg.BaseProxyConf.checkForCli(); err != nil {
 		return
@@ -707,6 +778,11 @@ func (cfg *HttpsProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	cfg.DomainConf.MarshalToMsg(pMsg)
 }
 
+func (cfg *HttpsProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	cfg.DomainConf.MarshalToIni(prefix, section)
+}
+
 func (cfg *HttpsProxyConf) CheckForCli() (err error) {
 	if err = cfg.BaseProxyConf.checkForCli(); err != nil {
 		return
@@ -734,6 +810,13 @@ type StcpProxyConf struct {
 
 	Role string `json:"role"`
 	Sk   string `json:"sk"`
+
+	// Secret keys accepted besides Sk, used to rotate keys.
+	Sks []msg.SecretKey `json:"sks"`
+
+	// Users allowed to visit this proxy besides its owner, empty means all
+	// users and "*" also means all users.
+	AllowUsers []string `json:"allow_users"`
 }
 
 func (cfg *StcpProxyConf) Compare(cmp ProxyConf) bool {
@@ -744,7 +827,9 @@ func (cfg *StcpProxyConf) Compare(cmp ProxyConf) bool {
 
 	if !cfg.BaseProxyConf.compare(&cmpConf.BaseProxyConf) ||
 		cfg.Role != cmpConf.Role ||
-		cfg.Sk != cmpConf.Sk {
+		cfg.Sk != cmpConf.Sk ||
+		!reflect.DeepEqual(cfg.Sks, cmpConf.Sks) ||
+		strings.Join(cfg.AllowUsers, " ") != strings.Join(cmpConf.AllowUsers, " ") {
 		return false
 	}
 	return true
@@ -754,6 +839,8 @@ func (cfg *StcpProxyConf) Compare(cmp ProxyConf) bool {
 func (cfg *StcpProxyConf) UnmarshalFromMsg(pMsg *msg.NewProxy) {
 	cfg.BaseProxyConf.UnmarshalFromMsg(pMsg)
 	cfg.Sk = pMsg.Sk
+	cfg.Sks = pMsg.Sks
+	cfg.AllowUsers = pMsg.AllowUsers
 }
 
 func (cfg *StcpProxyConf) UnmarshalFromIni(prefix string, name string, section ini.Section) (err error) {
@@ -768,6 +855,17 @@ func (cfg *StcpProxyConf) UnmarshalFromIni(prefix string, name string, section i
 
 	cfg.Sk = section["sk"]
 
+	// e.g. newkey,oldkey@2019-06-01
+	if tmpStr, ok := section["sks"]; ok {
+		if cfg.Sks, err = parseSecretKeys(tmpStr); err != nil {
+			return fmt.Errorf("Parse conf error: proxy [%s] sks error, %v", name, err)
+		}
+	}
+
+	if tmpStr, ok := section["allow_users"]; ok {
+		cfg.AllowUsers = splitAndTrim(tmpStr)
+	}
+
 	if err = cfg.LocalSvrConf.UnmarshalFromIni(prefix, name, section); err != nil {
 		return
 	}
@@ -777,6 +875,16 @@ func (cfg *StcpProxyConf) UnmarshalFromIni(prefix string, name string, section i
 func (cfg *StcpProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	cfg.BaseProxyConf.MarshalToMsg(pMsg)
 	pMsg.Sk = cfg.Sk
+	pMsg.Sks = cfg.Sks
+	pMsg.AllowUsers = cfg.AllowUsers
+}
+
+func (cfg *StcpProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	section["role"] = "server"
+	setIniString(section, "sk", cfg.Sk)
+	setIniString(section, "sks", formatSecretKeys(cfg.Sks))
+	setIniString(section, "allow_users", strings.Join(cfg.AllowUsers, ","))
 }
 
 func (cfg *StcpProxyConf) CheckForCli() (err error) {
@@ -800,6 +908,13 @@ type XtcpProxyConf struct {
 
 	Role string `json:"role"`
 	Sk   string `json:"sk"`
+
+	// Secret keys accepted besides Sk, used to rotate keys.
+	Sks []msg.SecretKey `json:"sks"`
+
+	// Users allowed to visit this proxy besides its owner, empty means all
+	// users and "*" also means all users.
+	AllowUsers []string `json:"allow_users"`
 }
 
 func (cfg *XtcpProxyConf) Compare(cmp ProxyConf) bool {
@@ -811,7 +926,9 @@ func (cfg *XtcpProxyConf) Compare(cmp ProxyConf) bool {
 	if !cfg.BaseProxyConf.compare(&cmpConf.BaseProxyConf) ||
 		!cfg.LocalSvrConf.compare(&cmpConf.LocalSvrConf) ||
 		cfg.Role != cmpConf.Role ||
-		cfg.Sk != cmpConf.Sk {
+		cfg.Sk != cmpConf.Sk ||
+		!reflect.DeepEqual(cfg.Sks, cmpConf.Sks) ||
+		strings.Join(cfg.AllowUsers, " ") != strings.Join(cmpConf.AllowUsers, " ") {
 		return false
 	}
 	return true
@@ -821,6 +938,8 @@ func (cfg *XtcpProxyConf) Compare(cmp ProxyConf) bool {
 func (cfg *XtcpProxyConf) UnmarshalFromMsg(pMsg *msg.NewProxy) {
 	cfg.BaseProxyConf.UnmarshalFromMsg(pMsg)
 	cfg.Sk = pMsg.Sk
+	cfg.Sks = pMsg.Sks
+	cfg.AllowUsers = pMsg.AllowUsers
 }
 
 func (cfg *XtcpProxyConf) UnmarshalFromIni(prefix string, name string, section ini.Section) (err error) {
@@ -835,6 +954,17 @@ func (cfg *XtcpProxyConf) UnmarshalFromIni(prefix string, name string, section i
 
 	cfg.Sk = section["sk"]
 
+	// e.g. newkey,oldkey@2019-06-01
+	if tmpStr, ok := section["sks"]; ok {
+		if cfg.Sks, err = parseSecretKeys(tmpStr); err != nil {
+			return fmt.Errorf("Parse conf error: proxy [%s] sks error, %v", name, err)
+		}
+	}
+
+	if tmpStr, ok := section["allow_users"]; ok {
+		cfg.AllowUsers = splitAndTrim(tmpStr)
+	}
+
 	if err = cfg.LocalSvrConf.UnmarshalFromIni(prefix, name, section); err != nil {
 		return
 	}
@@ -844,6 +974,16 @@ func (cfg *XtcpProxyConf) UnmarshalFromIni(prefix string, name string, section i
 func (cfg *XtcpProxyConf) MarshalToMsg(pMsg *msg.NewProxy) {
 	cfg.BaseProxyConf.MarshalToMsg(pMsg)
 	pMsg.Sk = cfg.Sk
+	pMsg.Sks = cfg.Sks
+	pMsg.AllowUsers = cfg.AllowUsers
+}
+
+func (cfg *XtcpProxyConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseProxyConf.MarshalToIni(prefix, section)
+	section["role"] = "server"
+	setIniString(section, "sk", cfg.Sk)
+	setIniString(section, "sks", formatSecretKeys(cfg.Sks))
+	setIniString(section, "allow_users", strings.Join(cfg.AllowUsers, ","))
 }
 
 func (cfg *XtcpProxyConf) CheckForCli() (err error) {
@@ -861,6 +1001,69 @@ func (cfg *XtcpProxyConf) CheckForSvr() (err error) {
 	return
 }
 
+// parseSecretKeys parses secret keys separated by commas, each key can be
+// followed by '@' and its expire time. A key is kept as it is if the part
+// after its last '@' is not a time, so keys can contain '@'.
+func parseSecretKeys(s string) (sks []msg.SecretKey, err error) {
+	sks = make([]msg.SecretKey, 0)
+	for _, v := range splitAndTrim(s) {
+		sk := msg.SecretKey{Sk: v}
+		if i := strings.LastIndex(v, "@"); i >= 0 {
+			if expireTime, errRet := parseUserExpireTime(v[i+1:]); errRet == nil {
+				sk.Sk = strings.TrimSpace(v[:i])
+				sk.ExpireTime = expireTime.Unix()
+			}
+		}
+		if sk.Sk == "" {
+			return nil, fmt.Errorf("secret key shouldn't be empty")
+		}
+		sks = append(sks, sk)
+	}
+	return
+}
+
+// formatSecretKeys is the reverse of parseSecretKeys.
+func formatSecretKeys(sks []msg.SecretKey) string {
+	strs := make([]string, 0, len(sks))
+	for _, sk := range sks {
+		if sk.ExpireTime == 0 {
+			strs = append(strs, sk.Sk)
+		} else {
+			strs = append(strs, sk.Sk+"@"+time.Unix(sk.ExpireTime, 0).Format("2006-01-02 15:04:05"))
+		}
+	}
+	return strings.Join(strs, ",")
+}
+
+// GetValidSks returns sk and all keys in sks not expired at now. Empty sk is
+// only valid if there are no other keys.
+func GetValidSks(sk string, sks []msg.SecretKey, now time.Time) []string {
+	res := make([]string, 0, len(sks)+1)
+	if sk != "" || len(sks) == 0 {
+		res = append(res, sk)
+	}
+	for _, v := range sks {
+		if v.ExpireTime == 0 || now.Unix() <= v.ExpireTime {
+			res = append(res, v.Sk)
+		}
+	}
+	return res
+}
+
+// IsVisitorUserAllowed returns true if user is in allowUsers of a stcp or
+// xtcp proxy. Empty allowUsers means all users are allowed.
+func IsVisitorUserAllowed(allowUsers []string, user string) bool {
+	if len(allowUsers) == 0 {
+		return true
+	}
+	for _, u := range allowUsers {
+		if u == "*" || u == user {
+			return true
+		}
+	}
+	return false
+}
+
 func ParseRangeSection(name string, section ini.Section) (sections map[string]ini.Section, err error) {
 	localPorts, errRet := util.ParseRangeNumbers(section["local_port"])
 	if errRet != nil {
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/models/msg"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecretKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	expireTime := time.Date(2019, 6, 1, 0, 0, 0, 0, time.Local).Unix()
+	sks, err := parseSecretKeys("newkey, old@key@2019-06-01 ,mail@example.com,a@b@")
+	if assert.NoError(err) {
+		assert.Equal([]msg.SecretKey{
+			{Sk: "newkey"},
+			{Sk: "old@key", ExpireTime: expireTime},
+			{Sk: "mail@example.com"},
+			{Sk: "a@b@"},
+		}, sks)
+	}
+	assert.Equal("newkey,old@key@2019-06-01 00:00:00,mail@example.com,a@b@", formatSecretKeys(sks))
+
+	sks, err = parseSecretKeys("")
+	assert.NoError(err)
+	assert.Empty(sks)
+
+	_, err = parseSecretKeys("@2019-06-01")
+	assert.Error(err)
+}
+
+func TestGetValidSks(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	sks := []msg.SecretKey{
+		{Sk: "new"},
+		{Sk: "expired", ExpireTime: now.Unix() - 1},
+		{Sk: "old", ExpireTime: now.Unix() + 1},
+	}
+	assert.Equal([]string{"sk", "new", "old"}, GetValidSks("sk", sks, now))
+	assert.Equal([]string{"new", "old"}, GetValidSks("", sks, now))
+	assert.Equal([]string{}, GetValidSks("", sks[1:2], now))
+	assert.Equal([]string{"sk"}, GetValidSks("sk", nil, now))
+
+	// empty sk is still valid if it's the only one
+	assert.Equal([]string{""}, GetValidSks("", nil, now))
+}
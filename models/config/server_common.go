@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	ini "github.com/vaughan0/go-ini"
 
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/webhook"
 	"github.com/whysmx/frp/utils/util"
 )
 
@@ -30,13 +33,25 @@ var (
 	subDomainHost  string
 	vhostHttpPort  int
 	vhostHttpsPort int
+
+	// subdomain_host can be changed by reloading frps conf
+	subDomainHostMu sync.RWMutex
 )
 
 func InitServerCfg(cfg *ServerCommonConf) {
 	proxyBindAddr = cfg.ProxyBindAddr
-	subDomainHost = cfg.SubDomainHost
 	vhostHttpPort = cfg.VhostHttpPort
 	vhostHttpsPort = cfg.VhostHttpsPort
+
+	subDomainHostMu.Lock()
+	subDomainHost = cfg.SubDomainHost
+	subDomainHostMu.Unlock()
+}
+
+func getSubDomainHost() string {
+	subDomainHostMu.RLock()
+	defer subDomainHostMu.RUnlock()
+	return subDomainHost
 }
 
 // common config
@@ -66,46 +81,141 @@ type ServerCommonConf struct {
 	LogWay        string `json:"log_way"` // console or file
 	LogLevel      string `json:"log_level"`
 	LogMaxDays    int64  `json:"log_max_days"`
-	Token         string `json:"token"`
+
+	// If EnablePrometheus is true, metrics in Prometheus text format are
+	// exposed at /metrics of dashboard.
+	EnablePrometheus bool `json:"enable_prometheus"`
+
+	// If StatsFile is not empty, traffic statistics are saved to it every
+	// StatsFlushInterval seconds and loaded at startup.
+	StatsFile          string `json:"stats_file"`
+	StatsFlushInterval int64  `json:"stats_flush_interval"`
+	// days of traffic statistics reserved
+	StatsReserveDays int64 `json:"stats_reserve_days"`
+
+	// If AuditLogFile is not empty, control-plane events are appended to it
+	// as JSON lines.
+	AuditLogFile string `json:"audit_log_file"`
+
+	// If AccessLogFile is not empty, every user connection of proxies is
+	// appended to it as JSON lines.
+	AccessLogFile string `json:"access_log_file"`
+
+	Token string `json:"token"`
+
+	// If UsersFile is not empty, each client authenticates with the token of
+	// its user in this file instead of Token.
+	UsersFile     string `json:"users_file"`
 	SubDomainHost string `json:"subdomain_host"`
 	TcpMux        bool   `json:"tcp_mux"`
 	Custom404Page string `json:"custom_404_page"`
 
+	// If PortReservationsFile is not empty, ports in this file are reserved
+	// for users or proxies.
+	PortReservationsFile string `json:"port_reservations_file"`
+
+	// Certificate of frps used in TLS connections, a self-signed certificate
+	// is generated if not set.
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+
+	// If TLSTrustedCaFile is not empty, frpc must connect with TLS and
+	// present a certificate signed by this CA.
+	TLSTrustedCaFile string `json:"tls_trusted_ca_file"`
+
+	// If AuthenticateHeartBeats is true, Ping messages must carry a privilege
+	// key derived from the token of the client.
+	AuthenticateHeartBeats bool `json:"authenticate_heartbeats"`
+
+	// If AuthenticateNewWorkConns is true, NewWorkConn messages must carry a
+	// privilege key derived from the token of the client.
+	AuthenticateNewWorkConns bool `json:"authenticate_new_work_conns"`
+
+	// AuthMaxClockSkew is the max difference in seconds between the timestamp
+	// of privilege keys from frpc and frps, 0 means timestamps are not checked.
+	AuthMaxClockSkew int64 `json:"auth_max_clock_skew"`
+
+	// VisitorMaxClockSkew is the max difference in seconds between the
+	// timestamp of a visitor and frps, 0 means timestamps are not checked.
+	VisitorMaxClockSkew int64 `json:"visitor_max_clock_skew"`
+
+	// VisitorReplayCacheSize is the number of visitor signatures remembered
+	// to reject replayed ones, 0 means replays are not checked. It requires
+	// VisitorMaxClockSkew, otherwise a signature dropped from the cache could
+	// be replayed.
+	VisitorReplayCacheSize int64 `json:"visitor_replay_cache_size"`
+
+	// MinAuthScheme is the weakest auth scheme accepted from frpc and
+	// visitors, "md5" or "hmac_sha256".
+	MinAuthScheme string `json:"min_auth_scheme"`
+
 	AllowPorts        map[int]struct{}
 	MaxPoolCount      int64 `json:"max_pool_count"`
 	MaxPortsPerClient int64 `json:"max_ports_per_client"`
 	HeartBeatTimeout  int64 `json:"heart_beat_timeout"`
 	UserConnTimeout   int64 `json:"user_conn_timeout"`
+
+	// DrainTimeout is the max seconds frps waits for work connections in use
+	// to be closed when draining.
+	DrainTimeout int64 `json:"drain_timeout"`
+
+	// HTTPPlugins are loaded from sections named "plugin.{name}", frps will
+	// send requests to them before some operations are accepted.
+	HTTPPlugins map[string]plugin.HTTPPluginOptions `json:"http_plugins"`
+
+	// Webhooks are loaded from sections named "webhook.{name}", frps will
+	// post lifecycle events of clients and proxies to them.
+	Webhooks map[string]webhook.Options `json:"webhooks"`
 }
 
 func GetDefaultServerConf() *ServerCommonConf {
 	return &ServerCommonConf{
-		BindAddr:          "0.0.0.0",
-		BindPort:          7000,
-		BindUdpPort:       0,
-		KcpBindPort:       0,
-		ProxyBindAddr:     "0.0.0.0",
-		VhostHttpPort:     0,
-		VhostHttpsPort:    0,
-		VhostHttpTimeout:  60,
-		DashboardAddr:     "0.0.0.0",
-		DashboardPort:     0,
-		DashboardUser:     "admin",
-		DashboardPwd:      "admin",
-		AssetsDir:         "",
-		LogFile:           "console",
-		LogWay:            "console",
-		LogLevel:          "info",
-		LogMaxDays:        3,
-		Token:             "",
-		SubDomainHost:     "",
-		TcpMux:            true,
-		AllowPorts:        make(map[int]struct{}),
-		MaxPoolCount:      5,
-		MaxPortsPerClient: 0,
-		HeartBeatTimeout:  90,
-		UserConnTimeout:   10,
-		Custom404Page:     "",
+		BindAddr:                 "0.0.0.0",
+		BindPort:                 7000,
+		BindUdpPort:              0,
+		KcpBindPort:              0,
+		ProxyBindAddr:            "0.0.0.0",
+		VhostHttpPort:            0,
+		VhostHttpsPort:           0,
+		VhostHttpTimeout:         60,
+		DashboardAddr:            "0.0.0.0",
+		DashboardPort:            0,
+		DashboardUser:            "admin",
+		DashboardPwd:             "admin",
+		EnablePrometheus:         false,
+		StatsFile:                "",
+		StatsFlushInterval:       60,
+		StatsReserveDays:         7,
+		AssetsDir:                "",
+		LogFile:                  "console",
+		LogWay:                   "console",
+		LogLevel:                 "info",
+		LogMaxDays:               3,
+		AuditLogFile:             "",
+		AccessLogFile:            "",
+		Token:                    "",
+		UsersFile:                "",
+		PortReservationsFile:     "",
+		SubDomainHost:            "",
+		TcpMux:                   true,
+		AllowPorts:               make(map[int]struct{}),
+		MaxPoolCount:             5,
+		MaxPortsPerClient:        0,
+		HeartBeatTimeout:         90,
+		UserConnTimeout:          10,
+		DrainTimeout:             60,
+		Custom404Page:            "",
+		TLSCertFile:              "",
+		TLSKeyFile:               "",
+		TLSTrustedCaFile:         "",
+		AuthenticateHeartBeats:   false,
+		AuthenticateNewWorkConns: false,
+		AuthMaxClockSkew:         900,
+		VisitorMaxClockSkew:      300,
+		VisitorReplayCacheSize:   10000,
+		MinAuthScheme:            util.AuthSchemeMd5,
+		HTTPPlugins:              make(map[string]plugin.HTTPPluginOptions),
+		Webhooks:                 make(map[string]webhook.Options),
 	}
 }
 
@@ -220,6 +330,34 @@ func UnmarshalServerConfFromIni(defaultCfg *ServerCommonConf, content string) (c
 		cfg.DashboardPwd = tmpStr
 	}
 
+	if tmpStr, ok = conf.Get("common", "enable_prometheus"); ok && tmpStr == "true" {
+		cfg.EnablePrometheus = true
+	} else {
+		cfg.EnablePrometheus = false
+	}
+
+	if tmpStr, ok = conf.Get("common", "stats_file"); ok {
+		cfg.StatsFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "stats_flush_interval"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v <= 0 {
+			err = fmt.Errorf("Parse conf error: invalid stats_flush_interval")
+			return
+		} else {
+			cfg.StatsFlushInterval = v
+		}
+	}
+
+	if tmpStr, ok = conf.Get("common", "stats_reserve_days"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v <= 0 {
+			err = fmt.Errorf("Parse conf error: invalid stats_reserve_days")
+			return
+		} else {
+			cfg.StatsReserveDays = v
+		}
+	}
+
 	if tmpStr, ok = conf.Get("common", "assets_dir"); ok {
 		cfg.AssetsDir = tmpStr
 	}
@@ -244,8 +382,24 @@ func UnmarshalServerConfFromIni(defaultCfg *ServerCommonConf, content string) (c
 		}
 	}
 
+	if tmpStr, ok = conf.Get("common", "audit_log_file"); ok {
+		cfg.AuditLogFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "access_log_file"); ok {
+		cfg.AccessLogFile = tmpStr
+	}
+
 	cfg.Token, _ = conf.Get("common", "token")
 
+	if tmpStr, ok = conf.Get("common", "users_file"); ok {
+		cfg.UsersFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "port_reservations_file"); ok {
+		cfg.PortReservationsFile = tmpStr
+	}
+
 	if allowPortsStr, ok := conf.Get("common", "allow_ports"); ok {
 		// e.g. 1000-2000,2001,2002,3000-4000
 		ports, errRet := util.ParseRangeNumbers(allowPortsStr)
@@ -299,6 +453,67 @@ func UnmarshalServerConfFromIni(defaultCfg *ServerCommonConf, content string) (c
 		cfg.Custom404Page = tmpStr
 	}
 
+	if tmpStr, ok = conf.Get("common", "tls_cert_file"); ok {
+		cfg.TLSCertFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "tls_key_file"); ok {
+		cfg.TLSKeyFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "tls_trusted_ca_file"); ok {
+		cfg.TLSTrustedCaFile = tmpStr
+	}
+
+	if tmpStr, ok = conf.Get("common", "authenticate_heartbeats"); ok && tmpStr == "true" {
+		cfg.AuthenticateHeartBeats = true
+	} else {
+		cfg.AuthenticateHeartBeats = false
+	}
+
+	if tmpStr, ok = conf.Get("common", "authenticate_new_work_conns"); ok && tmpStr == "true" {
+		cfg.AuthenticateNewWorkConns = true
+	} else {
+		cfg.AuthenticateNewWorkConns = false
+	}
+
+	if tmpStr, ok = conf.Get("common", "auth_max_clock_skew"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v < 0 {
+			err = fmt.Errorf("Parse conf error: invalid auth_max_clock_skew")
+			return
+		}
+		cfg.AuthMaxClockSkew = v
+	}
+
+	if tmpStr, ok = conf.Get("common", "visitor_max_clock_skew"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v < 0 {
+			err = fmt.Errorf("Parse conf error: invalid visitor_max_clock_skew")
+			return
+		}
+		cfg.VisitorMaxClockSkew = v
+	}
+
+	if tmpStr, ok = conf.Get("common", "visitor_replay_cache_size"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v < 0 {
+			err = fmt.Errorf("Parse conf error: invalid visitor_replay_cache_size")
+			return
+		}
+		cfg.VisitorReplayCacheSize = v
+	}
+
+	if cfg.VisitorReplayCacheSize > 0 && cfg.VisitorMaxClockSkew == 0 {
+		err = fmt.Errorf("Parse conf error: visitor_max_clock_skew must be greater than 0 if visitor_replay_cache_size is set")
+		return
+	}
+
+	if tmpStr, ok = conf.Get("common", "min_auth_scheme"); ok {
+		if !util.IsValidAuthScheme(tmpStr) {
+			err = fmt.Errorf("Parse conf error: invalid min_auth_scheme")
+			return
+		}
+		cfg.MinAuthScheme = tmpStr
+	}
+
 	if tmpStr, ok = conf.Get("common", "heartbeat_timeout"); ok {
 		v, errRet := strconv.ParseInt(tmpStr, 10, 64)
 		if errRet != nil {
@@ -308,9 +523,114 @@ func UnmarshalServerConfFromIni(defaultCfg *ServerCommonConf, content string) (c
 			cfg.HeartBeatTimeout = v
 		}
 	}
+
+	if tmpStr, ok = conf.Get("common", "drain_timeout"); ok {
+		if v, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || v < 0 {
+			err = fmt.Errorf("Parse conf error: invalid drain_timeout")
+			return
+		} else {
+			cfg.DrainTimeout = v
+		}
+	}
+
+	if err = loadHTTPPluginsFromIni(cfg, conf); err != nil {
+		return
+	}
+
+	if err = loadWebhooksFromIni(cfg, conf); err != nil {
+		return
+	}
+	return
+}
+
+// loadHTTPPluginsFromIni loads all sections like:
+// [plugin.user-manager]
+// addr = 127.0.0.1:9000
+// path = /handler
+// ops = Login,NewProxy
+func loadHTTPPluginsFromIni(cfg *ServerCommonConf, conf ini.File) (err error) {
+	for name, section := range conf {
+		if !strings.HasPrefix(name, "plugin.") {
+			continue
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(name, "plugin."))
+		options := plugin.HTTPPluginOptions{
+			Name: name,
+			Addr: section["addr"],
+			Path: section["path"],
+			Ops:  make([]string, 0),
+		}
+		if options.Addr == "" {
+			return fmt.Errorf("Parse conf error: plugin [%s] addr shouldn't be empty", name)
+		}
+		if options.Path == "" {
+			return fmt.Errorf("Parse conf error: plugin [%s] path shouldn't be empty", name)
+		}
+		for _, op := range strings.Split(section["ops"], ",") {
+			op = strings.TrimSpace(op)
+			if op == "" {
+				continue
+			}
+			switch op {
+			case plugin.OpLogin, plugin.OpNewProxy, plugin.OpNewWorkConn, plugin.OpNewUserConn:
+				options.Ops = append(options.Ops, op)
+			default:
+				return fmt.Errorf("Parse conf error: plugin [%s] unsupported op [%s]", name, op)
+			}
+		}
+		cfg.HTTPPlugins[name] = options
+	}
+	return
+}
+
+func loadWebhooksFromIni(cfg *ServerCommonConf, conf ini.File) (err error) {
+	for name, section := range conf {
+		if !strings.HasPrefix(name, "webhook.") {
+			continue
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(name, "webhook."))
+		options := webhook.Options{
+			Name:       name,
+			Url:        section["url"],
+			Events:     make([]string, 0),
+			MaxRetries: 3,
+			QueueSize:  1000,
+		}
+		if !strings.HasPrefix(options.Url, "http://") && !strings.HasPrefix(options.Url, "https://") {
+			return fmt.Errorf("Parse conf error: webhook [%s] url should start with http:// or https://", name)
+		}
+		for _, event := range splitAndTrim(section["events"]) {
+			supported := false
+			for _, e := range webhook.AllEvents {
+				if event == e {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				return fmt.Errorf("Parse conf error: webhook [%s] unsupported event [%s]", name, event)
+			}
+			options.Events = append(options.Events, event)
+		}
+		if tmpStr, ok := section["max_retries"]; ok {
+			if options.MaxRetries, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || options.MaxRetries < 0 {
+				return fmt.Errorf("Parse conf error: webhook [%s] invalid max_retries", name)
+			}
+		}
+		if tmpStr, ok := section["queue_size"]; ok {
+			if options.QueueSize, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || options.QueueSize <= 0 {
+				return fmt.Errorf("Parse conf error: webhook [%s] invalid queue_size", name)
+			}
+		}
+		cfg.Webhooks[name] = options
+	}
 	return
 }
 
 func (cfg *ServerCommonConf) Check() (err error) {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		err = fmt.Errorf("Parse conf error: tls_cert_file and tls_key_file must be specified together")
+		return
+	}
 	return
 }
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalServerConfVisitorReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := UnmarshalServerConfFromIni(GetDefaultServerConf(), "[common]\n")
+	if assert.NoError(err) {
+		assert.EqualValues(300, cfg.VisitorMaxClockSkew)
+		assert.EqualValues(10000, cfg.VisitorReplayCacheSize)
+	}
+
+	cfg, err = UnmarshalServerConfFromIni(GetDefaultServerConf(), "[common]\nvisitor_max_clock_skew = 0\nvisitor_replay_cache_size = 0\n")
+	if assert.NoError(err) {
+		assert.EqualValues(0, cfg.VisitorMaxClockSkew)
+		assert.EqualValues(0, cfg.VisitorReplayCacheSize)
+	}
+
+	_, err = UnmarshalServerConfFromIni(GetDefaultServerConf(), "[common]\nvisitor_max_clock_skew = 0\n")
+	assert.Error(err)
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sites are stored as comment lines between these two lines in frpc config
+// file, so they are ignored when proxies and visitors are loaded.
+const (
+	SiteRegistryStart = "# DEVICE_REGISTRY_START"
+	SiteRegistryEnd   = "# DEVICE_REGISTRY_END"
+)
+
+// SiteConf is one line in the site registry: "# MAC|code|name|password|tags".
+// Visitors of a site are the stcp visitors whose sk is the MAC.
+type SiteConf struct {
+	Mac      string   `json:"mac"`
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Password string   `json:"password"`
+	Tags     []string `json:"tags"`
+}
+
+func (cfg *SiteConf) String() string {
+	return strings.Join([]string{cfg.Mac, cfg.Code, cfg.Name, cfg.Password, strings.Join(cfg.Tags, ",")}, "|")
+}
+
+func (cfg *SiteConf) Check() error {
+	if cfg.Mac == "" {
+		return fmt.Errorf("site mac shouldn't be empty")
+	}
+	for _, v := range []string{cfg.Mac, cfg.Code, cfg.Name, cfg.Password} {
+		if strings.ContainsAny(v, "|\r\n") {
+			return fmt.Errorf("site [%s] fields shouldn't contain '|' or line breaks", cfg.Mac)
+		}
+	}
+	if strings.ContainsAny(cfg.Mac, "[]= ") {
+		return fmt.Errorf("site [%s] mac is invalid", cfg.Mac)
+	}
+	for _, tag := range cfg.Tags {
+		if tag == "" || strings.ContainsAny(tag, ",|\r\n") {
+			return fmt.Errorf("site [%s] tag [%s] is invalid", cfg.Mac, tag)
+		}
+	}
+	return nil
+}
+
+// HasAnyTag returns true if the site has one of tags.
+func (cfg *SiteConf) HasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range cfg.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VisitorName returns name of the visitor section generated for port of this
+// site, it's also used as server_name of the visitor.
+func (cfg *SiteConf) VisitorName(port int) string {
+	return fmt.Sprintf("R-%s-%d", cfg.Mac, port)
+}
+
+// parseSiteLine returns nil if line is not a site, e.g. notes in the registry.
+func parseSiteLine(line string) *SiteConf {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") || !strings.Contains(line, "|") {
+		return nil
+	}
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), "|", 5)
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+	cfg := &SiteConf{
+		Mac:      strings.TrimSpace(fields[0]),
+		Code:     strings.TrimSpace(fields[1]),
+		Name:     strings.TrimSpace(fields[2]),
+		Password: strings.TrimSpace(fields[3]),
+		Tags:     splitAndTrim(fields[4]),
+	}
+	if cfg.Mac == "" {
+		return nil
+	}
+	return cfg
+}
+
+// findSiteRegistry returns indexes of the start and end lines of the registry,
+// start is -1 if there is no registry.
+func findSiteRegistry(lines []string) (start int, end int, err error) {
+	start, end = -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case SiteRegistryStart:
+			if start < 0 {
+				start = i
+			}
+		case SiteRegistryEnd:
+			if start >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	if start >= 0 && end < 0 {
+		err = fmt.Errorf("Parse conf error: %s not found", SiteRegistryEnd)
+	}
+	return
+}
+
+// LoadAllSiteConfFromIni returns sites in the registry of frpc config file in
+// the order they are written, the first one is kept if a MAC is duplicated.
+func LoadAllSiteConfFromIni(content string) (siteConfs []*SiteConf, err error) {
+	lines := strings.Split(content, "\n")
+	start, end, err := findSiteRegistry(lines)
+	if err != nil {
+		return
+	}
+
+	siteConfs = make([]*SiteConf, 0)
+	if start < 0 {
+		return
+	}
+	macs := make(map[string]struct{})
+	for _, line := range lines[start+1 : end] {
+		cfg := parseSiteLine(line)
+		if cfg == nil {
+			continue
+		}
+		if _, ok := macs[cfg.Mac]; ok {
+			continue
+		}
+		macs[cfg.Mac] = struct{}{}
+		siteConfs = append(siteConfs, cfg)
+	}
+	return
+}
+
+// SetSiteInIni replaces the line of the site with the same MAC in registry,
+// or adds it to the end of registry. The registry is added after [common] if
+// it doesn't exist.
+func SetSiteInIni(content string, cfg *SiteConf) (string, error) {
+	lines := strings.Split(content, "\n")
+	start, end, err := findSiteRegistry(lines)
+	if err != nil {
+		return content, err
+	}
+
+	siteLine := "# " + cfg.String()
+	if start < 0 {
+		pos := 0
+		if _, commonEnd := findIniSection(lines, "common"); commonEnd >= 0 {
+			pos = commonEnd
+		}
+		newLines := make([]string, 0, len(lines)+4)
+		newLines = append(newLines, lines[:pos]...)
+		if pos > 0 {
+			newLines = append(newLines, "")
+		}
+		newLines = append(newLines, SiteRegistryStart, siteLine, SiteRegistryEnd)
+		if pos < len(lines) && strings.TrimSpace(lines[pos]) != "" {
+			newLines = append(newLines, "")
+		}
+		newLines = append(newLines, lines[pos:]...)
+		return strings.Join(newLines, "\n"), nil
+	}
+
+	for i := start + 1; i < end; i++ {
+		if old := parseSiteLine(lines[i]); old != nil && old.Mac == cfg.Mac {
+			lines[i] = siteLine
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+	newLines := make([]string, 0, len(lines)+1)
+	newLines = append(newLines, lines[:end]...)
+	newLines = append(newLines, siteLine)
+	newLines = append(newLines, lines[end:]...)
+	return strings.Join(newLines, "\n"), nil
+}
+
+// DeleteSiteFromIni removes lines of the site from registry, it returns false
+// if the site is not found.
+func DeleteSiteFromIni(content string, mac string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	start, end, err := findSiteRegistry(lines)
+	if err != nil || start < 0 {
+		return content, false
+	}
+
+	found := false
+	newLines := make([]string, 0, len(lines))
+	newLines = append(newLines, lines[:start+1]...)
+	for _, line := range lines[start+1 : end] {
+		if cfg := parseSiteLine(line); cfg != nil && cfg.Mac == mac {
+			found = true
+			continue
+		}
+		newLines = append(newLines, line)
+	}
+	newLines = append(newLines, lines[end:]...)
+	return strings.Join(newLines, "\n"), found
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSiteContent = `[common]
+server_addr = 127.0.0.1
+
+# DEVICE_REGISTRY_START
+# radiation sites
+# 8ED17CFC9965|009|site 9|8ED17CFC9965|rad,online
+# suzhou||||
+# 8ED17CFC9965|010|duplicated||
+# DEVICE_REGISTRY_END
+
+[R-8ED17CFC9965-22]
+type = stcp
+role = visitor
+sk = 8ED17CFC9965
+server_name = R-8ED17CFC9965-22
+bind_port = 221
+`
+
+func TestLoadAllSiteConfFromIni(t *testing.T) {
+	assert := assert.New(t)
+
+	sites, err := LoadAllSiteConfFromIni(testSiteContent)
+	if assert.NoError(err) && assert.Len(sites, 2) {
+		assert.Equal(&SiteConf{
+			Mac:      "8ED17CFC9965",
+			Code:     "009",
+			Name:     "site 9",
+			Password: "8ED17CFC9965",
+			Tags:     []string{"rad", "online"},
+		}, sites[0])
+		assert.Equal("suzhou", sites[1].Mac)
+		assert.Empty(sites[1].Tags)
+	}
+
+	_, err = LoadAllSiteConfFromIni("# DEVICE_REGISTRY_START\n")
+	assert.Error(err)
+
+	sites, err = LoadAllSiteConfFromIni("[common]\n")
+	assert.NoError(err)
+	assert.Empty(sites)
+}
+
+func TestSetSiteInIni(t *testing.T) {
+	assert := assert.New(t)
+
+	content, err := SetSiteInIni(testSiteContent, &SiteConf{Mac: "suzhou", Code: "011", Tags: []string{"test"}})
+	assert.NoError(err)
+	sites, _ := LoadAllSiteConfFromIni(content)
+	assert.Equal("011", sites[1].Code)
+	assert.Contains(content, "# suzhou|011|||test\n# 8ED17CFC9965|010|duplicated||\n")
+
+	content, err = SetSiteInIni(testSiteContent, &SiteConf{Mac: "AABBCCDDEEFF"})
+	assert.NoError(err)
+	assert.Contains(content, "# AABBCCDDEEFF||||\n# DEVICE_REGISTRY_END\n")
+
+	content, err = SetSiteInIni("[common]\nserver_addr = 127.0.0.1\n\n[ssh]\nlocal_port = 22\n", &SiteConf{Mac: "AABBCCDDEEFF"})
+	assert.NoError(err)
+	assert.Equal("[common]\nserver_addr = 127.0.0.1\n\n"+
+		"# DEVICE_REGISTRY_START\n# AABBCCDDEEFF||||\n# DEVICE_REGISTRY_END\n\n[ssh]\nlocal_port = 22\n", content)
+}
+
+func TestDeleteSiteFromIni(t *testing.T) {
+	assert := assert.New(t)
+
+	content, ok := DeleteSiteFromIni(testSiteContent, "8ED17CFC9965")
+	assert.True(ok)
+	assert.Contains(content, "# radiation sites\n# suzhou||||\n# DEVICE_REGISTRY_END\n")
+
+	_, ok = DeleteSiteFromIni(testSiteContent, "AABBCCDDEEFF")
+	assert.False(ok)
+}
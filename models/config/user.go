@@ -0,0 +1,235 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whysmx/frp/utils/util"
+
+	ini "github.com/vaughan0/go-ini"
+)
+
+// UserConf is one user in users_file of frps.
+// Each section is a user, section name is the user name used by frpc.
+type UserConf struct {
+	User   string `json:"user"`
+	Token  string `json:"-"`
+	Enable bool   `json:"enable"`
+
+	// zero value means never expire
+	ExpireTime time.Time `json:"expire_time"`
+
+	// Proxy policy of this user, empty or zero value means no limit.
+	AllowProxyTypes map[string]struct{} `json:"allow_proxy_types"`
+	AllowPorts      map[int]struct{}    `json:"allow_ports"`
+	AllowDomains    []string            `json:"allow_domains"`
+	AllowSubDomains []string            `json:"allow_subdomains"`
+	MaxProxies      int64               `json:"max_proxies"`
+	MaxPoolCount    int64               `json:"max_pool_count"`
+}
+
+func (cfg *UserConf) UnmarshalFromIni(name string, section ini.Section) (err error) {
+	var (
+		tmpStr string
+		ok     bool
+	)
+	cfg.User = name
+	cfg.Token = section["token"]
+
+	cfg.Enable = true
+	if tmpStr, ok = section["enable"]; ok && tmpStr != "" {
+		if cfg.Enable, err = strconv.ParseBool(tmpStr); err != nil {
+			return fmt.Errorf("Parse users conf error: user [%s] invalid enable", name)
+		}
+	}
+
+	if tmpStr, ok = section["expire"]; ok && tmpStr != "" {
+		if cfg.ExpireTime, err = parseUserExpireTime(tmpStr); err != nil {
+			return fmt.Errorf("Parse users conf error: user [%s] expire error, %v", name, err)
+		}
+	}
+
+	cfg.AllowProxyTypes = make(map[string]struct{})
+	if tmpStr, ok = section["allow_proxy_types"]; ok {
+		for _, pxyType := range splitAndTrim(tmpStr) {
+			pxyType = strings.ToLower(pxyType)
+			if _, ok = proxyConfTypeMap[pxyType]; !ok {
+				return fmt.Errorf("Parse users conf error: user [%s] allow_proxy_types error, unknown proxy type [%s]", name, pxyType)
+			}
+			cfg.AllowProxyTypes[pxyType] = struct{}{}
+		}
+	}
+
+	cfg.AllowPorts = make(map[int]struct{})
+	if tmpStr, ok = section["allow_ports"]; ok && tmpStr != "" {
+		// e.g. 1000-2000,2001,2002,3000-4000
+		ports, errRet := util.ParseRangeNumbers(tmpStr)
+		if errRet != nil {
+			return fmt.Errorf("Parse users conf error: user [%s] allow_ports error, %v", name, errRet)
+		}
+		for _, port := range ports {
+			cfg.AllowPorts[int(port)] = struct{}{}
+		}
+	}
+
+	// e.g. www.example.com,*.example.com
+	cfg.AllowDomains = make([]string, 0)
+	if tmpStr, ok = section["allow_domains"]; ok {
+		for _, pattern := range splitAndTrim(tmpStr) {
+			pattern = strings.ToLower(pattern)
+			if _, errRet := path.Match(pattern, ""); errRet != nil {
+				return fmt.Errorf("Parse users conf error: user [%s] allow_domains error, invalid pattern [%s]", name, pattern)
+			}
+			cfg.AllowDomains = append(cfg.AllowDomains, pattern)
+		}
+	}
+
+	// e.g. alice,alice-*
+	cfg.AllowSubDomains = make([]string, 0)
+	if tmpStr, ok = section["allow_subdomains"]; ok {
+		for _, pattern := range splitAndTrim(tmpStr) {
+			if _, errRet := path.Match(pattern, ""); errRet != nil {
+				return fmt.Errorf("Parse users conf error: user [%s] allow_subdomains error, invalid pattern [%s]", name, pattern)
+			}
+			cfg.AllowSubDomains = append(cfg.AllowSubDomains, pattern)
+		}
+	}
+
+	if tmpStr, ok = section["max_proxies"]; ok {
+		if cfg.MaxProxies, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || cfg.MaxProxies < 0 {
+			return fmt.Errorf("Parse users conf error: user [%s] invalid max_proxies", name)
+		}
+	}
+
+	if tmpStr, ok = section["max_pool_count"]; ok {
+		if cfg.MaxPoolCount, err = strconv.ParseInt(tmpStr, 10, 64); err != nil || cfg.MaxPoolCount < 0 {
+			return fmt.Errorf("Parse users conf error: user [%s] invalid max_pool_count", name)
+		}
+	}
+	return
+}
+
+func (cfg *UserConf) IsExpired(now time.Time) bool {
+	return !cfg.ExpireTime.IsZero() && now.After(cfg.ExpireTime)
+}
+
+// CheckProxy checks if the proxy is allowed by the policy of this user.
+func (cfg *UserConf) CheckProxy(pxyConf ProxyConf) error {
+	baseInfo := pxyConf.GetBaseInfo()
+	if len(cfg.AllowProxyTypes) > 0 {
+		if _, ok := cfg.AllowProxyTypes[baseInfo.ProxyType]; !ok {
+			return fmt.Errorf("proxy type [%s] is not allowed for user [%s]", baseInfo.ProxyType, cfg.User)
+		}
+	}
+
+	switch c := pxyConf.(type) {
+	case *TcpProxyConf:
+		return cfg.checkRemotePort(c.RemotePort)
+	case *UdpProxyConf:
+		return cfg.checkRemotePort(c.RemotePort)
+	case *HttpProxyConf:
+		return cfg.checkDomains(&c.DomainConf)
+	case *HttpsProxyConf:
+		return cfg.checkDomains(&c.DomainConf)
+	}
+	return nil
+}
+
+func (cfg *UserConf) checkRemotePort(port int) error {
+	if len(cfg.AllowPorts) == 0 {
+		return nil
+	}
+	if port == 0 {
+		return fmt.Errorf("remote_port must be specified for user [%s]", cfg.User)
+	}
+	if _, ok := cfg.AllowPorts[port]; !ok {
+		return fmt.Errorf("remote port [%d] is not allowed for user [%s]", port, cfg.User)
+	}
+	return nil
+}
+
+func (cfg *UserConf) checkDomains(domainConf *DomainConf) error {
+	if len(cfg.AllowDomains) > 0 {
+		for _, domain := range domainConf.CustomDomains {
+			if !matchAnyPattern(cfg.AllowDomains, domain) {
+				return fmt.Errorf("custom domain [%s] is not allowed for user [%s]", domain, cfg.User)
+			}
+		}
+	}
+	if len(cfg.AllowSubDomains) > 0 && domainConf.SubDomain != "" {
+		if !matchAnyPattern(cfg.AllowSubDomains, domainConf.SubDomain) {
+			return fmt.Errorf("subdomain [%s] is not allowed for user [%s]", domainConf.SubDomain, cfg.User)
+		}
+	}
+	return nil
+}
+
+func matchAnyPattern(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func splitAndTrim(s string) []string {
+	res := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func parseUserExpireTime(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err = time.ParseInLocation(layout, s, time.Local); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("invalid time [%s], format should be '2006-01-02' or '2006-01-02 15:04:05'", s)
+	return
+}
+
+// LoadAllUserConfFromIni loads all users from content of users_file.
+func LoadAllUserConfFromIni(content string) (userConfs map[string]*UserConf, err error) {
+	conf, errRet := ini.Load(strings.NewReader(content))
+	if errRet != nil {
+		err = fmt.Errorf("parse ini users file error: %v", errRet)
+		return
+	}
+
+	userConfs = make(map[string]*UserConf)
+	for name, section := range conf {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		cfg := &UserConf{}
+		if err = cfg.UnmarshalFromIni(name, section); err != nil {
+			return
+		}
+		userConfs[name] = cfg
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAllUserConfFromIni(t *testing.T) {
+	assert := assert.New(t)
+
+	users, err := LoadAllUserConfFromIni(`
+[alice]
+token = 12345678
+expire = 2020-12-31
+allow_proxy_types = TCP, udp
+allow_ports = 6000-6002,6100
+allow_domains = *.Example.com
+max_proxies = 10
+
+[bob]
+token = 87654321
+enable = false
+
+[carol]
+enable = 0
+`)
+	if assert.NoError(err) && assert.Len(users, 3) {
+		alice := users["alice"]
+		assert.Equal("alice", alice.User)
+		assert.Equal("12345678", alice.Token)
+		assert.True(alice.Enable)
+		assert.Equal(time.Date(2020, 12, 31, 0, 0, 0, 0, time.Local), alice.ExpireTime)
+		assert.Equal(map[string]struct{}{"tcp": {}, "udp": {}}, alice.AllowProxyTypes)
+		assert.Len(alice.AllowPorts, 4)
+		assert.Equal([]string{"*.example.com"}, alice.AllowDomains)
+		assert.EqualValues(10, alice.MaxProxies)
+
+		assert.False(users["bob"].Enable)
+		assert.True(users["bob"].ExpireTime.IsZero())
+		assert.False(users["carol"].Enable)
+	}
+
+	for _, content := range []string{
+		"[alice]\nenable = no\n",
+		"[alice]\nexpire = 2020/12/31\n",
+		"[alice]\nallow_proxy_types = ssh\n",
+		"[alice]\nallow_ports = 6000-\n",
+		"[alice]\nmax_proxies = -1\n",
+	} {
+		_, err = LoadAllUserConfFromIni(content)
+		assert.Error(err, content)
+	}
+}
+
+func TestUserConfIsExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &UserConf{}
+	assert.False(cfg.IsExpired(time.Now()))
+
+	cfg.ExpireTime = time.Now()
+	assert.False(cfg.IsExpired(cfg.ExpireTime.Add(-time.Second)))
+	assert.True(cfg.IsExpired(cfg.ExpireTime.Add(time.Second)))
+}
+
+func TestUserConfCheckProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	users, err := LoadAllUserConfFromIni(`
+[alice]
+token = 12345678
+allow_proxy_types = tcp, udp, http, https, stcp
+allow_ports = 6000-6002
+allow_domains = *.example.com
+allow_subdomains = alice, alice-*
+
+[bob]
+token = 87654321
+`)
+	if !assert.NoError(err) {
+		return
+	}
+
+	tcp := func(port int) ProxyConf {
+		cfg := &TcpProxyConf{}
+		cfg.ProxyType = "tcp"
+		cfg.RemotePort = port
+		return cfg
+	}
+	udp := func(port int) ProxyConf {
+		cfg := &UdpProxyConf{}
+		cfg.ProxyType = "udp"
+		cfg.RemotePort = port
+		return cfg
+	}
+	http := func(subDomain string, customDomains ...string) ProxyConf {
+		cfg := &HttpProxyConf{}
+		cfg.ProxyType = "http"
+		cfg.SubDomain = subDomain
+		cfg.CustomDomains = customDomains
+		return cfg
+	}
+	https := func(subDomain string, customDomains ...string) ProxyConf {
+		cfg := &HttpsProxyConf{}
+		cfg.ProxyType = "https"
+		cfg.SubDomain = subDomain
+		cfg.CustomDomains = customDomains
+		return cfg
+	}
+	stcp := &StcpProxyConf{}
+	stcp.ProxyType = "stcp"
+	xtcp := &XtcpProxyConf{}
+	xtcp.ProxyType = "xtcp"
+
+	testcases := []struct {
+		user    string
+		pxyConf ProxyConf
+		allowed bool
+	}{
+		{"alice", tcp(6000), true},
+		{"alice", tcp(6002), true},
+		{"alice", tcp(6003), false},
+		{"alice", tcp(0), false},
+		{"alice", udp(6001), true},
+		{"alice", udp(7000), false},
+		{"alice", stcp, true},
+		{"alice", xtcp, false},
+		{"alice", http("", "a.example.com"), true},
+		{"alice", http("", "a.example.com", "example.com"), false},
+		{"alice", https("", "a.example.org"), false},
+		{"alice", http("alice"), true},
+		{"alice", https("alice-dev"), true},
+		{"alice", http("bob"), false},
+		{"alice", http("alice-dev", "a.example.com"), true},
+		{"alice", http("bob", "a.example.com"), false},
+		{"bob", tcp(0), true},
+		{"bob", xtcp, true},
+		{"bob", http("bob", "example.org"), true},
+	}
+	for i, tc := range testcases {
+		err := users[tc.user].CheckProxy(tc.pxyConf)
+		if tc.allowed {
+			assert.NoError(err, "case %d", i)
+		} else {
+			assert.Error(err, "case %d", i)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/whysmx/frp/models/consts"
 
@@ -38,6 +39,7 @@ type VisitorConf interface {
 	GetBaseInfo() *BaseVisitorConf
 	Compare(cmp VisitorConf) bool
 	UnmarshalFromIni(prefix string, name string, section ini.Section) error
+	MarshalToIni(prefix string, section ini.Section)
 	Check() error
 }
 
@@ -77,9 +79,13 @@ type BaseVisitorConf struct {
 	UseCompression bool   `json:"use_compression"`
 	Role           string `json:"role"`
 	Sk             string `json:"sk"`
+	ServerUser     string `json:"server_user"`
 	ServerName     string `json:"server_name"`
 	BindAddr       string `json:"bind_addr"`
 	BindPort       int    `json:"bind_port"`
+
+	// BindPort is assigned by frpc if bind_port is auto or 0 in config file.
+	BindPortAuto bool `json:"bind_port_auto"`
 }
 
 func (cfg *BaseVisitorConf) GetBaseInfo() *BaseVisitorConf {
@@ -93,9 +99,11 @@ func (cfg *BaseVisitorConf) compare(cmp *BaseVisitorConf) bool {
 		cfg.UseCompression != cmp.UseCompression ||
 		cfg.Role != cmp.Role ||
 		cfg.Sk != cmp.Sk ||
+		cfg.ServerUser != cmp.ServerUser ||
 		cfg.ServerName != cmp.ServerName ||
 		cfg.BindAddr != cmp.BindAddr ||
-		cfg.BindPort != cmp.BindPort {
+		cfg.BindPort != cmp.BindPort ||
+		cfg.BindPortAuto != cmp.BindPortAuto {
 		return false
 	}
 	return true
@@ -110,7 +118,7 @@ func (cfg *BaseVisitorConf) check() (err error) {
 		err = fmt.Errorf("bind_addr shouldn't be empty")
 		return
 	}
-	if cfg.BindPort <= 0 {
+	if cfg.BindPort < 0 || (cfg.BindPort == 0 && !cfg.BindPortAuto) {
 		err = fmt.Errorf("bind_port is required")
 		return
 	}
@@ -137,21 +145,51 @@ func (cfg *BaseVisitorConf) UnmarshalFromIni(prefix string, name string, section
 		return fmt.Errorf("Parse conf error: proxy [%s] incorrect role [%s]", name, cfg.Role)
 	}
 	cfg.Sk = section["sk"]
-	cfg.ServerName = prefix + section["server_name"]
+	// Visit proxies of another user if server_user is set.
+	cfg.ServerUser = section["server_user"]
+	if cfg.ServerUser != "" {
+		cfg.ServerName = cfg.ServerUser + "." + section["server_name"]
+	} else {
+		cfg.ServerName = prefix + section["server_name"]
+	}
 	if cfg.BindAddr = section["bind_addr"]; cfg.BindAddr == "" {
 		cfg.BindAddr = "127.0.0.1"
 	}
 
 	if tmpStr, ok = section["bind_port"]; ok {
-		if cfg.BindPort, err = strconv.Atoi(tmpStr); err != nil {
+		if tmpStr == "auto" {
+			cfg.BindPort = 0
+		} else if cfg.BindPort, err = strconv.Atoi(tmpStr); err != nil {
 			return fmt.Errorf("Parse conf error: proxy [%s] bind_port incorrect", name)
 		}
+		cfg.BindPortAuto = cfg.BindPort == 0
 	} else {
 		return fmt.Errorf("Parse conf error: proxy [%s] bind_port not found", name)
 	}
 	return nil
 }
 
+func (cfg *BaseVisitorConf) MarshalToIni(prefix string, section ini.Section) {
+	section["type"] = cfg.ProxyType
+	section["role"] = "visitor"
+	setIniBool(section, "use_encryption", cfg.UseEncryption)
+	setIniBool(section, "use_compression", cfg.UseCompression)
+	setIniString(section, "sk", cfg.Sk)
+	// server_name is prefixed with server_user or user of this client when loaded
+	setIniString(section, "server_user", cfg.ServerUser)
+	if cfg.ServerUser != "" {
+		setIniString(section, "server_name", strings.TrimPrefix(cfg.ServerName, cfg.ServerUser+"."))
+	} else {
+		setIniString(section, "server_name", strings.TrimPrefix(cfg.ServerName, prefix))
+	}
+	setIniString(section, "bind_addr", cfg.BindAddr)
+	if cfg.BindPortAuto || cfg.BindPort == 0 {
+		section["bind_port"] = "auto"
+	} else {
+		section["bind_port"] = strconv.Itoa(cfg.BindPort)
+	}
+}
+
 type StcpVisitorConf struct {
 	BaseVisitorConf
 }
@@ -175,6 +213,10 @@ func (cfg *StcpVisitorConf) UnmarshalFromIni(prefix string, name string, section
 	return
 }
 
+func (cfg *StcpVisitorConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseVisitorConf.MarshalToIni(prefix, section)
+}
+
 func (cfg *StcpVisitorConf) Check() (err error) {
 	if err = cfg.BaseVisitorConf.check(); err != nil {
 		return
@@ -205,6 +247,10 @@ func (cfg *XtcpVisitorConf) UnmarshalFromIni(prefix string, name string, section
 	return
 }
 
+func (cfg *XtcpVisitorConf) MarshalToIni(prefix string, section ini.Section) {
+	cfg.BaseVisitorConf.MarshalToIni(prefix, section)
+}
+
 func (cfg *XtcpVisitorConf) Check() (err error) {
 	if err = cfg.BaseVisitorConf.check(); err != nil {
 		return
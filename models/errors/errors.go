@@ -21,4 +21,5 @@ import (
 var (
 	ErrMsgType   = errors.New("message type error")
 	ErrCtlClosed = errors.New("control is closed")
+	ErrDraining  = errors.New("frps is draining")
 )
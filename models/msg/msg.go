@@ -35,6 +35,7 @@ const (
 	TypeNatHoleResp           = 'm'
 	TypeNatHoleClientDetectOK = 'd'
 	TypeNatHoleSid            = '5'
+	TypeServerDrain           = 'e'
 )
 
 var (
@@ -57,6 +58,7 @@ var (
 		TypeNatHoleResp:           NatHoleResp{},
 		TypeNatHoleClientDetectOK: NatHoleClientDetectOK{},
 		TypeNatHoleSid:            NatHoleSid{},
+		TypeServerDrain:           ServerDrain{},
 	}
 )
 
@@ -103,8 +105,18 @@ type NewProxy struct {
 	HostHeaderRewrite string            `json:"host_header_rewrite"`
 	Headers           map[string]string `json:"headers"`
 
-	// stcp
+	// stcp and xtcp
+	Sk         string      `json:"sk"`
+	Sks        []SecretKey `json:"sks"`
+	AllowUsers []string    `json:"allow_users"`
+}
+
+// Secret key of stcp and xtcp proxies besides sk.
+type SecretKey struct {
 	Sk string `json:"sk"`
+
+	// unix time, 0 means never expire
+	ExpireTime int64 `json:"expire_time"`
 }
 
 type NewProxyResp struct {
@@ -118,7 +130,9 @@ type CloseProxy struct {
 }
 
 type NewWorkConn struct {
-	RunId string `json:"run_id"`
+	RunId        string `json:"run_id"`
+	PrivilegeKey string `json:"privilege_key"`
+	Timestamp    int64  `json:"timestamp"`
 }
 
 type ReqWorkConn struct {
@@ -133,22 +147,36 @@ type StartWorkConn struct {
 }
 
 type NewVisitorConn struct {
+	RunId          string `json:"run_id"`
+	PrivilegeKey   string `json:"privilege_key"`
 	ProxyName      string `json:"proxy_name"`
 	SignKey        string `json:"sign_key"`
 	Timestamp      int64  `json:"timestamp"`
+	Nonce          string `json:"nonce"`
 	UseEncryption  bool   `json:"use_encryption"`
 	UseCompression bool   `json:"use_compression"`
 }
 
 type NewVisitorConnResp struct {
-	ProxyName string `json:"proxy_name"`
-	Error     string `json:"error"`
+	ProxyName     string `json:"proxy_name"`
+	SkFingerprint string `json:"sk_fingerprint"`
+	Error         string `json:"error"`
 }
 
 type Ping struct {
+	PrivilegeKey string `json:"privilege_key"`
+	Timestamp    int64  `json:"timestamp"`
 }
 
 type Pong struct {
+	Error string `json:"error"`
+}
+
+// frps sends this message to all clients when it starts draining, clients
+// should login to another frps before the deadline.
+type ServerDrain struct {
+	// unix time when frps closes this control connection
+	Deadline int64 `json:"deadline"`
 }
 
 type UdpPacket struct {
@@ -158,9 +186,12 @@ type UdpPacket struct {
 }
 
 type NatHoleVisitor struct {
-	ProxyName string `json:"proxy_name"`
-	SignKey   string `json:"sign_key"`
-	Timestamp int64  `json:"timestamp"`
+	RunId        string `json:"run_id"`
+	PrivilegeKey string `json:"privilege_key"`
+	ProxyName    string `json:"proxy_name"`
+	SignKey      string `json:"sign_key"`
+	Timestamp    int64  `json:"timestamp"`
+	Nonce        string `json:"nonce"`
 }
 
 type NatHoleClient struct {
@@ -179,5 +210,6 @@ type NatHoleClientDetectOK struct {
 }
 
 type NatHoleSid struct {
-	Sid string `json:"sid"`
+	Sid           string `json:"sid"`
+	SkFingerprint string `json:"sk_fingerprint"`
 }
@@ -7,7 +7,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/whysmx/frp/models/config"
 	"github.com/whysmx/frp/models/msg"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
 	"github.com/whysmx/frp/utils/util"
 
@@ -18,9 +20,14 @@ import (
 // Timeout seconds.
 var NatHoleTimeout int64 = 10
 
+// AuthVisitorFn checks the privilege key of a visitor and returns the user
+// of the client it belongs to.
+type AuthVisitorFn func(purpose string, runId string, timestamp int64, privilegeKey string) (user string, err error)
+
 type SidRequest struct {
-	Sid      string
-	NotifyCh chan struct{}
+	Sid           string
+	SkFingerprint string
+	NotifyCh      chan struct{}
 }
 
 type NatHoleController struct {
@@ -29,10 +36,19 @@ type NatHoleController struct {
 	clientCfgs map[string]*NatHoleClientCfg
 	sessions   map[string]*NatHoleSession
 
+	// Reject visitor messages with expired timestamps or used sign keys.
+	replayFilter *util.ReplayFilter
+
+	// Sign keys created by weaker auth schemes are rejected.
+	minAuthScheme string
+
+	authVisitorFn AuthVisitorFn
+
 	mu sync.RWMutex
 }
 
-func NewNatHoleController(udpBindAddr string) (nc *NatHoleController, err error) {
+func NewNatHoleController(udpBindAddr string, replayFilter *util.ReplayFilter, minAuthScheme string,
+	authVisitorFn AuthVisitorFn) (nc *NatHoleController, err error) {
 	addr, err := net.ResolveUDPAddr("udp", udpBindAddr)
 	if err != nil {
 		return nil, err
@@ -42,19 +58,30 @@ func NewNatHoleController(udpBindAddr string) (nc *NatHoleController, err error)
 		return nil, err
 	}
 	nc = &NatHoleController{
-		listener:   lconn,
-		clientCfgs: make(map[string]*NatHoleClientCfg),
-		sessions:   make(map[string]*NatHoleSession),
+		listener:      lconn,
+		clientCfgs:    make(map[string]*NatHoleClientCfg),
+		sessions:      make(map[string]*NatHoleSession),
+		replayFilter:  replayFilter,
+		minAuthScheme: minAuthScheme,
+		authVisitorFn: authVisitorFn,
 	}
 	return nc, nil
 }
 
-func (nc *NatHoleController) ListenClient(name string, sk string) (sidCh chan *SidRequest) {
+// ListenClient registers xtcp proxy [name]. Visitors can use sk or any key in
+// sks not expired. The owner of the proxy is always allowed to visit it if
+// allowUsers is not empty.
+func (nc *NatHoleController) ListenClient(name string, sk string, sks []msg.SecretKey,
+	owner string, allowUsers []string) (sidCh chan *SidRequest) {
 	clientCfg := &NatHoleClientCfg{
 		Name:  name,
 		Sk:    sk,
+		Sks:   sks,
 		SidCh: make(chan *SidRequest),
 	}
+	if len(allowUsers) > 0 {
+		clientCfg.AllowUsers = append([]string{owner}, allowUsers...)
+	}
 	nc.mu.Lock()
 	nc.clientCfgs[name] = clientCfg
 	nc.mu.Unlock()
@@ -103,6 +130,15 @@ func (nc *NatHoleController) GenSid() string {
 }
 
 func (nc *NatHoleController) HandleVisitor(m *msg.NatHoleVisitor, raddr *net.UDPAddr) {
+	user, err := nc.authVisitorFn(util.AuthPurposeNatHoleVisitor, m.RunId, m.Timestamp, m.PrivilegeKey)
+	if err != nil {
+		errInfo := fmt.Sprintf("xtcp connection of [%s] auth failed: %v", m.ProxyName, err)
+		log.Debug(errInfo)
+		nc.auditVisitorAuthFailed(m, raddr, errInfo)
+		nc.listener.WriteToUDP(nc.GenNatHoleResponse(nil, errInfo), raddr)
+		return
+	}
+
 	sid := nc.GenSid()
 	session := &NatHoleSession{
 		Sid:         sid,
@@ -115,13 +151,38 @@ func (nc *NatHoleController) HandleVisitor(m *msg.NatHoleVisitor, raddr *net.UDP
 		nc.mu.Unlock()
 		errInfo := fmt.Sprintf("xtcp server for [%s] doesn't exist", m.ProxyName)
 		log.Debug(errInfo)
+		nc.auditVisitorAuthFailed(m, raddr, errInfo)
 		nc.listener.WriteToUDP(nc.GenNatHoleResponse(nil, errInfo), raddr)
 		return
 	}
-	if m.SignKey != util.GetAuthKey(clientCfg.Sk, m.Timestamp) {
+	var sk string
+	for _, validSk := range config.GetValidSks(clientCfg.Sk, clientCfg.Sks, time.Now()) {
+		if util.CheckVisitorAuthKey(nc.minAuthScheme, validSk, m.Timestamp, m.Nonce, m.SignKey) {
+			sk = validSk
+			break
+		}
+	}
+	if sk == "" {
 		nc.mu.Unlock()
 		errInfo := fmt.Sprintf("xtcp connection of [%s] auth failed", m.ProxyName)
 		log.Debug(errInfo)
+		nc.auditVisitorAuthFailed(m, raddr, errInfo)
+		nc.listener.WriteToUDP(nc.GenNatHoleResponse(nil, errInfo), raddr)
+		return
+	}
+	if err = nc.replayFilter.Check(m.SignKey, m.Timestamp); err != nil {
+		nc.mu.Unlock()
+		errInfo := fmt.Sprintf("xtcp connection of [%s] rejected: %v", m.ProxyName, err)
+		log.Debug(errInfo)
+		nc.auditVisitorAuthFailed(m, raddr, errInfo)
+		nc.listener.WriteToUDP(nc.GenNatHoleResponse(nil, errInfo), raddr)
+		return
+	}
+	if !config.IsVisitorUserAllowed(clientCfg.AllowUsers, user) {
+		nc.mu.Unlock()
+		errInfo := fmt.Sprintf("xtcp connection of [%s] from user [%s] is not allowed", m.ProxyName, user)
+		log.Debug(errInfo)
+		nc.auditVisitorAuthFailed(m, raddr, errInfo)
 		nc.listener.WriteToUDP(nc.GenNatHoleResponse(nil, errInfo), raddr)
 		return
 	}
@@ -136,10 +197,11 @@ func (nc *NatHoleController) HandleVisitor(m *msg.NatHoleVisitor, raddr *net.UDP
 		nc.mu.Unlock()
 	}()
 
-	err := errors.PanicToError(func() {
+	err = errors.PanicToError(func() {
 		clientCfg.SidCh <- &SidRequest{
-			Sid:      sid,
-			NotifyCh: session.NotifyCh,
+			Sid:           sid,
+			SkFingerprint: util.GetSkFingerprint(sk),
+			NotifyCh:      session.NotifyCh,
 		}
 	})
 	if err != nil {
@@ -157,6 +219,15 @@ func (nc *NatHoleController) HandleVisitor(m *msg.NatHoleVisitor, raddr *net.UDP
 	}
 }
 
+func (nc *NatHoleController) auditVisitorAuthFailed(m *msg.NatHoleVisitor, raddr *net.UDPAddr, reason string) {
+	audit.Record(audit.EventVisitorAuthFailed, audit.Fields{
+		"proxy_name":  m.ProxyName,
+		"run_id":      m.RunId,
+		"remote_addr": raddr.String(),
+		"reason":      reason,
+	})
+}
+
 func (nc *NatHoleController) HandleClient(m *msg.NatHoleClient, raddr *net.UDPAddr) {
 	nc.mu.RLock()
 	session, ok := nc.sessions[m.Sid]
@@ -206,7 +277,9 @@ type NatHoleSession struct {
 }
 
 type NatHoleClientCfg struct {
-	Name  string
-	Sk    string
-	SidCh chan *SidRequest
+	Name       string
+	Sk         string
+	Sks        []msg.SecretKey
+	AllowUsers []string
+	SidCh      chan *SidRequest
 }
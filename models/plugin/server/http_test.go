@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/whysmx/frp/models/msg"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPPlugin(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		gotQuery string
+		gotReq   map[string]interface{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &gotReq)
+
+		switch r.URL.Query().Get("op") {
+		case OpLogin:
+			w.Write([]byte(`{"reject":false,"unchange":false,"content":{"user":"bob","client_address":"1.1.1.1:1000"}}`))
+		case OpNewProxy:
+			w.Write([]byte(`{"reject":true,"reject_reason":"invalid proxy"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	p := NewHTTPPlugin(HTTPPluginOptions{
+		Name: "test",
+		Addr: strings.TrimPrefix(ts.URL, "http://"),
+		Path: "/handler",
+		Ops:  []string{OpLogin, OpNewProxy},
+	})
+	assert.True(p.IsSupport(OpLogin))
+	assert.False(p.IsSupport(OpNewUserConn))
+
+	res, retContent, err := p.Handle(OpLogin, LoginContent{Login: msg.Login{User: "alice"}})
+	if assert.NoError(err) {
+		assert.False(res.Reject)
+		assert.Equal("op="+OpLogin+"&version="+APIVersion, gotQuery)
+		assert.Equal(OpLogin, gotReq["op"])
+		assert.Equal("alice", gotReq["content"].(map[string]interface{})["user"])
+		if assert.IsType(&LoginContent{}, retContent) {
+			assert.Equal("bob", retContent.(*LoginContent).User)
+			assert.Equal("1.1.1.1:1000", retContent.(*LoginContent).ClientAddress)
+		}
+	}
+
+	res, _, err = p.Handle(OpNewProxy, NewProxyContent{})
+	if assert.NoError(err) {
+		assert.True(res.Reject)
+		assert.Equal("invalid proxy", res.RejectReason)
+	}
+
+	_, _, err = p.Handle(OpNewWorkConn, NewWorkConnContent{})
+	assert.Error(err)
+}
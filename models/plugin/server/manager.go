@@ -0,0 +1,107 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/whysmx/frp/utils/log"
+)
+
+// Manager dispatches operations to all registered plugins in order.
+// A plugin which rewrites the content passes the new content to the next one.
+type Manager struct {
+	loginPlugins       []Plugin
+	newProxyPlugins    []Plugin
+	newWorkConnPlugins []Plugin
+	newUserConnPlugins []Plugin
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		loginPlugins:       make([]Plugin, 0),
+		newProxyPlugins:    make([]Plugin, 0),
+		newWorkConnPlugins: make([]Plugin, 0),
+		newUserConnPlugins: make([]Plugin, 0),
+	}
+}
+
+func (m *Manager) Register(p Plugin) {
+	if p.IsSupport(OpLogin) {
+		m.loginPlugins = append(m.loginPlugins, p)
+	}
+	if p.IsSupport(OpNewProxy) {
+		m.newProxyPlugins = append(m.newProxyPlugins, p)
+	}
+	if p.IsSupport(OpNewWorkConn) {
+		m.newWorkConnPlugins = append(m.newWorkConnPlugins, p)
+	}
+	if p.IsSupport(OpNewUserConn) {
+		m.newUserConnPlugins = append(m.newUserConnPlugins, p)
+	}
+}
+
+func (m *Manager) Login(content *LoginContent) (*LoginContent, error) {
+	ret, err := handle(m.loginPlugins, OpLogin, content)
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*LoginContent), nil
+}
+
+func (m *Manager) NewProxy(content *NewProxyContent) (*NewProxyContent, error) {
+	ret, err := handle(m.newProxyPlugins, OpNewProxy, content)
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*NewProxyContent), nil
+}
+
+func (m *Manager) NewWorkConn(content *NewWorkConnContent) (*NewWorkConnContent, error) {
+	ret, err := handle(m.newWorkConnPlugins, OpNewWorkConn, content)
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*NewWorkConnContent), nil
+}
+
+func (m *Manager) NewUserConn(content *NewUserConnContent) (*NewUserConnContent, error) {
+	ret, err := handle(m.newUserConnPlugins, OpNewUserConn, content)
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*NewUserConnContent), nil
+}
+
+// handle sends content to plugins in order. content is a pointer to one of
+// the content types, plugins get the value it points to and the pointer to
+// the final content is returned.
+func handle(plugins []Plugin, op string, content interface{}) (interface{}, error) {
+	for _, p := range plugins {
+		res, retContent, err := p.Handle(op, reflect.ValueOf(content).Elem().Interface())
+		if err != nil {
+			log.Warn("send %s request to plugin [%s] error: %v", op, p.Name(), err)
+			return nil, fmt.Errorf("send %s request to plugin error", op)
+		}
+		if res.Reject {
+			return nil, fmt.Errorf("%s", res.RejectReason)
+		}
+		if !res.Unchange {
+			content = retContent
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/whysmx/frp/models/msg"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPlugin struct {
+	name   string
+	ops    []string
+	handle func(op string, content interface{}) (*Response, interface{}, error)
+	calls  int
+}
+
+func (p *mockPlugin) Name() string {
+	return p.name
+}
+
+func (p *mockPlugin) IsSupport(op string) bool {
+	for _, v := range p.ops {
+		if v == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *mockPlugin) Handle(op string, content interface{}) (*Response, interface{}, error) {
+	p.calls++
+	return p.handle(op, content)
+}
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+
+	rewrite := &mockPlugin{
+		name: "rewrite",
+		ops:  []string{OpLogin, OpNewProxy},
+		handle: func(op string, content interface{}) (*Response, interface{}, error) {
+			if c, ok := content.(LoginContent); ok {
+				c.User = "bob"
+				return &Response{}, &c, nil
+			}
+			return &Response{Unchange: true}, nil, nil
+		},
+	}
+	var got LoginContent
+	check := &mockPlugin{
+		name: "check",
+		ops:  []string{OpLogin, OpNewUserConn},
+		handle: func(op string, content interface{}) (*Response, interface{}, error) {
+			switch c := content.(type) {
+			case LoginContent:
+				got = c
+				return &Response{Unchange: true}, nil, nil
+			case NewUserConnContent:
+				return &Response{Reject: true, RejectReason: "blocked " + c.RemoteAddr}, nil, nil
+			}
+			return nil, nil, fmt.Errorf("unexpected content")
+		},
+	}
+	m := NewManager()
+	m.Register(rewrite)
+	m.Register(check)
+
+	// content rewritten by the first plugin is passed to the next one
+	ret, err := m.Login(&LoginContent{Login: msg.Login{User: "alice"}, ClientAddress: "1.1.1.1:1000"})
+	if assert.NoError(err) {
+		assert.Equal("bob", ret.User)
+		assert.Equal("1.1.1.1:1000", ret.ClientAddress)
+		assert.Equal("bob", got.User)
+	}
+
+	// unchanged content is returned as it is
+	content := &NewProxyContent{NewProxy: msg.NewProxy{ProxyName: "ssh"}}
+	pxyRet, err := m.NewProxy(content)
+	assert.NoError(err)
+	assert.True(content == pxyRet)
+	assert.Equal(1, check.calls)
+
+	_, err = m.NewUserConn(&NewUserConnContent{RemoteAddr: "2.2.2.2:2000"})
+	assert.EqualError(err, "blocked 2.2.2.2:2000")
+
+	// no plugins for this op
+	_, err = m.NewWorkConn(&NewWorkConnContent{})
+	assert.NoError(err)
+
+	failed := &mockPlugin{
+		name: "failed",
+		ops:  []string{OpNewWorkConn},
+		handle: func(op string, content interface{}) (*Response, interface{}, error) {
+			return nil, nil, fmt.Errorf("connection refused")
+		},
+	}
+	m.Register(failed)
+	_, err = m.NewWorkConn(&NewWorkConnContent{})
+	assert.EqualError(err, "send NewWorkConn request to plugin error")
+}
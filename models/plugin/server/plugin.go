@@ -0,0 +1,34 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+const (
+	APIVersion = "0.1.0"
+
+	OpLogin       = "Login"
+	OpNewProxy    = "NewProxy"
+	OpNewWorkConn = "NewWorkConn"
+	OpNewUserConn = "NewUserConn"
+)
+
+// Plugin is called by frps before some operations are accepted.
+type Plugin interface {
+	Name() string
+	IsSupport(op string) bool
+
+	// Handle sends content to the plugin and returns its response.
+	// retContent has the same type as content and is only valid if res.Unchange is false.
+	Handle(op string, content interface{}) (res *Response, retContent interface{}, err error)
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook posts lifecycle events of clients and proxies to HTTP
+// endpoints. Events are queued and sent in order with retries, they are
+// dropped if the queue is full.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/whysmx/frp/utils/log"
+)
+
+// Events sent to webhooks.
+const (
+	EventLogin         = "login"
+	EventClientClose   = "client_close"
+	EventNewProxy      = "new_proxy"
+	EventCloseProxy    = "close_proxy"
+	EventProxyConflict = "proxy_conflict"
+)
+
+var AllEvents = []string{EventLogin, EventClientClose, EventNewProxy, EventCloseProxy, EventProxyConflict}
+
+var (
+	webhookTimeout  = 10 * time.Second
+	minRetryBackoff = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+type Options struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+
+	// events sent to this webhook, all events if empty
+	Events []string `json:"events"`
+
+	MaxRetries int64 `json:"max_retries"`
+	QueueSize  int64 `json:"queue_size"`
+}
+
+type ProxyInfo struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// Event is the JSON body posted to webhooks, Time is set by Manager.
+type Event struct {
+	Event      string     `json:"event"`
+	Time       string     `json:"time"`
+	RunId      string     `json:"run_id"`
+	User       string     `json:"user"`
+	Hostname   string     `json:"hostname"`
+	Os         string     `json:"os"`
+	Arch       string     `json:"arch"`
+	Version    string     `json:"version"`
+	RemoteAddr string     `json:"remote_addr"`
+	Proxy      *ProxyInfo `json:"proxy,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+type Webhook struct {
+	options Options
+	events  map[string]struct{}
+
+	queue  chan *Event
+	client *http.Client
+}
+
+func NewWebhook(options Options) *Webhook {
+	w := &Webhook{
+		options: options,
+		events:  make(map[string]struct{}),
+		queue:   make(chan *Event, options.QueueSize),
+		client: &http.Client{
+			Timeout: webhookTimeout,
+		},
+	}
+	for _, e := range options.Events {
+		w.events[e] = struct{}{}
+	}
+	return w
+}
+
+func (w *Webhook) IsSupport(event string) bool {
+	if len(w.events) == 0 {
+		return true
+	}
+	_, ok := w.events[event]
+	return ok
+}
+
+// Push puts the event in queue without blocking.
+func (w *Webhook) Push(e *Event) {
+	select {
+	case w.queue <- e:
+	default:
+		log.Warn("webhook [%s] queue is full, drop event [%s] of [%s]", w.options.Name, e.Event, e.RunId)
+	}
+}
+
+// Run sends events in queue until Close is called.
+func (w *Webhook) Run() {
+	for e := range w.queue {
+		w.send(e)
+	}
+}
+
+// Close stops the webhook after events in queue are sent.
+func (w *Webhook) Close() {
+	close(w.queue)
+}
+
+func (w *Webhook) send(e *Event) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		log.Warn("webhook [%s] marshal event [%s] error: %v", w.options.Name, e.Event, err)
+		return
+	}
+
+	backoff := minRetryBackoff
+	for i := int64(0); ; i++ {
+		if err = w.do(buf); err == nil {
+			return
+		}
+		if i >= w.options.MaxRetries {
+			log.Warn("webhook [%s] send event [%s] of [%s] error: %v, give up after %d retries",
+				w.options.Name, e.Event, e.RunId, err, i)
+			return
+		}
+		log.Debug("webhook [%s] send event [%s] error: %v, retry in %v", w.options.Name, e.Event, err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func (w *Webhook) do(buf []byte) error {
+	req, err := http.NewRequest("POST", w.options.Url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("do http request error code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type Manager struct {
+	webhooks []*Webhook
+
+	mu sync.RWMutex
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		webhooks: make([]*Webhook, 0),
+	}
+}
+
+// Reload replaces all webhooks, events queued in old webhooks are still sent.
+func (m *Manager) Reload(options map[string]Options) {
+	webhooks := make([]*Webhook, 0, len(options))
+	for _, o := range options {
+		w := NewWebhook(o)
+		go w.Run()
+		webhooks = append(webhooks, w)
+	}
+
+	m.mu.Lock()
+	old := m.webhooks
+	m.webhooks = webhooks
+	m.mu.Unlock()
+
+	for _, w := range old {
+		w.Close()
+	}
+}
+
+// Notify sends the event to all webhooks supporting it.
+func (m *Manager) Notify(e *Event) {
+	e.Time = time.Now().Format(time.RFC3339)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, w := range m.webhooks {
+		if w.IsSupport(e.Event) {
+			w.Push(e)
+		}
+	}
+}
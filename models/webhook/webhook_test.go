@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer records events posted to it, the first failures requests fail.
+type testServer struct {
+	*httptest.Server
+
+	failures int
+	requests int
+	events   []*Event
+	mu       sync.Mutex
+}
+
+func newTestServer(failures int) *testServer {
+	s := &testServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.requests <= s.failures {
+			w.WriteHeader(500)
+			return
+		}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(400)
+			return
+		}
+		buf, _ := ioutil.ReadAll(r.Body)
+		e := &Event{}
+		if err := json.Unmarshal(buf, e); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		s.events = append(s.events, e)
+	}))
+	return s
+}
+
+func (s *testServer) getRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *testServer) getEvents() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Event{}, s.events...)
+}
+
+// waitEvents waits until n events are received or timeout.
+func (s *testServer) waitEvents(n int, timeout time.Duration) []*Event {
+	deadline := time.Now().Add(timeout)
+	for {
+		events := s.getEvents()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerNotify(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(0)
+	defer s.Close()
+
+	m := NewManager()
+	m.Reload(map[string]Options{
+		"test": {
+			Name:      "test",
+			Url:       s.URL,
+			Events:    []string{EventLogin, EventNewProxy},
+			QueueSize: 10,
+		},
+	})
+	m.Notify(&Event{Event: EventLogin, RunId: "1"})
+	m.Notify(&Event{Event: EventClientClose, RunId: "1"})
+	m.Notify(&Event{Event: EventNewProxy, RunId: "1", Proxy: &ProxyInfo{Name: "ssh", Type: "tcp"}})
+
+	// events queued are still sent after webhooks are reloaded
+	m.Reload(nil)
+	events := s.waitEvents(2, time.Second)
+	if !assert.Len(events, 2) {
+		return
+	}
+	assert.Equal(EventLogin, events[0].Event)
+	assert.NotEmpty(events[0].Time)
+	assert.Equal(EventNewProxy, events[1].Event)
+	assert.Equal(&ProxyInfo{Name: "ssh", Type: "tcp"}, events[1].Proxy)
+	assert.Equal(2, s.getRequests())
+}
+
+func TestWebhookRetry(t *testing.T) {
+	assert := assert.New(t)
+	oldMin, oldMax := minRetryBackoff, maxRetryBackoff
+	minRetryBackoff, maxRetryBackoff = 10*time.Millisecond, 20*time.Millisecond
+	defer func() {
+		minRetryBackoff, maxRetryBackoff = oldMin, oldMax
+	}()
+
+	testcases := []struct {
+		failures   int
+		maxRetries int64
+		requests   int
+		delivered  bool
+		// backoff doubles after each retry up to maxRetryBackoff
+		minElapsed time.Duration
+	}{
+		{0, 0, 1, true, 0},
+		{1, 0, 1, false, 0},
+		{2, 2, 3, true, 30 * time.Millisecond},
+		{4, 3, 4, false, 50 * time.Millisecond},
+	}
+	for _, tc := range testcases {
+		s := newTestServer(tc.failures)
+		w := NewWebhook(Options{Name: "test", Url: s.URL, MaxRetries: tc.maxRetries})
+		start := time.Now()
+		w.send(&Event{Event: EventLogin})
+		assert.True(time.Since(start) >= tc.minElapsed, "%+v", tc)
+		assert.Equal(tc.requests, s.getRequests(), "%+v", tc)
+		assert.Equal(tc.delivered, len(s.getEvents()) == 1, "%+v", tc)
+		s.Close()
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(0)
+	defer s.Close()
+
+	w := NewWebhook(Options{Name: "test", Url: s.URL, QueueSize: 2})
+	for _, runId := range []string{"1", "2", "3"} {
+		w.Push(&Event{Event: EventLogin, RunId: runId})
+	}
+	w.Close()
+	w.Run()
+
+	events := s.getEvents()
+	if assert.Len(events, 2) {
+		assert.Equal("1", events[0].RunId)
+		assert.Equal("2", events[1].RunId)
+	}
+}
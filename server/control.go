@@ -19,6 +19,7 @@ import (
 	"io"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/whysmx/frp/g"
@@ -26,10 +27,14 @@ import (
 	"github.com/whysmx/frp/models/consts"
 	frpErr "github.com/whysmx/frp/models/errors"
 	"github.com/whysmx/frp/models/msg"
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/webhook"
 	"github.com/whysmx/frp/server/controller"
 	"github.com/whysmx/frp/server/proxy"
 	"github.com/whysmx/frp/server/stats"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
 	"github.com/whysmx/frp/utils/version"
 
 	"github.com/fatedier/golib/control/shutdown"
@@ -41,12 +46,18 @@ type ControlManager struct {
 	// controls indexed by run id
 	ctlsByRunId map[string]*Control
 
+	// clients kicked from dashboard can't login again until the time
+	blockedRunIds map[string]time.Time
+	blockedUsers  map[string]time.Time
+
 	mu sync.RWMutex
 }
 
 func NewControlManager() *ControlManager {
 	return &ControlManager{
-		ctlsByRunId: make(map[string]*Control),
+		ctlsByRunId:   make(map[string]*Control),
+		blockedRunIds: make(map[string]time.Time),
+		blockedUsers:  make(map[string]time.Time),
 	}
 }
 
@@ -78,7 +89,66 @@ func (cm *ControlManager) GetById(runId string) (ctl *Control, ok bool) {
 	return
 }
 
+func (cm *ControlManager) GetByUser(user string) (ctls []*Control) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	ctls = make([]*Control, 0)
+	for _, ctl := range cm.ctlsByRunId {
+		if ctl.loginMsg.User == user {
+			ctls = append(ctls, ctl)
+		}
+	}
+	return
+}
+
+// GetAll returns controls of all clients logged in.
+func (cm *ControlManager) GetAll() (ctls []*Control) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	ctls = make([]*Control, 0, len(cm.ctlsByRunId))
+	for _, ctl := range cm.ctlsByRunId {
+		ctls = append(ctls, ctl)
+	}
+	return
+}
+
+func (cm *ControlManager) BlockRunId(runId string, d time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.blockedRunIds[runId] = time.Now().Add(d)
+}
+
+func (cm *ControlManager) BlockUser(user string, d time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.blockedUsers[user] = time.Now().Add(d)
+}
+
+// CheckBlocked returns an error if the client is blocked by run id or user,
+// expired blocks are removed.
+func (cm *ControlManager) CheckBlocked(runId string, user string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	now := time.Now()
+	if until, ok := cm.blockedRunIds[runId]; ok && runId != "" {
+		if now.Before(until) {
+			return fmt.Errorf("client [%s] is blocked until %s", runId, until.Format("01-02 15:04:05"))
+		}
+		delete(cm.blockedRunIds, runId)
+	}
+	if until, ok := cm.blockedUsers[user]; ok {
+		if now.Before(until) {
+			return fmt.Errorf("user [%s] is blocked until %s", user, until.Format("01-02 15:04:05"))
+		}
+		delete(cm.blockedUsers, user)
+	}
+	return nil
+}
+
 type Control struct {
+	// number of work connections in use, accessed atomically
+	activeWorkConns int64
+
 	// all resource managers and controllers
 	rc *controller.ResourceController
 
@@ -91,6 +161,12 @@ type Control struct {
 	// login message
 	loginMsg *msg.Login
 
+	// token of this client, it's the token of user in users_file or the token in [common]
+	token string
+
+	// auth scheme negotiated with client by its version
+	authScheme string
+
 	// control connection
 	conn net.Conn
 
@@ -112,6 +188,9 @@ type Control struct {
 	// ports used, for limitations
 	portsUsedNum int
 
+	// time when client logged in
+	loginTime time.Time
+
 	// last time got the Ping message
 	lastPing time.Time
 
@@ -123,6 +202,12 @@ type Control struct {
 	// control status
 	status string
 
+	// true after ServerDrain message is sent, no more proxies are accepted
+	draining bool
+
+	// why the control is closed, only the first reason is kept
+	closeReason string
+
 	readerShutdown  *shutdown.Shutdown
 	writerShutdown  *shutdown.Shutdown
 	managerShutdown *shutdown.Shutdown
@@ -132,7 +217,18 @@ type Control struct {
 }
 
 func NewControl(rc *controller.ResourceController, pxyManager *proxy.ProxyManager,
-	statsCollector stats.Collector, ctlConn net.Conn, loginMsg *msg.Login) *Control {
+	statsCollector stats.Collector, ctlConn net.Conn, loginMsg *msg.Login, token string, authScheme string) *Control {
+
+	poolCount := loginMsg.PoolCount
+	if int64(poolCount) > g.GetServerCfg().MaxPoolCount {
+		poolCount = int(g.GetServerCfg().MaxPoolCount)
+	}
+	if rc.UserManager != nil {
+		if userConf, ok := rc.UserManager.GetUser(loginMsg.User); ok &&
+			userConf.MaxPoolCount > 0 && int64(poolCount) > userConf.MaxPoolCount {
+			poolCount = int(userConf.MaxPoolCount)
+		}
+	}
 
 	return &Control{
 		rc:              rc,
@@ -140,12 +236,15 @@ func NewControl(rc *controller.ResourceController, pxyManager *proxy.ProxyManage
 		statsCollector:  statsCollector,
 		conn:            ctlConn,
 		loginMsg:        loginMsg,
+		token:           token,
+		authScheme:      authScheme,
 		sendCh:          make(chan msg.Message, 10),
 		readCh:          make(chan msg.Message, 10),
-		workConnCh:      make(chan net.Conn, loginMsg.PoolCount+10),
+		workConnCh:      make(chan net.Conn, poolCount+10),
 		proxies:         make(map[string]proxy.Proxy),
-		poolCount:       loginMsg.PoolCount,
+		poolCount:       poolCount,
 		portsUsedNum:    0,
+		loginTime:       time.Now(),
 		lastPing:        time.Now(),
 		runId:           loginMsg.RunId,
 		status:          consts.Working,
@@ -161,7 +260,7 @@ func (ctl *Control) Start() {
 	loginRespMsg := &msg.LoginResp{
 		Version:       version.Full(),
 		RunId:         ctl.runId,
-		ServerUdpPort: g.GlbServerCfg.BindUdpPort,
+		ServerUdpPort: g.GetServerCfg().BindUdpPort,
 		Error:         "",
 	}
 	msg.WriteMsg(ctl.conn, loginRespMsg)
@@ -187,6 +286,7 @@ func (ctl *Control) RegisterWorkConn(conn net.Conn) {
 	select {
 	case ctl.workConnCh <- conn:
 		ctl.conn.Debug("new work connection registered")
+		ctl.statsCollector.Mark(stats.TypeWorkConnPool, &stats.WorkConnPoolPayload{Delta: 1})
 	default:
 		ctl.conn.Debug("work connection pool is full, discarding")
 		conn.Close()
@@ -205,6 +305,16 @@ func (ctl *Control) GetWorkConn() (workConn net.Conn, err error) {
 		}
 	}()
 
+	start := time.Now()
+	defer func() {
+		if err == nil {
+			ctl.statsCollector.Mark(stats.TypeWorkConnPool, &stats.WorkConnPoolPayload{Delta: -1})
+		}
+		ctl.statsCollector.Mark(stats.TypeGetWorkConn, &stats.GetWorkConnPayload{
+			Duration: time.Since(start),
+		})
+	}()
+
 	var ok bool
 	// get a work connection from the pool
 	select {
@@ -232,7 +342,7 @@ func (ctl *Control) GetWorkConn() (workConn net.Conn, err error) {
 				return
 			}
 
-		case <-time.After(time.Duration(g.GlbServerCfg.UserConnTimeout) * time.Second):
+		case <-time.After(time.Duration(g.GetServerCfg().UserConnTimeout) * time.Second):
 			err = fmt.Errorf("timeout trying to get work connection")
 			ctl.conn.Warn("%v", err)
 			return
@@ -243,15 +353,101 @@ func (ctl *Control) GetWorkConn() (workConn net.Conn, err error) {
 	errors.PanicToError(func() {
 		ctl.sendCh <- &msg.ReqWorkConn{}
 	})
+
+	atomic.AddInt64(&ctl.activeWorkConns, 1)
+	workConn = &activeWorkConn{Conn: workConn, ctl: ctl}
 	return
 }
 
+// activeWorkConn is a work connection in use, the number of active work
+// connections of control is decreased when it's closed.
+type activeWorkConn struct {
+	net.Conn
+
+	ctl *Control
+
+	// 1 means closed
+	closeFlag int32
+}
+
+func (c *activeWorkConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closeFlag, 0, 1) {
+		atomic.AddInt64(&c.ctl.activeWorkConns, -1)
+	}
+	return c.Conn.Close()
+}
+
+// ActiveWorkConns returns the number of work connections in use.
+func (ctl *Control) ActiveWorkConns() int64 {
+	return atomic.LoadInt64(&ctl.activeWorkConns)
+}
+
+// Drain tells client to login to another frps before deadline and closes all
+// proxies so no more user connections come in. Work connections in use are
+// kept until they are closed.
+func (ctl *Control) Drain(deadline time.Time) {
+	ctl.mu.Lock()
+	if ctl.draining {
+		ctl.mu.Unlock()
+		return
+	}
+	ctl.draining = true
+	names := make([]string, 0, len(ctl.proxies))
+	for name := range ctl.proxies {
+		names = append(names, name)
+	}
+	ctl.mu.Unlock()
+
+	ctl.conn.Info("draining, client should login to another frps before %s", deadline.Format("01-02 15:04:05"))
+	errors.PanicToError(func() {
+		ctl.sendCh <- &msg.ServerDrain{
+			Deadline: deadline.Unix(),
+		}
+	})
+	for _, name := range names {
+		ctl.closeProxy(name, "frps draining")
+	}
+}
+
+func (ctl *Control) setCloseReason(reason string) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if ctl.closeReason == "" {
+		ctl.closeReason = reason
+	}
+}
+
 func (ctl *Control) Replaced(newCtl *Control) {
 	ctl.conn.Info("Replaced by client [%s]", newCtl.runId)
+	audit.Record(audit.EventKick, audit.Fields{
+		"run_id":      ctl.loginMsg.RunId,
+		"user":        ctl.loginMsg.User,
+		"remote_addr": ctl.conn.RemoteAddr().String(),
+		"reason":      fmt.Sprintf("replaced by new login from [%s]", newCtl.conn.RemoteAddr().String()),
+	})
+	ctl.setCloseReason(fmt.Sprintf("replaced by new login from [%s]", newCtl.conn.RemoteAddr().String()))
 	ctl.runId = ""
 	ctl.allShutdown.Start()
 }
 
+// Kick closes the control and all proxies of this client, it blocks until
+// the control is closed.
+func (ctl *Control) Kick(reason string) {
+	ctl.conn.Info("kicked: %s", reason)
+	audit.Record(audit.EventKick, audit.Fields{
+		"run_id":      ctl.loginMsg.RunId,
+		"user":        ctl.loginMsg.User,
+		"remote_addr": ctl.conn.RemoteAddr().String(),
+		"reason":      reason,
+	})
+	ctl.statsCollector.Mark(stats.TypeKickClient, &stats.KickClientPayload{
+		User: ctl.loginMsg.User,
+	})
+	ctl.setCloseReason(reason)
+	ctl.allShutdown.Start()
+	ctl.allShutdown.WaitDone()
+}
+
 func (ctl *Control) writer() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -263,7 +459,7 @@ func (ctl *Control) writer() {
 	defer ctl.allShutdown.Start()
 	defer ctl.writerShutdown.Done()
 
-	encWriter, err := crypto.NewWriter(ctl.conn, []byte(g.GlbServerCfg.Token))
+	encWriter, err := crypto.NewWriter(ctl.conn, []byte(ctl.token))
 	if err != nil {
 		ctl.conn.Error("crypto new writer error: %v", err)
 		ctl.allShutdown.Start()
@@ -276,6 +472,7 @@ func (ctl *Control) writer() {
 		} else {
 			if err := msg.WriteMsg(encWriter, m); err != nil {
 				ctl.conn.Warn("write message to control connection error: %v", err)
+				ctl.setCloseReason(fmt.Sprintf("write error: %v", err))
 				return
 			}
 		}
@@ -293,14 +490,16 @@ func (ctl *Control) reader() {
 	defer ctl.allShutdown.Start()
 	defer ctl.readerShutdown.Done()
 
-	encReader := crypto.NewReader(ctl.conn, []byte(g.GlbServerCfg.Token))
+	encReader := crypto.NewReader(ctl.conn, []byte(ctl.token))
 	for {
 		if m, err := msg.ReadMsg(encReader); err != nil {
 			if err == io.EOF {
 				ctl.conn.Debug("control connection closed")
+				ctl.setCloseReason("connection closed by client")
 				return
 			} else {
 				ctl.conn.Warn("read error: %v", err)
+				ctl.setCloseReason(fmt.Sprintf("read error: %v", err))
 				ctl.conn.Close()
 				return
 			}
@@ -332,9 +531,16 @@ func (ctl *Control) stoper() {
 	ctl.mu.Lock()
 	defer ctl.mu.Unlock()
 
+	// closeReason is set with ctl.mu held
+	reason := ctl.closeReason
+	if reason == "" {
+		reason = "connection closed"
+	}
+
 	close(ctl.workConnCh)
 	for workConn := range ctl.workConnCh {
 		workConn.Close()
+		ctl.statsCollector.Mark(stats.TypeWorkConnPool, &stats.WorkConnPoolPayload{Delta: -1})
 	}
 
 	for _, pxy := range ctl.proxies {
@@ -344,8 +550,11 @@ func (ctl *Control) stoper() {
 			Name:      pxy.GetName(),
 			ProxyType: pxy.GetConf().GetBaseInfo().ProxyType,
 		})
+		ctl.recordCloseProxy(pxy, "client exit")
 	}
 
+	ctl.notifyWebhook(webhook.EventClientClose, nil, reason)
+
 	ctl.allShutdown.Done()
 	ctl.conn.Info("client exit success")
 
@@ -374,8 +583,9 @@ func (ctl *Control) manager() {
 	for {
 		select {
 		case <-heartbeat.C:
-			if time.Since(ctl.lastPing) > time.Duration(g.GlbServerCfg.HeartBeatTimeout)*time.Second {
+			if time.Since(ctl.GetLastPing()) > time.Duration(g.GetServerCfg().HeartBeatTimeout)*time.Second {
 				ctl.conn.Warn("heartbeat timeout")
+				ctl.setCloseReason("heartbeat timeout")
 				return
 			}
 		case rawMsg, ok := <-ctl.readCh:
@@ -385,28 +595,64 @@ func (ctl *Control) manager() {
 
 			switch m := rawMsg.(type) {
 			case *msg.NewProxy:
-				// register proxy in this control
-				remoteAddr, err := ctl.RegisterProxy(m)
+				content := &plugin.NewProxyContent{
+					User:     ctl.getUserInfo(),
+					NewProxy: *m,
+				}
+				var remoteAddr string
+				retContent, err := ctl.rc.PluginManager.NewProxy(content)
+				if err == nil {
+					m = &retContent.NewProxy
+					// register proxy in this control
+					remoteAddr, err = ctl.RegisterProxy(m)
+				}
 				resp := &msg.NewProxyResp{
 					ProxyName: m.ProxyName,
 				}
+				auditFields := audit.Fields{
+					"run_id":            ctl.loginMsg.RunId,
+					"user":              ctl.loginMsg.User,
+					"remote_addr":       ctl.conn.RemoteAddr().String(),
+					"proxy_name":        m.ProxyName,
+					"proxy_type":        m.ProxyType,
+					"proxy_remote_addr": remoteAddr,
+				}
 				if err != nil {
 					resp.Error = err.Error()
 					ctl.conn.Warn("new proxy [%s] error: %v", m.ProxyName, err)
+					auditFields["error"] = err.Error()
 				} else {
 					resp.RemoteAddr = remoteAddr
 					ctl.conn.Info("new proxy [%s] success", m.ProxyName)
 					ctl.statsCollector.Mark(stats.TypeNewProxy, &stats.NewProxyPayload{
 						Name:      m.ProxyName,
 						ProxyType: m.ProxyType,
+						User:      ctl.loginMsg.User,
 					})
+					ctl.notifyWebhook(webhook.EventNewProxy, &webhook.ProxyInfo{
+						Name:       m.ProxyName,
+						Type:       m.ProxyType,
+						RemoteAddr: remoteAddr,
+					}, "")
 				}
+				audit.Record(audit.EventNewProxy, auditFields)
 				ctl.sendCh <- resp
 			case *msg.CloseProxy:
 				ctl.CloseProxy(m)
 				ctl.conn.Info("close proxy [%s] success", m.ProxyName)
 			case *msg.Ping:
+				if g.GetServerCfg().AuthenticateHeartBeats {
+					if err := ctl.authPrivilegeKey(util.AuthPurposePing, m.Timestamp, m.PrivilegeKey); err != nil {
+						ctl.conn.Warn("received invalid heartbeat")
+						ctl.sendCh <- &msg.Pong{
+							Error: "invalid authentication in heartbeat",
+						}
+						break
+					}
+				}
+				ctl.mu.Lock()
 				ctl.lastPing = time.Now()
+				ctl.mu.Unlock()
 				ctl.conn.Debug("receive heartbeat")
 				ctl.sendCh <- &msg.Pong{}
 			}
@@ -414,6 +660,65 @@ func (ctl *Control) manager() {
 	}
 }
 
+func (ctl *Control) GetLastPing() time.Time {
+	ctl.mu.RLock()
+	defer ctl.mu.RUnlock()
+	return ctl.lastPing
+}
+
+// GetProxies returns a copy of proxies registered by this client.
+func (ctl *Control) GetProxies() (pxys []proxy.Proxy) {
+	ctl.mu.RLock()
+	defer ctl.mu.RUnlock()
+	pxys = make([]proxy.Proxy, 0, len(ctl.proxies))
+	for _, pxy := range ctl.proxies {
+		pxys = append(pxys, pxy)
+	}
+	return
+}
+
+// authPrivilegeKey checks the privilege key for purpose in messages sent by
+// client after login, keys with a timestamp out of auth_max_clock_skew are
+// rejected.
+func (ctl *Control) authPrivilegeKey(purpose string, timestamp int64, privilegeKey string) error {
+	if err := util.CheckClockSkew(timestamp, g.GetServerCfg().AuthMaxClockSkew); err != nil {
+		return err
+	}
+	if util.GetPrivilegeKey(ctl.authScheme, ctl.token, purpose, ctl.loginMsg.RunId, timestamp) != privilegeKey {
+		return controller.ErrAuthFailed
+	}
+	return nil
+}
+
+func (ctl *Control) getUserInfo() plugin.UserInfo {
+	return plugin.UserInfo{
+		User:  ctl.loginMsg.User,
+		RunId: ctl.loginMsg.RunId,
+	}
+}
+
+// checkUserPolicy checks the proxy by the policy of its user and returns
+// max_proxies of the user, it's checked again while the proxy is added.
+func (ctl *Control) checkUserPolicy(pxyConf config.ProxyConf) (maxProxies int64, err error) {
+	if ctl.rc.UserManager == nil {
+		return
+	}
+	userConf, ok := ctl.rc.UserManager.GetUser(ctl.loginMsg.User)
+	if !ok {
+		return
+	}
+	if err = userConf.CheckProxy(pxyConf); err != nil {
+		return
+	}
+
+	// fail fast before the proxy is started
+	maxProxies = userConf.MaxProxies
+	if maxProxies > 0 && int64(ctl.pxyManager.CountByUser(userConf.User)) >= maxProxies {
+		err = fmt.Errorf("exceed the max_proxies of user [%s]", userConf.User)
+	}
+	return
+}
+
 func (ctl *Control) RegisterProxy(pxyMsg *msg.NewProxy) (remoteAddr string, err error) {
 	var pxyConf config.ProxyConf
 	// Load configures from NewProxy message and check.
@@ -422,17 +727,31 @@ func (ctl *Control) RegisterProxy(pxyMsg *msg.NewProxy) (remoteAddr string, err
 		return
 	}
 
+	// Check proxy policy of this user.
+	maxProxies, err := ctl.checkUserPolicy(pxyConf)
+	if err != nil {
+		return
+	}
+
+	ctl.mu.RLock()
+	draining := ctl.draining
+	ctl.mu.RUnlock()
+	if draining {
+		err = frpErr.ErrDraining
+		return
+	}
+
 	// NewProxy will return a interface Proxy.
 	// In fact it create different proxies by different proxy type, we just call run() here.
-	pxy, err := proxy.NewProxy(ctl.runId, ctl.rc, ctl.statsCollector, ctl.poolCount, ctl.GetWorkConn, pxyConf)
+	pxy, err := proxy.NewProxy(ctl.runId, ctl.getUserInfo(), ctl.token, ctl.rc, ctl.statsCollector, ctl.poolCount, ctl.GetWorkConn, pxyConf)
 	if err != nil {
 		return remoteAddr, err
 	}
 
 	// Check ports used number in each client
-	if g.GlbServerCfg.MaxPortsPerClient > 0 {
+	if g.GetServerCfg().MaxPortsPerClient > 0 {
 		ctl.mu.Lock()
-		if ctl.portsUsedNum+pxy.GetUsedPortsNum() > int(g.GlbServerCfg.MaxPortsPerClient) {
+		if ctl.portsUsedNum+pxy.GetUsedPortsNum() > int(g.GetServerCfg().MaxPortsPerClient) {
 			ctl.mu.Unlock()
 			err = fmt.Errorf("exceed the max_ports_per_client")
 			return
@@ -459,36 +778,105 @@ func (ctl *Control) RegisterProxy(pxyMsg *msg.NewProxy) (remoteAddr string, err
 		}
 	}()
 
-	err = ctl.pxyManager.Add(pxyMsg.ProxyName, pxy)
-	if err != nil {
+	err = ctl.pxyManager.Add(pxyMsg.ProxyName, pxy, maxProxies)
+	if err == proxy.ErrExceedMaxProxies {
+		err = fmt.Errorf("exceed the max_proxies of user [%s]", ctl.loginMsg.User)
+		return
+	} else if err != nil {
+		ctl.notifyWebhook(webhook.EventProxyConflict, &webhook.ProxyInfo{
+			Name: pxyMsg.ProxyName,
+			Type: pxyMsg.ProxyType,
+		}, err.Error())
 		return
 	}
 
 	ctl.mu.Lock()
+	if ctl.draining {
+		ctl.mu.Unlock()
+		ctl.pxyManager.Del(pxy.GetName())
+		err = frpErr.ErrDraining
+		return
+	}
 	ctl.proxies[pxy.GetName()] = pxy
 	ctl.mu.Unlock()
 	return
 }
 
 func (ctl *Control) CloseProxy(closeMsg *msg.CloseProxy) (err error) {
+	ctl.closeProxy(closeMsg.ProxyName, "closed by client")
+	return
+}
+
+// KickProxy closes the proxy and sends a CloseProxy message to client, client
+// will mark it as start error and register it again after a while.
+// It returns false if the proxy is not found.
+func (ctl *Control) KickProxy(name string, reason string) bool {
+	pxy, ok := ctl.closeProxy(name, reason)
+	if !ok {
+		return false
+	}
+	ctl.statsCollector.Mark(stats.TypeKickProxy, &stats.KickProxyPayload{
+		Name:      pxy.GetName(),
+		ProxyType: pxy.GetConf().GetBaseInfo().ProxyType,
+	})
+	errors.PanicToError(func() {
+		ctl.sendCh <- &msg.CloseProxy{
+			ProxyName: name,
+		}
+	})
+	return true
+}
+
+func (ctl *Control) closeProxy(name string, reason string) (pxy proxy.Proxy, ok bool) {
 	ctl.mu.Lock()
-	pxy, ok := ctl.proxies[closeMsg.ProxyName]
+	pxy, ok = ctl.proxies[name]
 	if !ok {
 		ctl.mu.Unlock()
 		return
 	}
 
-	if g.GlbServerCfg.MaxPortsPerClient > 0 {
+	if g.GetServerCfg().MaxPortsPerClient > 0 {
 		ctl.portsUsedNum = ctl.portsUsedNum - pxy.GetUsedPortsNum()
 	}
 	pxy.Close()
 	ctl.pxyManager.Del(pxy.GetName())
-	delete(ctl.proxies, closeMsg.ProxyName)
+	delete(ctl.proxies, name)
 	ctl.mu.Unlock()
 
 	ctl.statsCollector.Mark(stats.TypeCloseProxy, &stats.CloseProxyPayload{
 		Name:      pxy.GetName(),
 		ProxyType: pxy.GetConf().GetBaseInfo().ProxyType,
 	})
+	ctl.recordCloseProxy(pxy, reason)
 	return
 }
+
+// recordCloseProxy writes the audit log and notifies webhooks of a closed proxy.
+func (ctl *Control) recordCloseProxy(pxy proxy.Proxy, reason string) {
+	audit.Record(audit.EventCloseProxy, audit.Fields{
+		"run_id":     ctl.loginMsg.RunId,
+		"user":       ctl.loginMsg.User,
+		"proxy_name": pxy.GetName(),
+		"proxy_type": pxy.GetConf().GetBaseInfo().ProxyType,
+		"reason":     reason,
+	})
+	ctl.notifyWebhook(webhook.EventCloseProxy, &webhook.ProxyInfo{
+		Name: pxy.GetName(),
+		Type: pxy.GetConf().GetBaseInfo().ProxyType,
+	}, reason)
+}
+
+func (ctl *Control) notifyWebhook(event string, pxyInfo *webhook.ProxyInfo, reason string) {
+	ctl.rc.WebhookManager.Notify(&webhook.Event{
+		Event:      event,
+		RunId:      ctl.loginMsg.RunId,
+		User:       ctl.loginMsg.User,
+		Hostname:   ctl.loginMsg.Hostname,
+		Os:         ctl.loginMsg.Os,
+		Arch:       ctl.loginMsg.Arch,
+		Version:    ctl.loginMsg.Version,
+		RemoteAddr: ctl.conn.RemoteAddr().String(),
+		Proxy:      pxyInfo,
+		Reason:     reason,
+	})
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/msg"
+	"github.com/whysmx/frp/models/webhook"
+	"github.com/whysmx/frp/server/controller"
+	"github.com/whysmx/frp/server/proxy"
+	"github.com/whysmx/frp/server/stats"
+	frpNet "github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUserResourceController(t *testing.T, content string) *controller.ResourceController {
+	users, err := config.LoadAllUserConfFromIni(content)
+	assert.NoError(t, err)
+	um := controller.NewUserManager()
+	um.Reload(users)
+	return &controller.ResourceController{
+		UserManager:    um,
+		VisitorManager: controller.NewVisitorManager(util.NewReplayFilter(0, 0), util.AuthSchemeMd5),
+		WebhookManager: webhook.NewManager(),
+	}
+}
+
+func newTestStcpProxyMsg(name string) *msg.NewProxy {
+	return &msg.NewProxy{
+		ProxyName: name,
+		ProxyType: "stcp",
+		Sk:        "abcdefg",
+	}
+}
+
+func TestRegisterProxyMaxProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newTestUserResourceController(t, "[alice]\ntoken = 123\nmax_proxies = 2\nallow_proxy_types = stcp\n")
+	pxyManager := proxy.NewProxyManager()
+	collector := stats.NewInternalCollector(false, 0, "", 0)
+	c1, _ := net.Pipe()
+	defer c1.Close()
+	ctl := NewControl(rc, pxyManager, collector, frpNet.WrapConn(c1), &msg.Login{User: "alice", RunId: "run1"}, "123", util.AuthSchemeMd5)
+
+	_, err := ctl.RegisterProxy(newTestStcpProxyMsg("alice.a"))
+	assert.NoError(err)
+	_, err = ctl.RegisterProxy(newTestStcpProxyMsg("alice.b"))
+	assert.NoError(err)
+	_, err = ctl.RegisterProxy(newTestStcpProxyMsg("alice.c"))
+	assert.Error(err)
+
+	// rejected by the policy of the user
+	_, err = ctl.RegisterProxy(&msg.NewProxy{ProxyName: "alice.d", ProxyType: "xtcp", Sk: "abcdefg"})
+	assert.Error(err)
+	assert.Equal(2, pxyManager.CountByUser("alice"))
+
+	ctl.closeProxy("alice.a", "test")
+	ctl.closeProxy("alice.b", "test")
+	assert.Equal(0, pxyManager.CountByUser("alice"))
+}
+
+func TestRegisterProxyMaxProxiesConcurrently(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newTestUserResourceController(t, "[alice]\ntoken = 123\nmax_proxies = 2\n")
+	pxyManager := proxy.NewProxyManager()
+	collector := stats.NewInternalCollector(false, 0, "", 0)
+
+	// proxies of one user are registered by several clients at the same time
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		success int
+	)
+	for i := 0; i < 5; i++ {
+		ctl := NewControl(rc, pxyManager, collector, nil,
+			&msg.Login{User: "alice", RunId: fmt.Sprintf("run%d", i)}, "123", util.AuthSchemeMd5)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(ctl *Control, name string) {
+				defer wg.Done()
+				if _, err := ctl.RegisterProxy(newTestStcpProxyMsg(name)); err == nil {
+					mu.Lock()
+					success++
+					mu.Unlock()
+				}
+			}(ctl, fmt.Sprintf("alice.%d.%d", i, j))
+		}
+	}
+	wg.Wait()
+	assert.Equal(2, success)
+	assert.Equal(2, pxyManager.CountByUser("alice"))
+}
+
+func TestNewControlPoolCount(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := *g.GetServerCfg()
+	cfg.MaxPoolCount = 5
+	defaultCfg := g.GetServerCfg()
+	g.SetServerCfg(&cfg)
+	defer g.SetServerCfg(defaultCfg)
+
+	rc := newTestUserResourceController(t, "[alice]\ntoken = 123\nmax_pool_count = 3\n\n[bob]\ntoken = 456\n")
+	pxyManager := proxy.NewProxyManager()
+	collector := stats.NewInternalCollector(false, 0, "", 0)
+
+	testcases := []struct {
+		user      string
+		poolCount int
+		expected  int
+	}{
+		{"alice", 10, 3},
+		{"alice", 2, 2},
+		{"bob", 10, 5},
+		{"bob", 4, 4},
+		{"carol", 10, 5},
+	}
+	for _, tc := range testcases {
+		ctl := NewControl(rc, pxyManager, collector, nil, &msg.Login{User: tc.user, PoolCount: tc.poolCount}, "", util.AuthSchemeMd5)
+		assert.Equal(tc.expected, ctl.poolCount, "user %s, pool_count %d", tc.user, tc.poolCount)
+	}
+}
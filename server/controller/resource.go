@@ -16,6 +16,8 @@ package controller
 
 import (
 	"github.com/whysmx/frp/models/nathole"
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/webhook"
 	"github.com/whysmx/frp/server/group"
 	"github.com/whysmx/frp/server/ports"
 	"github.com/whysmx/frp/utils/vhost"
@@ -43,4 +45,13 @@ type ResourceController struct {
 
 	// Controller for nat hole connections
 	NatHoleController *nathole.NatHoleController
+
+	// Manage users loaded from users_file, it's nil if users_file is not set
+	UserManager *UserManager
+
+	// All server manager plugin
+	PluginManager *plugin.Manager
+
+	// Send lifecycle events of clients and proxies to webhooks
+	WebhookManager *webhook.Manager
 }
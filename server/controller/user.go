@@ -0,0 +1,79 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/utils/util"
+)
+
+var (
+	ErrAuthFailed = fmt.Errorf("authorization failed")
+)
+
+// Manager for users loaded from users_file.
+type UserManager struct {
+	users map[string]*config.UserConf
+
+	mu sync.RWMutex
+}
+
+func NewUserManager() *UserManager {
+	return &UserManager{
+		users: make(map[string]*config.UserConf),
+	}
+}
+
+func (um *UserManager) Reload(users map[string]*config.UserConf) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.users = users
+}
+
+func (um *UserManager) GetUser(name string) (cfg *config.UserConf, ok bool) {
+	um.mu.RLock()
+	defer um.mu.RUnlock()
+	cfg, ok = um.users[name]
+	return
+}
+
+// Auth checks the privilege key sent by user with all schemes not weaker than
+// minScheme, and returns the token of this user and the scheme of the key.
+// Reason of failure is only returned to the caller after the privilege key is verified.
+func (um *UserManager) Auth(name string, minScheme string, timestamp int64, privilegeKey string) (token string, authScheme string, err error) {
+	cfg, ok := um.GetUser(name)
+	if !ok {
+		err = ErrAuthFailed
+		return
+	}
+	if authScheme, ok = util.CheckAuthKey(minScheme, cfg.Token, timestamp, privilegeKey); !ok {
+		err = ErrAuthFailed
+		return
+	}
+	if !cfg.Enable {
+		err = fmt.Errorf("user [%s] is disabled", name)
+		return
+	}
+	if cfg.IsExpired(time.Now()) {
+		err = fmt.Errorf("user [%s] is expired", name)
+		return
+	}
+	token = cfg.Token
+	return
+}
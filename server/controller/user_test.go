@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/utils/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserManagerAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	um := NewUserManager()
+	um.Reload(map[string]*config.UserConf{
+		"alice":   {User: "alice", Token: "123", Enable: true},
+		"bob":     {User: "bob", Token: "456", Enable: false},
+		"carol":   {User: "carol", Token: "789", Enable: true, ExpireTime: time.Now().Add(-time.Hour)},
+		"charlie": {User: "charlie", Token: "abc", Enable: true, ExpireTime: time.Now().Add(time.Hour)},
+	})
+
+	now := time.Now().Unix()
+	key := func(token string) string {
+		return util.GetAuthKeyWithScheme(util.AuthSchemeHmacSha256, token, now)
+	}
+
+	token, scheme, err := um.Auth("alice", util.AuthSchemeMd5, now, key("123"))
+	assert.NoError(err)
+	assert.Equal("123", token)
+	assert.Equal(util.AuthSchemeHmacSha256, scheme)
+
+	token, _, err = um.Auth("charlie", util.AuthSchemeMd5, now, key("abc"))
+	assert.NoError(err)
+	assert.Equal("abc", token)
+
+	// md5 keys are accepted unless min_auth_scheme is hmac_sha256
+	md5Key := util.GetAuthKeyWithScheme(util.AuthSchemeMd5, "123", now)
+	token, scheme, err = um.Auth("alice", util.AuthSchemeMd5, now, md5Key)
+	assert.NoError(err)
+	assert.Equal("123", token)
+	assert.Equal(util.AuthSchemeMd5, scheme)
+	_, _, err = um.Auth("alice", util.AuthSchemeHmacSha256, now, md5Key)
+	assert.Equal(ErrAuthFailed, err)
+	_, _, err = um.Auth("alice", util.AuthSchemeHmacSha256, now, key("123"))
+	assert.NoError(err)
+
+	// key of another token
+	_, _, err = um.Auth("alice", util.AuthSchemeMd5, now, key("456"))
+	assert.Equal(ErrAuthFailed, err)
+	_, _, err = um.Auth("dave", util.AuthSchemeMd5, now, key("123"))
+	assert.Equal(ErrAuthFailed, err)
+
+	// disabled and expired users are only reported with the right key
+	_, _, err = um.Auth("bob", util.AuthSchemeMd5, now, key("456"))
+	assert.EqualError(err, "user [bob] is disabled")
+	_, _, err = um.Auth("bob", util.AuthSchemeMd5, now, key("123"))
+	assert.Equal(ErrAuthFailed, err)
+	_, _, err = um.Auth("carol", util.AuthSchemeMd5, now, key("789"))
+	assert.EqualError(err, "user [carol] is expired")
+
+	um.Reload(map[string]*config.UserConf{})
+	_, _, err = um.Auth("alice", util.AuthSchemeMd5, now, key("123"))
+	assert.Equal(ErrAuthFailed, err)
+}
@@ -18,7 +18,12 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/consts"
+	"github.com/whysmx/frp/models/msg"
+	"github.com/whysmx/frp/utils/accesslog"
 	frpNet "github.com/whysmx/frp/utils/net"
 	"github.com/whysmx/frp/utils/util"
 
@@ -29,18 +34,38 @@ import (
 type VisitorManager struct {
 	visitorListeners map[string]*frpNet.CustomListener
 	skMap            map[string]string
+	sksMap           map[string][]msg.SecretKey
+	ownerMap         map[string]string
+
+	// Users allowed to visit each listener, empty means all users.
+	allowUsersMap map[string][]string
+
+	// Reject visitor connections with expired timestamps or used sign keys.
+	replayFilter *util.ReplayFilter
+
+	// Sign keys created by weaker auth schemes are rejected.
+	minAuthScheme string
 
 	mu sync.RWMutex
 }
 
-func NewVisitorManager() *VisitorManager {
+func NewVisitorManager(replayFilter *util.ReplayFilter, minAuthScheme string) *VisitorManager {
 	return &VisitorManager{
 		visitorListeners: make(map[string]*frpNet.CustomListener),
 		skMap:            make(map[string]string),
+		sksMap:           make(map[string][]msg.SecretKey),
+		ownerMap:         make(map[string]string),
+		allowUsersMap:    make(map[string][]string),
+		replayFilter:     replayFilter,
+		minAuthScheme:    minAuthScheme,
 	}
 }
 
-func (vm *VisitorManager) Listen(name string, sk string) (l *frpNet.CustomListener, err error) {
+// Listen creates a listener for visitors of proxy [name]. Visitors can use sk
+// or any key in sks not expired. The owner of the proxy is always allowed if
+// allowUsers is not empty.
+func (vm *VisitorManager) Listen(name string, sk string, sks []msg.SecretKey,
+	owner string, allowUsers []string) (l *frpNet.CustomListener, err error) {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
@@ -52,21 +77,58 @@ func (vm *VisitorManager) Listen(name string, sk string) (l *frpNet.CustomListen
 	l = frpNet.NewCustomListener()
 	vm.visitorListeners[name] = l
 	vm.skMap[name] = sk
+	vm.sksMap[name] = sks
+	vm.ownerMap[name] = owner
+	if len(allowUsers) > 0 {
+		vm.allowUsersMap[name] = append([]string{owner}, allowUsers...)
+	}
 	return
 }
 
-func (vm *VisitorManager) NewConn(name string, conn frpNet.Conn, timestamp int64, signKey string,
-	useEncryption bool, useCompression bool) (err error) {
+// NewConn puts a visitor connection from user into the listener of proxy [name].
+// It returns the fingerprint of the secret key used by the visitor.
+func (vm *VisitorManager) NewConn(name string, conn frpNet.Conn, user string, timestamp int64, nonce string, signKey string,
+	useEncryption bool, useCompression bool) (skFingerprint string, err error) {
 
 	vm.mu.RLock()
 	defer vm.mu.RUnlock()
 
+	// Accepted connections are written to access log by the proxy.
+	defer func() {
+		if err != nil {
+			now := time.Now()
+			accesslog.Record(now, now, &accesslog.Entry{
+				ProxyName:   name,
+				ProxyType:   consts.StcpProxy,
+				User:        vm.ownerMap[name],
+				RemoteAddr:  conn.RemoteAddr().String(),
+				CloseReason: accesslog.ReasonRejected,
+				Error:       err.Error(),
+			})
+		}
+	}()
+
 	if l, ok := vm.visitorListeners[name]; ok {
 		var sk string
-		if sk = vm.skMap[name]; util.GetAuthKey(sk, timestamp) != signKey {
+		for _, validSk := range config.GetValidSks(vm.skMap[name], vm.sksMap[name], time.Now()) {
+			if util.CheckVisitorAuthKey(vm.minAuthScheme, validSk, timestamp, nonce, signKey) {
+				sk = validSk
+				break
+			}
+		}
+		if sk == "" {
 			err = fmt.Errorf("visitor connection of [%s] auth failed", name)
 			return
 		}
+		skFingerprint = util.GetSkFingerprint(sk)
+		if err = vm.replayFilter.Check(signKey, timestamp); err != nil {
+			err = fmt.Errorf("visitor connection of [%s] rejected: %v", name, err)
+			return
+		}
+		if !config.IsVisitorUserAllowed(vm.allowUsersMap[name], user) {
+			err = fmt.Errorf("visitor connection of [%s] from user [%s] is not allowed", name, user)
+			return
+		}
 
 		var rwc io.ReadWriteCloser = conn
 		if useEncryption {
@@ -92,4 +154,7 @@ func (vm *VisitorManager) CloseListener(name string) {
 
 	delete(vm.visitorListeners, name)
 	delete(vm.skMap, name)
+	delete(vm.sksMap, name)
+	delete(vm.ownerMap, name)
+	delete(vm.allowUsersMap, name)
 }
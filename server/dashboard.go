@@ -36,14 +36,30 @@ func (svr *Service) RunDashboardServer(addr string, port int) (err error) {
 	// url router
 	router := mux.NewRouter()
 
-	user, passwd := g.GlbServerCfg.DashboardUser, g.GlbServerCfg.DashboardPwd
-	router.Use(frpNet.NewHttpAuthMiddleware(user, passwd).Middleware)
+	user, passwd := g.GetServerCfg().DashboardUser, g.GetServerCfg().DashboardPwd
+	svr.dashboardAuth = frpNet.NewHttpAuthMiddleware(user, passwd)
+	router.Use(svr.dashboardAuth.Middleware)
 
 	// api, see dashboard_api.go
 	router.HandleFunc("/api/serverinfo", svr.ApiServerInfo).Methods("GET")
+	router.HandleFunc("/api/reload", svr.ApiReload).Methods("POST")
+	router.HandleFunc("/api/drain", svr.ApiDrain).Methods("POST")
 	router.HandleFunc("/api/proxy/{type}", svr.ApiProxyByType).Methods("GET")
 	router.HandleFunc("/api/proxy/{type}/{name}", svr.ApiProxyByTypeAndName).Methods("GET")
+	router.HandleFunc("/api/traffic", svr.ApiServerTraffic).Methods("GET")
 	router.HandleFunc("/api/traffic/{name}", svr.ApiProxyTraffic).Methods("GET")
+	router.HandleFunc("/api/ports", svr.ApiPorts).Methods("GET")
+	router.HandleFunc("/api/clients", svr.ApiClients).Methods("GET")
+	router.HandleFunc("/api/clients/{runId}", svr.ApiClientByRunId).Methods("GET")
+	router.HandleFunc("/api/clients", svr.ApiKickClientsByUser).Methods("DELETE")
+	router.HandleFunc("/api/clients/{runId}", svr.ApiKickClientByRunId).Methods("DELETE")
+	router.HandleFunc("/api/proxy/{type}/{name}", svr.ApiCloseProxy).Methods("DELETE")
+	router.HandleFunc("/api/proxy/{type}/{name}/conns", svr.ApiProxyConns).Methods("GET")
+	router.HandleFunc("/api/proxy/{type}/{name}/conns/{id}", svr.ApiCloseProxyConn).Methods("DELETE")
+
+	if svr.promCollector != nil {
+		router.Handle("/metrics", svr.promCollector).Methods("GET")
+	}
 
 	// view
 	router.Handle("/favicon.ico", http.FileServer(assets.FileSystem)).Methods("GET")
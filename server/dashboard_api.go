@@ -16,11 +16,20 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/whysmx/frp/g"
 	"github.com/whysmx/frp/models/config"
 	"github.com/whysmx/frp/models/consts"
+	"github.com/whysmx/frp/server/ports"
+	"github.com/whysmx/frp/server/stats"
+	"github.com/whysmx/frp/utils/accesslog"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
 	"github.com/whysmx/frp/utils/version"
 
@@ -49,6 +58,13 @@ type ServerInfoResp struct {
 	CurConns        int64            `json:"cur_conns"`
 	ClientCounts    int64            `json:"client_counts"`
 	ProxyTypeCounts map[string]int64 `json:"proxy_type_count"`
+
+	LoginFailedCounts   int64  `json:"login_failed_counts"`
+	LastLoginFailedUser string `json:"last_login_failed_user"`
+	LastLoginFailedTime string `json:"last_login_failed_time"`
+
+	KickedClientCounts int64 `json:"kicked_client_counts"`
+	KickedProxyCounts  int64 `json:"kicked_proxy_counts"`
 }
 
 // api/serverinfo
@@ -63,7 +79,7 @@ func (svr *Service) ApiServerInfo(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	log.Info("Http request: [%s]", r.URL.Path)
-	cfg := &g.GlbServerCfg.ServerCommonConf
+	cfg := &g.GetServerCfg().ServerCommonConf
 	serverStats := svr.statsCollector.GetServer()
 	svrResp := ServerInfoResp{
 		Version:           version.Full(),
@@ -82,12 +98,84 @@ func (svr *Service) ApiServerInfo(w http.ResponseWriter, r *http.Request) {
 		CurConns:        serverStats.CurConns,
 		ClientCounts:    serverStats.ClientCounts,
 		ProxyTypeCounts: serverStats.ProxyTypeCounts,
+
+		LoginFailedCounts:   serverStats.LoginFailedCounts,
+		LastLoginFailedUser: serverStats.LastLoginFailedUser,
+		LastLoginFailedTime: serverStats.LastLoginFailedTime,
+
+		KickedClientCounts: serverStats.KickedClientCounts,
+		KickedProxyCounts:  serverStats.KickedProxyCounts,
 	}
 
 	buf, _ := json.Marshal(&svrResp)
 	res.Msg = string(buf)
 }
 
+// POST api/reload
+func (svr *Service) ApiReload(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	reloadResult, err := svr.ReloadConf(fmt.Sprintf("dashboard [%s]", r.RemoteAddr))
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		log.Warn("reload frps conf error: %v", err)
+		return
+	}
+
+	buf, _ := json.Marshal(reloadResult)
+	res.Msg = string(buf)
+}
+
+type DrainResp struct {
+	Deadline string `json:"deadline"`
+}
+
+// api/drain
+// ?timeout=seconds, drain_timeout is used if not set
+func (svr *Service) ApiDrain(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	timeout := g.GetServerCfg().DrainTimeout
+	if str := r.URL.Query().Get("timeout"); str != "" {
+		v, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || v < 0 {
+			res.Code = 400
+			res.Msg = "invalid timeout"
+			return
+		}
+		timeout = v
+	}
+
+	deadline, err := svr.Drain(time.Duration(timeout)*time.Second, fmt.Sprintf("dashboard [%s]", r.RemoteAddr))
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	buf, _ := json.Marshal(&DrainResp{
+		Deadline: deadline.Format("01-02 15:04:05"),
+	})
+	res.Msg = string(buf)
+}
+
 type BaseOutConf struct {
 	config.BaseProxyConf
 }
@@ -144,6 +232,7 @@ func getConfByType(proxyType string) interface{} {
 // Get proxy info.
 type ProxyStatsInfo struct {
 	Name            string      `json:"name"`
+	User            string      `json:"user"`
 	Conf            interface{} `json:"conf"`
 	TodayTrafficIn  int64       `json:"today_traffic_in"`
 	TodayTrafficOut int64       `json:"today_traffic_out"`
@@ -200,6 +289,7 @@ func (svr *Service) getProxyStatsByType(proxyType string) (proxyInfos []*ProxySt
 			proxyInfo.Status = consts.Offline
 		}
 		proxyInfo.Name = ps.Name
+		proxyInfo.User = ps.User
 		proxyInfo.TodayTrafficIn = ps.TodayTrafficIn
 		proxyInfo.TodayTrafficOut = ps.TodayTrafficOut
 		proxyInfo.CurConns = ps.CurConns
@@ -213,6 +303,7 @@ func (svr *Service) getProxyStatsByType(proxyType string) (proxyInfos []*ProxySt
 // Get proxy info by name.
 type GetProxyStatsResp struct {
 	Name            string      `json:"name"`
+	User            string      `json:"user"`
 	Conf            interface{} `json:"conf"`
 	TodayTrafficIn  int64       `json:"today_traffic_in"`
 	TodayTrafficOut int64       `json:"today_traffic_out"`
@@ -274,6 +365,7 @@ func (svr *Service) getProxyStatsByTypeAndName(proxyType string, proxyName strin
 		} else {
 			proxyInfo.Status = consts.Offline
 		}
+		proxyInfo.User = ps.User
 		proxyInfo.TodayTrafficIn = ps.TodayTrafficIn
 		proxyInfo.TodayTrafficOut = ps.TodayTrafficOut
 		proxyInfo.CurConns = ps.CurConns
@@ -287,9 +379,10 @@ func (svr *Service) getProxyStatsByTypeAndName(proxyType string, proxyName strin
 
 // api/traffic/:name
 type GetProxyTrafficResp struct {
-	Name       string  `json:"name"`
-	TrafficIn  []int64 `json:"traffic_in"`
-	TrafficOut []int64 `json:"traffic_out"`
+	Name        string  `json:"name"`
+	Granularity string  `json:"granularity"`
+	TrafficIn   []int64 `json:"traffic_in"`
+	TrafficOut  []int64 `json:"traffic_out"`
 }
 
 func (svr *Service) ApiProxyTraffic(w http.ResponseWriter, r *http.Request) {
@@ -306,19 +399,528 @@ func (svr *Service) ApiProxyTraffic(w http.ResponseWriter, r *http.Request) {
 	}()
 	log.Info("Http request: [%s]", r.URL.Path)
 
+	granularity, days, err := parseTrafficQuery(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
 	trafficResp := GetProxyTrafficResp{}
 	trafficResp.Name = name
-	proxyTrafficInfo := svr.statsCollector.GetProxyTraffic(name)
+	trafficResp.Granularity = granularity
+	proxyTrafficInfo := svr.statsCollector.GetProxyTraffic(name, granularity)
 
 	if proxyTrafficInfo == nil {
 		res.Code = 404
 		res.Msg = "no proxy info found"
 		return
 	} else {
-		trafficResp.TrafficIn = proxyTrafficInfo.TrafficIn
-		trafficResp.TrafficOut = proxyTrafficInfo.TrafficOut
+		trafficResp.TrafficIn = limitCounts(proxyTrafficInfo.TrafficIn, days)
+		trafficResp.TrafficOut = limitCounts(proxyTrafficInfo.TrafficOut, days)
+	}
+
+	buf, _ := json.Marshal(&trafficResp)
+	res.Msg = string(buf)
+}
+
+// api/traffic
+func (svr *Service) ApiServerTraffic(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	granularity, days, err := parseTrafficQuery(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	trafficInfo := svr.statsCollector.GetServerTraffic(granularity)
+	trafficResp := GetProxyTrafficResp{
+		Granularity: granularity,
+		TrafficIn:   limitCounts(trafficInfo.TrafficIn, days),
+		TrafficOut:  limitCounts(trafficInfo.TrafficOut, days),
 	}
 
 	buf, _ := json.Marshal(&trafficResp)
 	res.Msg = string(buf)
 }
+
+// parseTrafficQuery parses query parameters "granularity" and "days".
+// Traffic of last 7 days is returned by default for dashboard charts, more
+// days are available if stats_reserve_days is larger. Days is ignored for
+// other granularities.
+func parseTrafficQuery(r *http.Request) (granularity string, days int, err error) {
+	granularity = r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = stats.GranularityDay
+	} else if !stats.IsValidGranularity(granularity) {
+		err = fmt.Errorf("invalid granularity")
+		return
+	}
+
+	if granularity != stats.GranularityDay {
+		return
+	}
+	days = stats.ReserveDays
+	if str := r.URL.Query().Get("days"); str != "" {
+		v, errRet := strconv.Atoi(str)
+		if errRet != nil || v <= 0 {
+			err = fmt.Errorf("invalid days")
+			return
+		}
+		days = v
+	}
+	return
+}
+
+// limitCounts returns the first n counts, all counts are returned if n is 0.
+func limitCounts(counts []int64, n int) []int64 {
+	if n > 0 && n < len(counts) {
+		return counts[:n]
+	}
+	return counts
+}
+
+// Get connected clients info.
+type ClientProxyInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type ClientInfo struct {
+	RunId         string             `json:"run_id"`
+	User          string             `json:"user"`
+	Hostname      string             `json:"hostname"`
+	Os            string             `json:"os"`
+	Arch          string             `json:"arch"`
+	Version       string             `json:"version"`
+	RemoteIp      string             `json:"remote_ip"`
+	LoginTime     string             `json:"login_time"`
+	LastHeartbeat string             `json:"last_heartbeat"`
+	Proxies       []*ClientProxyInfo `json:"proxies"`
+}
+
+type GetClientsResp struct {
+	Clients []*ClientInfo `json:"clients"`
+}
+
+// api/clients
+func (svr *Service) ApiClients(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	ctls := svr.ctlManager.GetAll()
+	clientsResp := GetClientsResp{
+		Clients: make([]*ClientInfo, 0, len(ctls)),
+	}
+	for _, ctl := range ctls {
+		clientsResp.Clients = append(clientsResp.Clients, getClientInfo(ctl))
+	}
+	sort.Slice(clientsResp.Clients, func(i, j int) bool {
+		a, b := clientsResp.Clients[i], clientsResp.Clients[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		return a.RunId < b.RunId
+	})
+
+	buf, _ := json.Marshal(&clientsResp)
+	res.Msg = string(buf)
+}
+
+// api/clients/:runId
+func (svr *Service) ApiClientByRunId(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	params := mux.Vars(r)
+	runId := params["runId"]
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	ctl, ok := svr.ctlManager.GetById(runId)
+	if !ok {
+		res.Code = 404
+		res.Msg = "no client info found"
+		return
+	}
+
+	buf, _ := json.Marshal(getClientInfo(ctl))
+	res.Msg = string(buf)
+}
+
+// getClientInfo uses ctl.loginMsg.RunId which is not changed after login,
+// ctl.runId is cleared when the client is replaced.
+func getClientInfo(ctl *Control) *ClientInfo {
+	info := &ClientInfo{
+		RunId:         ctl.loginMsg.RunId,
+		User:          ctl.loginMsg.User,
+		Hostname:      ctl.loginMsg.Hostname,
+		Os:            ctl.loginMsg.Os,
+		Arch:          ctl.loginMsg.Arch,
+		Version:       ctl.loginMsg.Version,
+		LoginTime:     ctl.loginTime.Format("01-02 15:04:05"),
+		LastHeartbeat: ctl.GetLastPing().Format("01-02 15:04:05"),
+	}
+	remoteAddr := ctl.conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		info.RemoteIp = host
+	} else {
+		info.RemoteIp = remoteAddr
+	}
+
+	pxys := ctl.GetProxies()
+	info.Proxies = make([]*ClientProxyInfo, 0, len(pxys))
+	for _, pxy := range pxys {
+		info.Proxies = append(info.Proxies, &ClientProxyInfo{
+			Name: pxy.GetName(),
+			Type: pxy.GetConf().GetBaseInfo().ProxyType,
+		})
+	}
+	sort.Slice(info.Proxies, func(i, j int) bool {
+		return info.Proxies[i].Name < info.Proxies[j].Name
+	})
+	return info
+}
+
+// Kick clients and close proxies.
+type KickClientsResp struct {
+	RunIds []string `json:"run_ids"`
+}
+
+// getBlockDuration parses the optional query parameter "block", seconds that
+// kicked clients are not allowed to login again.
+func getBlockDuration(r *http.Request) (d time.Duration, err error) {
+	str := r.URL.Query().Get("block")
+	if str == "" {
+		return
+	}
+	v, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || v < 0 {
+		err = fmt.Errorf("invalid block")
+		return
+	}
+	d = time.Duration(v) * time.Second
+	return
+}
+
+func kickReason(r *http.Request, block time.Duration) string {
+	reason := fmt.Sprintf("kicked from dashboard [%s]", r.RemoteAddr)
+	if block > 0 {
+		reason += fmt.Sprintf(", blocked for %v", block)
+	}
+	return reason
+}
+
+// DELETE api/clients/:runId
+func (svr *Service) ApiKickClientByRunId(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	params := mux.Vars(r)
+	runId := params["runId"]
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	block, err := getBlockDuration(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	ctl, ok := svr.ctlManager.GetById(runId)
+	if !ok {
+		res.Code = 404
+		res.Msg = "no client info found"
+		return
+	}
+	if block > 0 {
+		svr.ctlManager.BlockRunId(runId, block)
+	}
+	ctl.Kick(kickReason(r, block))
+
+	buf, _ := json.Marshal(&KickClientsResp{RunIds: []string{runId}})
+	res.Msg = string(buf)
+}
+
+// DELETE api/clients?user=
+func (svr *Service) ApiKickClientsByUser(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	user := r.URL.Query().Get("user")
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	if user == "" {
+		res.Code = 400
+		res.Msg = "user is required"
+		return
+	}
+	block, err := getBlockDuration(r)
+	if err != nil {
+		res.Code = 400
+		res.Msg = err.Error()
+		return
+	}
+
+	// Block first so the kicked clients can't login again before all of them are closed.
+	if block > 0 {
+		svr.ctlManager.BlockUser(user, block)
+	}
+	kickResp := KickClientsResp{
+		RunIds: make([]string, 0),
+	}
+	for _, ctl := range svr.ctlManager.GetByUser(user) {
+		ctl.Kick(kickReason(r, block))
+		kickResp.RunIds = append(kickResp.RunIds, ctl.loginMsg.RunId)
+	}
+
+	buf, _ := json.Marshal(&kickResp)
+	res.Msg = string(buf)
+}
+
+// DELETE api/proxy/:type/:name
+func (svr *Service) ApiCloseProxy(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	params := mux.Vars(r)
+	proxyType := params["type"]
+	name := params["name"]
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	pxy, ok := svr.pxyManager.GetByName(name)
+	if !ok || pxy.GetConf().GetBaseInfo().ProxyType != proxyType {
+		res.Code = 404
+		res.Msg = "no proxy info found"
+		return
+	}
+	ctl, ok := svr.ctlManager.GetById(pxy.GetUserInfo().RunId)
+	if !ok || !ctl.KickProxy(name, fmt.Sprintf("closed from dashboard [%s]", r.RemoteAddr)) {
+		res.Code = 404
+		res.Msg = "no proxy info found"
+		return
+	}
+}
+
+type UserConnInfo struct {
+	Id         string `json:"id"`
+	RemoteAddr string `json:"remote_addr"`
+	StartTime  string `json:"start_time"`
+	TrafficIn  int64  `json:"traffic_in"`
+	TrafficOut int64  `json:"traffic_out"`
+}
+
+type GetProxyConnsResp struct {
+	Conns []*UserConnInfo `json:"conns"`
+}
+
+// api/proxy/:type/:name/conns
+func (svr *Service) ApiProxyConns(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	params := mux.Vars(r)
+	proxyType := params["type"]
+	name := params["name"]
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	pxy, ok := svr.pxyManager.GetByName(name)
+	if !ok || pxy.GetConf().GetBaseInfo().ProxyType != proxyType {
+		res.Code = 404
+		res.Msg = "no proxy info found"
+		return
+	}
+
+	ucs := pxy.GetUserConnManager().GetAll()
+	resp := &GetProxyConnsResp{
+		Conns: make([]*UserConnInfo, 0, len(ucs)),
+	}
+	for _, uc := range ucs {
+		resp.Conns = append(resp.Conns, &UserConnInfo{
+			Id:         uc.Id,
+			RemoteAddr: uc.RemoteAddr().String(),
+			StartTime:  uc.StartTime.Format("01-02 15:04:05"),
+			TrafficIn:  uc.TrafficIn(),
+			TrafficOut: uc.TrafficOut(),
+		})
+	}
+
+	buf, _ := json.Marshal(resp)
+	res.Msg = string(buf)
+}
+
+// api/proxy/:type/:name/conns/:id
+func (svr *Service) ApiCloseProxyConn(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	params := mux.Vars(r)
+	proxyType := params["type"]
+	name := params["name"]
+	id := params["id"]
+
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	pxy, ok := svr.pxyManager.GetByName(name)
+	if !ok || pxy.GetConf().GetBaseInfo().ProxyType != proxyType {
+		res.Code = 404
+		res.Msg = "no proxy info found"
+		return
+	}
+	uc, ok := pxy.GetUserConnManager().GetById(id)
+	if !ok {
+		res.Code = 404
+		res.Msg = "no connection info found"
+		return
+	}
+
+	pxy.Info("close user connection [%s] from dashboard [%s]", uc.RemoteAddr().String(), r.RemoteAddr)
+	audit.Record(audit.EventCloseUserConn, audit.Fields{
+		"run_id":      pxy.GetUserInfo().RunId,
+		"user":        pxy.GetUserInfo().User,
+		"proxy_name":  name,
+		"proxy_type":  proxyType,
+		"remote_addr": uc.RemoteAddr().String(),
+		"traffic_in":  uc.TrafficIn(),
+		"traffic_out": uc.TrafficOut(),
+		"reason":      fmt.Sprintf("closed from dashboard [%s]", r.RemoteAddr),
+	})
+	uc.CloseWithReason(accesslog.ReasonClosedFromDashboard)
+}
+
+type PortInfo struct {
+	Port       int    `json:"port"`
+	ProxyName  string `json:"proxy_name"`
+	User       string `json:"user"`
+	UpdateTime string `json:"update_time"`
+}
+
+type StaticPortInfo struct {
+	Port      int    `json:"port"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	ProxyName string `json:"proxy_name"`
+	InUse     bool   `json:"in_use"`
+}
+
+type PortsUsage struct {
+	Used           []*PortInfo       `json:"used"`
+	Reserved       []*PortInfo       `json:"reserved"`
+	StaticReserved []*StaticPortInfo `json:"static_reserved"`
+	FreeCount      int               `json:"free_count"`
+}
+
+type GetPortsResp struct {
+	Tcp *PortsUsage `json:"tcp"`
+	Udp *PortsUsage `json:"udp"`
+}
+
+// api/ports
+func (svr *Service) ApiPorts(w http.ResponseWriter, r *http.Request) {
+	res := GeneralResponse{Code: 200}
+	defer func() {
+		log.Info("Http response [%s]: code [%d]", r.URL.Path, res.Code)
+		w.WriteHeader(res.Code)
+		if len(res.Msg) > 0 {
+			w.Write([]byte(res.Msg))
+		}
+	}()
+	log.Info("Http request: [%s]", r.URL.Path)
+
+	resp := &GetPortsResp{
+		Tcp: getPortsUsage(svr.rc.TcpPortManager.GetStatus()),
+		Udp: getPortsUsage(svr.rc.UdpPortManager.GetStatus()),
+	}
+	buf, _ := json.Marshal(resp)
+	res.Msg = string(buf)
+}
+
+func getPortsUsage(status *ports.PortStatus) *PortsUsage {
+	usage := &PortsUsage{
+		Used:           make([]*PortInfo, 0, len(status.Used)),
+		Reserved:       make([]*PortInfo, 0, len(status.Reserved)),
+		StaticReserved: make([]*StaticPortInfo, 0, len(status.Static)),
+		FreeCount:      status.FreeCount,
+	}
+	toPortInfo := func(ctx ports.PortCtx) *PortInfo {
+		return &PortInfo{
+			Port:       ctx.Port,
+			ProxyName:  ctx.ProxyName,
+			User:       ctx.User,
+			UpdateTime: ctx.UpdateTime.Format("01-02 15:04:05"),
+		}
+	}
+	inUse := make(map[int]struct{}, len(status.Used))
+	for _, ctx := range status.Used {
+		usage.Used = append(usage.Used, toPortInfo(ctx))
+		inUse[ctx.Port] = struct{}{}
+	}
+	for _, ctx := range status.Reserved {
+		usage.Reserved = append(usage.Reserved, toPortInfo(ctx))
+	}
+	for port, r := range status.Static {
+		_, used := inUse[port]
+		usage.StaticReserved = append(usage.StaticReserved, &StaticPortInfo{
+			Port:      port,
+			Name:      r.Name,
+			User:      r.User,
+			ProxyName: r.ProxyName,
+			InUse:     used,
+		})
+	}
+	sort.Slice(usage.StaticReserved, func(i, j int) bool {
+		return usage.StaticReserved[i].Port < usage.StaticReserved[j].Port
+	})
+	return usage
+}
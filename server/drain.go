@@ -0,0 +1,78 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	frpErr "github.com/whysmx/frp/models/errors"
+	"github.com/whysmx/frp/utils/audit"
+	"github.com/whysmx/frp/utils/log"
+)
+
+func (svr *Service) IsDraining() bool {
+	return atomic.LoadUint32(&svr.draining) == 1
+}
+
+// Drain makes frps stop accepting new clients and user connections, all
+// clients are told to login to another frps. It returns the deadline and Run
+// returns after work connections in use are closed or the deadline is reached.
+func (svr *Service) Drain(timeout time.Duration, source string) (deadline time.Time, err error) {
+	if !atomic.CompareAndSwapUint32(&svr.draining, 0, 1) {
+		err = frpErr.ErrDraining
+		return
+	}
+
+	deadline = time.Now().Add(timeout)
+	log.Info("frps start draining, exit before %s", deadline.Format("01-02 15:04:05"))
+	audit.Record(audit.EventDrain, audit.Fields{
+		"source":  source,
+		"timeout": int64(timeout / time.Second),
+	})
+	go svr.drain(deadline)
+	return
+}
+
+func (svr *Service) drain(deadline time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		// Clients logged in just before draining started are drained in the next round.
+		var active int64
+		for _, ctl := range svr.ctlManager.GetAll() {
+			ctl.Drain(deadline)
+			active += ctl.ActiveWorkConns()
+		}
+		if active == 0 {
+			log.Info("all work connections are closed")
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Warn("drain timeout, %d work connections are still in use", active)
+			break
+		}
+		<-ticker.C
+	}
+
+	for _, ctl := range svr.ctlManager.GetAll() {
+		ctl.setCloseReason("frps drained")
+		ctl.allShutdown.Start()
+		ctl.WaitClosed()
+	}
+	log.Info("frps drained")
+	close(svr.drainedCh)
+}
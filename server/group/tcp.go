@@ -87,11 +87,11 @@ func NewTcpGroup(ctl *TcpGroupCtl) *TcpGroup {
 	}
 }
 
-func (tg *TcpGroup) Listen(proxyName string, group string, groupKey string, addr string, port int) (ln *TcpGroupListener, realPort int, err error) {
+func (tg *TcpGroup) Listen(proxyName string, user string, group string, groupKey string, addr string, port int) (ln *TcpGroupListener, realPort int, err error) {
 	tg.mu.Lock()
 	defer tg.mu.Unlock()
 	if len(tg.lns) == 0 {
-		realPort, err = tg.ctl.portManager.Acquire(proxyName, port)
+		realPort, err = tg.ctl.portManager.Acquire(proxyName, user, port)
 		if err != nil {
 			return
 		}
@@ -183,17 +183,17 @@ func NewTcpGroupCtl(portManager *ports.PortManager) *TcpGroupCtl {
 	}
 }
 
-func (tgc *TcpGroupCtl) Listen(proxyNanme string, group string, groupKey string,
+func (tgc *TcpGroupCtl) Listen(proxyNanme string, user string, group string, groupKey string,
 	addr string, port int) (l net.Listener, realPort int, err error) {
 
 	tgc.mu.Lock()
 	defer tgc.mu.Unlock()
 	if tcpGroup, ok := tgc.groups[group]; ok {
-		return tcpGroup.Listen(proxyNanme, group, groupKey, addr, port)
+		return tcpGroup.Listen(proxyNanme, user, group, groupKey, addr, port)
 	} else {
 		tcpGroup = NewTcpGroup(tgc)
 		tgc.groups[group] = tcpGroup
-		return tcpGroup.Listen(proxyNanme, group, groupKey, addr, port)
+		return tcpGroup.Listen(proxyNanme, user, group, groupKey, addr, port)
 	}
 }
 
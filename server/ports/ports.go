@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 )
@@ -20,20 +21,59 @@ var (
 	ErrPortNotAllowed  = errors.New("port not allowed")
 	ErrPortUnAvailable = errors.New("port unavailable")
 	ErrNoAvailablePort = errors.New("no available port")
+	ErrPortReserved    = errors.New("port reserved by others")
 )
 
 type PortCtx struct {
 	ProxyName  string
+	User       string
 	Port       int
 	Closed     bool
 	UpdateTime time.Time
 }
 
+// PortReservation reserves ports for a user or a proxy, nobody else can
+// acquire them. Both User and ProxyName must match if both are set.
+type PortReservation struct {
+	Name      string
+	User      string
+	ProxyName string
+}
+
+func (r *PortReservation) Match(proxyName string, user string) bool {
+	if r.User != "" && r.User != user {
+		return false
+	}
+	if r.ProxyName != "" && r.ProxyName != proxyName {
+		return false
+	}
+	return true
+}
+
+// PortStatus is a snapshot of ports in PortManager, sorted by port.
+type PortStatus struct {
+	Used []PortCtx
+
+	// ports kept for proxies closed in last MaxPortReservedDuration
+	Reserved []PortCtx
+
+	// static reservations indexed by port
+	Static map[int]PortReservation
+
+	FreeCount int
+}
+
 type PortManager struct {
 	reservedPorts map[string]*PortCtx
 	usedPorts     map[int]*PortCtx
 	freePorts     map[int]struct{}
 
+	// allowed ports, all ports are allowed if it's empty
+	allowPorts map[int]struct{}
+
+	// static reservations indexed by port
+	staticPorts map[int]*PortReservation
+
 	bindAddr string
 	netType  string
 	mu       sync.Mutex
@@ -44,25 +84,70 @@ func NewPortManager(netType string, bindAddr string, allowPorts map[int]struct{}
 		reservedPorts: make(map[string]*PortCtx),
 		usedPorts:     make(map[int]*PortCtx),
 		freePorts:     make(map[int]struct{}),
+		staticPorts:   make(map[int]*PortReservation),
 		bindAddr:      bindAddr,
 		netType:       netType,
 	}
-	if len(allowPorts) > 0 {
-		for port, _ := range allowPorts {
-			pm.freePorts[port] = struct{}{}
+	pm.SetAllowPorts(allowPorts)
+	go pm.cleanReservedPortsWorker()
+	return pm
+}
+
+// SetAllowPorts changes ports allowed to acquire. Ports in use are kept until
+// they are released even if they are not allowed any more.
+func (pm *PortManager) SetAllowPorts(allowPorts map[int]struct{}) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.allowPorts = make(map[int]struct{}, len(allowPorts))
+	for port := range allowPorts {
+		pm.allowPorts[port] = struct{}{}
+	}
+
+	pm.freePorts = make(map[int]struct{})
+	for i := MinPort; i <= MaxPort; i++ {
+		if _, ok := pm.usedPorts[i]; ok {
+			continue
 		}
-	} else {
-		for i := MinPort; i <= MaxPort; i++ {
+		if pm.isPortAllowed(i) {
 			pm.freePorts[i] = struct{}{}
 		}
 	}
-	go pm.cleanReservedPortsWorker()
-	return pm
 }
 
-func (pm *PortManager) Acquire(name string, port int) (realPort int, err error) {
+// SetReservations replaces all static reservations. Ports in use are kept
+// until they are released even if they are reserved by others now.
+func (pm *PortManager) SetReservations(reservations map[int]*PortReservation) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.staticPorts = make(map[int]*PortReservation, len(reservations))
+	for port, r := range reservations {
+		pm.staticPorts[port] = r
+	}
+}
+
+// Must hold the lock before calling this function.
+func (pm *PortManager) isPortReservedByOthers(port int, proxyName string, user string) bool {
+	r, ok := pm.staticPorts[port]
+	return ok && !r.Match(proxyName, user)
+}
+
+// Must hold the lock before calling this function.
+func (pm *PortManager) isPortAllowed(port int) bool {
+	if len(pm.allowPorts) == 0 {
+		return true
+	}
+	_, ok := pm.allowPorts[port]
+	return ok
+}
+
+// Acquire gets a port for proxy [name] of user. A random port is chosen if
+// port is 0, ports in static reservations are never chosen randomly.
+func (pm *PortManager) Acquire(name string, user string, port int) (realPort int, err error) {
 	portCtx := &PortCtx{
 		ProxyName:  name,
+		User:       user,
 		Closed:     false,
 		UpdateTime: time.Now(),
 	}
@@ -80,7 +165,8 @@ func (pm *PortManager) Acquire(name string, port int) (realPort int, err error)
 	// check reserved ports first
 	if port == 0 {
 		if ctx, ok := pm.reservedPorts[name]; ok {
-			if pm.isPortAvailable(ctx.Port) {
+			_, free := pm.freePorts[ctx.Port]
+			if free && !pm.isPortReservedByOthers(ctx.Port, name, user) && pm.isPortAvailable(ctx.Port) {
 				realPort = ctx.Port
 				pm.usedPorts[realPort] = portCtx
 				pm.reservedPorts[name] = portCtx
@@ -95,6 +181,9 @@ func (pm *PortManager) Acquire(name string, port int) (realPort int, err error)
 		count := 0
 		maxTryTimes := 5
 		for k, _ := range pm.freePorts {
+			if _, ok = pm.staticPorts[k]; ok {
+				continue
+			}
 			count++
 			if count > maxTryTimes {
 				break
@@ -112,6 +201,10 @@ func (pm *PortManager) Acquire(name string, port int) (realPort int, err error)
 		}
 	} else {
 		// specified port
+		if pm.isPortReservedByOthers(port, name, user) {
+			err = ErrPortReserved
+			return
+		}
 		if _, ok = pm.freePorts[port]; ok {
 			if pm.isPortAvailable(port) {
 				realPort = port
@@ -158,7 +251,9 @@ func (pm *PortManager) Release(port int) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 	if ctx, ok := pm.usedPorts[port]; ok {
-		pm.freePorts[port] = struct{}{}
+		if pm.isPortAllowed(port) {
+			pm.freePorts[port] = struct{}{}
+		}
 		delete(pm.usedPorts, port)
 		ctx.Closed = true
 		ctx.UpdateTime = time.Now()
@@ -178,3 +273,34 @@ func (pm *PortManager) cleanReservedPortsWorker() {
 		pm.mu.Unlock()
 	}
 }
+
+// GetStatus returns ports in use, ports reserved and the number of free ports.
+func (pm *PortManager) GetStatus() *PortStatus {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	status := &PortStatus{
+		Used:      make([]PortCtx, 0, len(pm.usedPorts)),
+		Reserved:  make([]PortCtx, 0),
+		Static:    make(map[int]PortReservation, len(pm.staticPorts)),
+		FreeCount: len(pm.freePorts),
+	}
+	for _, ctx := range pm.usedPorts {
+		status.Used = append(status.Used, *ctx)
+	}
+	for _, ctx := range pm.reservedPorts {
+		if _, used := pm.usedPorts[ctx.Port]; ctx.Closed && !used {
+			status.Reserved = append(status.Reserved, *ctx)
+		}
+	}
+	for port, r := range pm.staticPorts {
+		status.Static[port] = *r
+	}
+	sort.Slice(status.Used, func(i, j int) bool {
+		return status.Used[i].Port < status.Used[j].Port
+	})
+	sort.Slice(status.Reserved, func(i, j int) bool {
+		return status.Reserved[i].Port < status.Reserved[j].Port
+	})
+	return status
+}
@@ -0,0 +1,102 @@
+package ports
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getFreePorts returns n ports which are free now.
+func getFreePorts(t *testing.T, n int) []int {
+	ports := make([]int, 0, n)
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		listeners = append(listeners, l)
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+	return ports
+}
+
+func TestAcquireWithReservations(t *testing.T) {
+	assert := assert.New(t)
+
+	ports := getFreePorts(t, 3)
+	userPort, proxyPort, freePort := ports[0], ports[1], ports[2]
+	allowPorts := map[int]struct{}{
+		userPort:  {},
+		proxyPort: {},
+		freePort:  {},
+	}
+	pm := NewPortManager("tcp", "127.0.0.1", allowPorts)
+	pm.SetReservations(map[int]*PortReservation{
+		userPort:  {Name: "alice_db", User: "alice"},
+		proxyPort: {Name: "bob_mysql", User: "bob", ProxyName: "bob.mysql"},
+	})
+
+	// reserved ports can't be acquired by others
+	_, err := pm.Acquire("carol.db", "carol", userPort)
+	assert.Equal(ErrPortReserved, err)
+	_, err = pm.Acquire("bob.web", "bob", proxyPort)
+	assert.Equal(ErrPortReserved, err)
+	_, err = pm.Acquire("bob.mysql", "", proxyPort)
+	assert.Equal(ErrPortReserved, err)
+
+	// reserved ports are never chosen randomly
+	realPort, err := pm.Acquire("carol.web", "carol", 0)
+	assert.NoError(err)
+	assert.Equal(freePort, realPort)
+	_, err = pm.Acquire("carol.ssh", "carol", 0)
+	assert.Equal(ErrNoAvailablePort, err)
+
+	realPort, err = pm.Acquire("alice.db", "alice", userPort)
+	assert.NoError(err)
+	assert.Equal(userPort, realPort)
+	realPort, err = pm.Acquire("bob.mysql", "bob", proxyPort)
+	assert.NoError(err)
+	assert.Equal(proxyPort, realPort)
+
+	// a released port is still reserved
+	pm.Release(userPort)
+	_, err = pm.Acquire("carol.db", "carol", userPort)
+	assert.Equal(ErrPortReserved, err)
+
+	// ports in use are kept after reservations are changed
+	pm.SetReservations(map[int]*PortReservation{
+		proxyPort: {Name: "carol_mysql", User: "carol"},
+	})
+	_, err = pm.Acquire("carol.mysql", "carol", proxyPort)
+	assert.Equal(ErrPortAlreadyUsed, err)
+	realPort, err = pm.Acquire("carol.db", "carol", userPort)
+	assert.NoError(err)
+	assert.Equal(userPort, realPort)
+}
+
+func TestPortReservationMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	testcases := []struct {
+		r         PortReservation
+		proxyName string
+		user      string
+		match     bool
+	}{
+		{PortReservation{User: "alice"}, "alice.db", "alice", true},
+		{PortReservation{User: "alice"}, "alice.db", "bob", false},
+		{PortReservation{ProxyName: "db"}, "db", "", true},
+		{PortReservation{ProxyName: "db"}, "web", "", false},
+		{PortReservation{User: "bob", ProxyName: "bob.db"}, "bob.db", "bob", true},
+		{PortReservation{User: "bob", ProxyName: "bob.db"}, "bob.db", "alice", false},
+		{PortReservation{User: "bob", ProxyName: "bob.db"}, "bob.web", "bob", false},
+	}
+	for _, tc := range testcases {
+		assert.Equal(tc.match, tc.r.Match(tc.proxyName, tc.user), "%+v %s %s", tc.r, tc.proxyName, tc.user)
+	}
+}
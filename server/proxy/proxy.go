@@ -21,25 +21,35 @@ import (
 	"strconv"
 	"sync"
 
-	"github.com/whysmx/frp/g"
 	"github.com/whysmx/frp/models/config"
 	"github.com/whysmx/frp/models/msg"
+	plugin "github.com/whysmx/frp/models/plugin/server"
 	"github.com/whysmx/frp/server/controller"
 	"github.com/whysmx/frp/server/stats"
+	"github.com/whysmx/frp/utils/accesslog"
 	"github.com/whysmx/frp/utils/log"
 	frpNet "github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
 
 	frpIo "github.com/fatedier/golib/io"
 )
 
+var (
+	ErrExceedMaxProxies = fmt.Errorf("exceed the max_proxies of user")
+)
+
 type GetWorkConnFn func() (frpNet.Conn, error)
 
 type Proxy interface {
 	Run() (remoteAddr string, err error)
 	GetName() string
 	GetConf() config.ProxyConf
+	GetUserInfo() plugin.UserInfo
+	GetEncryptionKey() []byte
+	GetResourceController() *controller.ResourceController
 	GetWorkConnFromPool(src, dst net.Addr) (workConn frpNet.Conn, err error)
 	GetUsedPortsNum() int
+	GetUserConnManager() *UserConnManager
 	Close()
 	log.Logger
 }
@@ -52,6 +62,13 @@ type BaseProxy struct {
 	usedPortsNum   int
 	poolCount      int
 	getWorkConnFn  GetWorkConnFn
+	userInfo       plugin.UserInfo
+
+	// active user connections handled by HandleUserTcpConnection
+	userConns *UserConnManager
+
+	// token of the client, used for encryption of work connections
+	token string
 
 	mu sync.RWMutex
 	log.Logger
@@ -65,6 +82,22 @@ func (pxy *BaseProxy) GetUsedPortsNum() int {
 	return pxy.usedPortsNum
 }
 
+func (pxy *BaseProxy) GetUserInfo() plugin.UserInfo {
+	return pxy.userInfo
+}
+
+func (pxy *BaseProxy) GetEncryptionKey() []byte {
+	return []byte(pxy.token)
+}
+
+func (pxy *BaseProxy) GetResourceController() *controller.ResourceController {
+	return pxy.rc
+}
+
+func (pxy *BaseProxy) GetUserConnManager() *UserConnManager {
+	return pxy.userConns
+}
+
 func (pxy *BaseProxy) Close() {
 	pxy.Info("proxy closing")
 	for _, l := range pxy.listeners {
@@ -142,8 +175,8 @@ func (pxy *BaseProxy) startListenHandler(p Proxy, handler func(Proxy, frpNet.Con
 	}
 }
 
-func NewProxy(runId string, rc *controller.ResourceController, statsCollector stats.Collector, poolCount int,
-	getWorkConnFn GetWorkConnFn, pxyConf config.ProxyConf) (pxy Proxy, err error) {
+func NewProxy(runId string, userInfo plugin.UserInfo, token string, rc *controller.ResourceController,
+	statsCollector stats.Collector, poolCount int, getWorkConnFn GetWorkConnFn, pxyConf config.ProxyConf) (pxy Proxy, err error) {
 
 	basePxy := BaseProxy{
 		name:           pxyConf.GetBaseInfo().ProxyName,
@@ -152,6 +185,9 @@ func NewProxy(runId string, rc *controller.ResourceController, statsCollector st
 		listeners:      make([]frpNet.Listener, 0),
 		poolCount:      poolCount,
 		getWorkConnFn:  getWorkConnFn,
+		userInfo:       userInfo,
+		userConns:      NewUserConnManager(),
+		token:          token,
 		Logger:         log.NewPrefixLogger(runId),
 	}
 	switch cfg := pxyConf.(type) {
@@ -199,9 +235,32 @@ func NewProxy(runId string, rc *controller.ResourceController, statsCollector st
 func HandleUserTcpConnection(pxy Proxy, userConn frpNet.Conn, statsCollector stats.Collector) {
 	defer userConn.Close()
 
+	id, err := util.RandId()
+	if err != nil {
+		pxy.Error("generate user connection id error: %v", err)
+		return
+	}
+	uc := NewUserConn(id, userConn)
+	defer uc.recordAccessLog(pxy)
+
+	// server plugin hook
+	rc := pxy.GetResourceController()
+	content := &plugin.NewUserConnContent{
+		User:       pxy.GetUserInfo(),
+		ProxyName:  pxy.GetName(),
+		ProxyType:  pxy.GetConf().GetBaseInfo().ProxyType,
+		RemoteAddr: userConn.RemoteAddr().String(),
+	}
+	if _, err := rc.PluginManager.NewUserConn(content); err != nil {
+		pxy.Warn("the user conn [%s] was rejected, err: %v", content.RemoteAddr, err)
+		uc.setCloseReason(accesslog.ReasonRejected, err)
+		return
+	}
+
 	// try all connections from the pool
 	workConn, err := pxy.GetWorkConnFromPool(userConn.RemoteAddr(), userConn.LocalAddr())
 	if err != nil {
+		uc.setCloseReason(accesslog.ReasonNoWorkConn, err)
 		return
 	}
 	defer workConn.Close()
@@ -209,9 +268,10 @@ func HandleUserTcpConnection(pxy Proxy, userConn frpNet.Conn, statsCollector sta
 	var local io.ReadWriteCloser = workConn
 	cfg := pxy.GetConf().GetBaseInfo()
 	if cfg.UseEncryption {
-		local, err = frpIo.WithEncryption(local, []byte(g.GlbServerCfg.Token))
+		local, err = frpIo.WithEncryption(local, pxy.GetEncryptionKey())
 		if err != nil {
 			pxy.Error("create encryption stream error: %v", err)
+			uc.setCloseReason(accesslog.ReasonError, err)
 			return
 		}
 	}
@@ -221,8 +281,10 @@ func HandleUserTcpConnection(pxy Proxy, userConn frpNet.Conn, statsCollector sta
 	pxy.Debug("join connections, workConn(l[%s] r[%s]) userConn(l[%s] r[%s])", workConn.LocalAddr().String(),
 		workConn.RemoteAddr().String(), userConn.LocalAddr().String(), userConn.RemoteAddr().String())
 
+	pxy.GetUserConnManager().Add(uc)
 	statsCollector.Mark(stats.TypeOpenConnection, &stats.OpenConnectionPayload{ProxyName: pxy.GetName()})
-	inCount, outCount := frpIo.Join(local, userConn)
+	inCount, outCount := frpIo.Join(local, uc)
+	pxy.GetUserConnManager().Del(uc.Id)
 	statsCollector.Mark(stats.TypeCloseConnection, &stats.CloseConnectionPayload{ProxyName: pxy.GetName()})
 	statsCollector.Mark(stats.TypeAddTrafficIn, &stats.AddTrafficInPayload{
 		ProxyName:    pxy.GetName(),
@@ -248,12 +310,18 @@ func NewProxyManager() *ProxyManager {
 	}
 }
 
-func (pm *ProxyManager) Add(name string, pxy Proxy) error {
+// Add returns ErrExceedMaxProxies if the user of pxy has maxUserProxies
+// proxies already, 0 means not limited. Proxies are counted under the same
+// lock, so concurrent registrations of one user can't exceed the limit.
+func (pm *ProxyManager) Add(name string, pxy Proxy, maxUserProxies int64) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 	if _, ok := pm.pxys[name]; ok {
 		return fmt.Errorf("proxy name [%s] is already in use", name)
 	}
+	if maxUserProxies > 0 && int64(pm.countByUser(pxy.GetUserInfo().User)) >= maxUserProxies {
+		return ErrExceedMaxProxies
+	}
 
 	pm.pxys[name] = pxy
 	return nil
@@ -265,6 +333,23 @@ func (pm *ProxyManager) Del(name string) {
 	delete(pm.pxys, name)
 }
 
+// CountByUser returns the number of proxies belong to this user in all clients.
+func (pm *ProxyManager) CountByUser(user string) int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.countByUser(user)
+}
+
+// Hold lock before calling this function.
+func (pm *ProxyManager) countByUser(user string) (count int) {
+	for _, pxy := range pm.pxys {
+		if pxy.GetUserInfo().User == user {
+			count++
+		}
+	}
+	return
+}
+
 func (pm *ProxyManager) GetByName(name string) (pxy Proxy, ok bool) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
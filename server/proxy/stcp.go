@@ -24,7 +24,8 @@ type StcpProxy struct {
 }
 
 func (pxy *StcpProxy) Run() (remoteAddr string, err error) {
-	listener, errRet := pxy.rc.VisitorManager.Listen(pxy.GetName(), pxy.cfg.Sk)
+	listener, errRet := pxy.rc.VisitorManager.Listen(pxy.GetName(), pxy.cfg.Sk, pxy.cfg.Sks,
+		pxy.userInfo.User, pxy.cfg.AllowUsers)
 	if errRet != nil {
 		err = errRet
 		return
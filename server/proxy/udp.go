@@ -51,11 +51,14 @@ type UdpProxy struct {
 	// checkCloseCh is used for watching if workConn is closed
 	checkCloseCh chan int
 
+	// udp sessions of user addresses for access log
+	sessions *udpSessionManager
+
 	isClosed bool
 }
 
 func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
-	pxy.realPort, err = pxy.rc.UdpPortManager.Acquire(pxy.name, pxy.cfg.RemotePort)
+	pxy.realPort, err = pxy.rc.UdpPortManager.Acquire(pxy.name, pxy.userInfo.User, pxy.cfg.RemotePort)
 	if err != nil {
 		return
 	}
@@ -67,7 +70,7 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 
 	remoteAddr = fmt.Sprintf(":%d", pxy.realPort)
 	pxy.cfg.RemotePort = pxy.realPort
-	addr, errRet := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", g.GlbServerCfg.ProxyBindAddr, pxy.realPort))
+	addr, errRet := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", g.GetServerCfg().ProxyBindAddr, pxy.realPort))
 	if errRet != nil {
 		err = errRet
 		return
@@ -84,6 +87,12 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 	pxy.sendCh = make(chan *msg.UdpPacket, 1024)
 	pxy.readCh = make(chan *msg.UdpPacket, 1024)
 	pxy.checkCloseCh = make(chan int)
+	pxy.sessions = newUdpSessionManager(pxy, func(m *msg.UdpPacket) {
+		// ignore error here, it means the proxy is closed
+		errors.PanicToError(func() {
+			pxy.sendCh <- m
+		})
+	})
 
 	// read message from workConn, if it returns any error, notify proxy to start a new workConn
 	workConnReaderFn := func(conn net.Conn) {
@@ -114,6 +123,7 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 				if errRet := errors.PanicToError(func() {
 					pxy.Trace("get udp message from workConn: %s", m.Content)
 					pxy.readCh <- m
+					pxy.sessions.AddTrafficOut(m)
 					pxy.statsCollector.Mark(stats.TypeAddTrafficOut, &stats.AddTrafficOutPayload{
 						ProxyName:    pxy.GetName(),
 						TrafficBytes: int64(len(m.Content)),
@@ -137,6 +147,9 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 					pxy.Info("sender goroutine for udp work connection closed")
 					return
 				}
+				if !pxy.sessions.AddTrafficIn(udpMsg) {
+					continue
+				}
 				if errRet = msg.WriteMsg(conn, udpMsg); errRet != nil {
 					pxy.Info("sender goroutine for udp work connection closed: %v", errRet)
 					conn.Close()
@@ -189,6 +202,8 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 		}
 	}()
 
+	go pxy.checkIdleSessions()
+
 	// Read from user connections and send wrapped udp message to sendCh (forwarded by workConn).
 	// Client will transfor udp message to local udp service and waiting for response for a while.
 	// Response will be wrapped to be forwarded by work connection to server.
@@ -200,6 +215,20 @@ func (pxy *UdpProxy) Run() (remoteAddr string, err error) {
 	return remoteAddr, nil
 }
 
+func (pxy *UdpProxy) checkIdleSessions() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		pxy.mu.RLock()
+		closed := pxy.isClosed
+		pxy.mu.RUnlock()
+		if closed {
+			return
+		}
+		pxy.sessions.CloseIdle()
+	}
+}
+
 func (pxy *UdpProxy) GetConf() config.ProxyConf {
 	return pxy.cfg
 }
@@ -220,6 +249,8 @@ func (pxy *UdpProxy) Close() {
 		close(pxy.checkCloseCh)
 		close(pxy.readCh)
 		close(pxy.sendCh)
+
+		pxy.sessions.CloseAll()
 	}
 	pxy.rc.UdpPortManager.Release(pxy.realPort)
 }
@@ -0,0 +1,212 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/whysmx/frp/models/msg"
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/proto/udp"
+	"github.com/whysmx/frp/utils/accesslog"
+)
+
+// A udp session of one user address is closed if there are no packets in
+// udpSessionTimeout.
+const udpSessionTimeout = 60 * time.Second
+
+// Packets of a new session are queued while it's checked by server plugins,
+// more packets are dropped.
+const udpMaxPendingPackets = 32
+
+type udpSession struct {
+	remoteAddr string
+	startTime  time.Time
+	lastTime   time.Time
+	trafficIn  int64
+	trafficOut int64
+
+	// a new session is pending until it's checked by server plugins
+	pending        bool
+	pendingPackets []*msg.UdpPacket
+
+	// packets of a session rejected by server plugins are dropped
+	rejected bool
+}
+
+// udpSessionManager groups udp packets by user address for access log.
+type udpSessionManager struct {
+	pxy Proxy
+
+	// resend is called with packets queued while their session is pending
+	// after the session is accepted by server plugins.
+	resend func(m *msg.UdpPacket)
+
+	// sessions indexed by user address
+	sessions map[string]*udpSession
+
+	mu sync.Mutex
+}
+
+func newUdpSessionManager(pxy Proxy, resend func(m *msg.UdpPacket)) *udpSessionManager {
+	return &udpSessionManager{
+		pxy:      pxy,
+		resend:   resend,
+		sessions: make(map[string]*udpSession),
+	}
+}
+
+// AddTrafficIn is called for packets from user, it returns false if the
+// packet should not be sent to client now. A new session is checked by server
+// plugins in another goroutine, its packets are queued and resent after it's
+// accepted.
+func (sm *udpSessionManager) AddTrafficIn(m *msg.UdpPacket) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	key := m.RemoteAddr.String()
+	_, exist := sm.sessions[key]
+	s := sm.getSession(m.RemoteAddr)
+	if !exist {
+		s.pending = true
+		go sm.checkSession(s)
+	}
+	if s.rejected {
+		return false
+	}
+	if s.pending {
+		if len(s.pendingPackets) < udpMaxPendingPackets {
+			s.pendingPackets = append(s.pendingPackets, m)
+		}
+		return false
+	}
+	s.trafficIn += udpContentLen(m)
+	return true
+}
+
+// checkSession calls server plugins with the address of a new session and
+// resends its queued packets if it's accepted.
+func (sm *udpSessionManager) checkSession(s *udpSession) {
+	rejectErr := sm.checkNewUserConn(s.remoteAddr)
+
+	sm.mu.Lock()
+	s.pending = false
+	packets := s.pendingPackets
+	s.pendingPackets = nil
+	if rejectErr != nil {
+		s.rejected = true
+		sm.record(s, accesslog.ReasonRejected, rejectErr.Error())
+	}
+	sm.mu.Unlock()
+
+	if rejectErr != nil {
+		return
+	}
+	for _, m := range packets {
+		sm.resend(m)
+	}
+}
+
+// checkNewUserConn calls server plugins with the new user address.
+func (sm *udpSessionManager) checkNewUserConn(remoteAddr string) error {
+	content := &plugin.NewUserConnContent{
+		User:       sm.pxy.GetUserInfo(),
+		ProxyName:  sm.pxy.GetName(),
+		ProxyType:  sm.pxy.GetConf().GetBaseInfo().ProxyType,
+		RemoteAddr: remoteAddr,
+	}
+	if _, err := sm.pxy.GetResourceController().PluginManager.NewUserConn(content); err != nil {
+		sm.pxy.Warn("the user conn [%s] was rejected, err: %v", remoteAddr, err)
+		return err
+	}
+	return nil
+}
+
+// AddTrafficOut is called for packets sent to user.
+func (sm *udpSessionManager) AddTrafficOut(m *msg.UdpPacket) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	s := sm.getSession(m.RemoteAddr)
+	s.trafficOut += udpContentLen(m)
+}
+
+// Hold lock before calling this function.
+func (sm *udpSessionManager) getSession(addr *net.UDPAddr) *udpSession {
+	key := addr.String()
+	now := time.Now()
+	s, ok := sm.sessions[key]
+	if !ok {
+		s = &udpSession{
+			remoteAddr: key,
+			startTime:  now,
+		}
+		sm.sessions[key] = s
+	}
+	s.lastTime = now
+	return s
+}
+
+// CloseIdle closes sessions without packets in udpSessionTimeout. Rejected
+// sessions are checked by server plugins again after they are closed.
+func (sm *udpSessionManager) CloseIdle() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for key, s := range sm.sessions {
+		if !s.pending && time.Since(s.lastTime) > udpSessionTimeout {
+			if !s.rejected {
+				sm.record(s, accesslog.ReasonIdleTimeout, "")
+			}
+			delete(sm.sessions, key)
+		}
+	}
+}
+
+// CloseAll closes all sessions when proxy is closed.
+func (sm *udpSessionManager) CloseAll() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for _, s := range sm.sessions {
+		if !s.rejected {
+			sm.record(s, accesslog.ReasonProxyClosed, "")
+		}
+	}
+	sm.sessions = make(map[string]*udpSession)
+}
+
+func (sm *udpSessionManager) record(s *udpSession, reason string, errStr string) {
+	userInfo := sm.pxy.GetUserInfo()
+	accesslog.Record(s.startTime, s.lastTime, &accesslog.Entry{
+		ProxyName:   sm.pxy.GetName(),
+		ProxyType:   sm.pxy.GetConf().GetBaseInfo().ProxyType,
+		RunId:       userInfo.RunId,
+		User:        userInfo.User,
+		RemoteAddr:  s.remoteAddr,
+		TrafficIn:   s.trafficIn,
+		TrafficOut:  s.trafficOut,
+		CloseReason: reason,
+		Error:       errStr,
+	})
+}
+
+// udpContentLen returns the length of the packet sent by user or to user,
+// invalid packets are dropped so their length is 0.
+func udpContentLen(m *msg.UdpPacket) int64 {
+	buf, err := udp.GetContent(m)
+	if err != nil {
+		return 0
+	}
+	return int64(len(buf))
+}
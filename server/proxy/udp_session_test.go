@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/msg"
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/proto/udp"
+	"github.com/whysmx/frp/server/controller"
+	"github.com/whysmx/frp/utils/accesslog"
+	"github.com/whysmx/frp/utils/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rejectPlugin rejects new user connections from rejectAddr.
+type rejectPlugin struct {
+	rejectAddr string
+}
+
+func (p *rejectPlugin) Name() string { return "reject" }
+
+func (p *rejectPlugin) IsSupport(op string) bool { return op == plugin.OpNewUserConn }
+
+func (p *rejectPlugin) Handle(op string, content interface{}) (*plugin.Response, interface{}, error) {
+	if content.(plugin.NewUserConnContent).RemoteAddr == p.rejectAddr {
+		return &plugin.Response{Reject: true, RejectReason: "blocked"}, nil, nil
+	}
+	return &plugin.Response{Unchange: true}, nil, nil
+}
+
+func newTestUdpSessionManager(rejectAddr string, resendCh chan *msg.UdpPacket) *udpSessionManager {
+	pm := plugin.NewManager()
+	pm.Register(&rejectPlugin{rejectAddr: rejectAddr})
+	cfg := &config.UdpProxyConf{}
+	cfg.ProxyName = "dns"
+	cfg.ProxyType = "udp"
+	pxy := &UdpProxy{
+		BaseProxy: &BaseProxy{
+			name: "dns",
+			rc: &controller.ResourceController{
+				PluginManager: pm,
+			},
+			userInfo: plugin.UserInfo{RunId: "run_id"},
+			Logger:   log.NewPrefixLogger(""),
+		},
+		cfg: cfg,
+	}
+	return newUdpSessionManager(pxy, func(m *msg.UdpPacket) {
+		resendCh <- m
+	})
+}
+
+// waitPending waits until the session of addr is checked by server plugins.
+func waitPending(sm *udpSessionManager, addr *net.UDPAddr) bool {
+	for i := 0; i < 100; i++ {
+		sm.mu.Lock()
+		s, ok := sm.sessions[addr.String()]
+		pending := ok && s.pending
+		sm.mu.Unlock()
+		if ok && !pending {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func readAccessLog(t *testing.T, file string) (entries []*accesslog.Entry) {
+	buf, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		if line == "" {
+			continue
+		}
+		e := &accesslog.Entry{}
+		assert.NoError(t, json.Unmarshal([]byte(line), e))
+		entries = append(entries, e)
+	}
+	return
+}
+
+func TestUdpSessionManager(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frps_udp_session")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.log")
+	assert.NoError(accesslog.InitAccessLog(file))
+	defer func() {
+		accesslog.Access = nil
+	}()
+
+	userA := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10001}
+	userB := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10002}
+	blocked := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10003}
+	resendCh := make(chan *msg.UdpPacket, 10)
+	sm := newTestUdpSessionManager(blocked.String(), resendCh)
+
+	// packets of a new session are queued until it's accepted by plugins
+	assert.False(sm.AddTrafficIn(udp.NewUdpPacket([]byte("hello"), nil, userA)))
+	assert.True(waitPending(sm, userA))
+	m := <-resendCh
+	assert.True(sm.AddTrafficIn(m))
+	assert.True(sm.AddTrafficIn(udp.NewUdpPacket([]byte("a"), nil, userA)))
+	sm.AddTrafficOut(udp.NewUdpPacket([]byte("world!"), nil, userA))
+
+	assert.False(sm.AddTrafficIn(udp.NewUdpPacket([]byte("ab"), nil, userB)))
+	assert.True(waitPending(sm, userB))
+	assert.True(sm.AddTrafficIn(<-resendCh))
+
+	// packets of rejected address are dropped, it's recorded only once
+	assert.False(sm.AddTrafficIn(udp.NewUdpPacket([]byte("x"), nil, blocked)))
+	assert.True(waitPending(sm, blocked))
+	assert.False(sm.AddTrafficIn(udp.NewUdpPacket([]byte("x"), nil, blocked)))
+	assert.Len(resendCh, 0)
+
+	// userB and the rejected session are idle
+	sm.sessions[userB.String()].lastTime = time.Now().Add(-2 * udpSessionTimeout)
+	sm.sessions[blocked.String()].lastTime = time.Now().Add(-2 * udpSessionTimeout)
+	sm.CloseIdle()
+	assert.Len(sm.sessions, 1)
+	sm.CloseAll()
+	assert.Len(sm.sessions, 0)
+
+	entries := readAccessLog(t, file)
+	if !assert.Len(entries, 3) {
+		return
+	}
+	assert.Equal(blocked.String(), entries[0].RemoteAddr)
+	assert.Equal(accesslog.ReasonRejected, entries[0].CloseReason)
+	assert.Equal("blocked", entries[0].Error)
+
+	assert.Equal(userB.String(), entries[1].RemoteAddr)
+	assert.Equal(accesslog.ReasonIdleTimeout, entries[1].CloseReason)
+	assert.EqualValues(2, entries[1].TrafficIn)
+
+	assert.Equal(userA.String(), entries[2].RemoteAddr)
+	assert.Equal(accesslog.ReasonProxyClosed, entries[2].CloseReason)
+	assert.EqualValues(6, entries[2].TrafficIn)
+	assert.EqualValues(6, entries[2].TrafficOut)
+	for _, e := range entries {
+		assert.Equal("dns", e.ProxyName)
+		assert.Equal("udp", e.ProxyType)
+		assert.Equal("run_id", e.RunId)
+	}
+}
+
+func TestUdpContentLen(t *testing.T) {
+	assert := assert.New(t)
+
+	for n := 0; n < 8; n++ {
+		buf := []byte(strings.Repeat("a", n))
+		assert.EqualValues(n, udpContentLen(udp.NewUdpPacket(buf, nil, nil)), fmt.Sprintf("length %d", n))
+	}
+	assert.EqualValues(0, udpContentLen(&msg.UdpPacket{Content: "not base64!"}))
+}
+
+// blockPlugin blocks checks of new user connections until release is closed.
+type blockPlugin struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (p *blockPlugin) Name() string { return "block" }
+
+func (p *blockPlugin) IsSupport(op string) bool { return op == plugin.OpNewUserConn }
+
+func (p *blockPlugin) Handle(op string, content interface{}) (*plugin.Response, interface{}, error) {
+	atomic.AddInt32(&p.calls, 1)
+	<-p.release
+	return &plugin.Response{Unchange: true}, nil, nil
+}
+
+func TestUdpSessionManagerSlowPlugin(t *testing.T) {
+	assert := assert.New(t)
+
+	resendCh := make(chan *msg.UdpPacket, 2*udpMaxPendingPackets)
+	sm := newTestUdpSessionManager("", resendCh)
+	p := &blockPlugin{release: make(chan struct{})}
+	sm.pxy.GetResourceController().PluginManager.Register(p)
+
+	// a slow plugin doesn't block callers, packets are queued up to
+	// udpMaxPendingPackets and the plugin is called once
+	userA := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10001}
+	for i := 0; i < udpMaxPendingPackets+5; i++ {
+		assert.False(sm.AddTrafficIn(udp.NewUdpPacket([]byte("a"), nil, userA)))
+	}
+	assert.Len(resendCh, 0)
+
+	close(p.release)
+	for i := 0; i < udpMaxPendingPackets; i++ {
+		select {
+		case <-resendCh:
+		case <-time.After(time.Second):
+			t.Fatalf("get %d packets resent, expected %d", i, udpMaxPendingPackets)
+		}
+	}
+	assert.Len(resendCh, 0)
+	assert.EqualValues(1, atomic.LoadInt32(&p.calls))
+	assert.True(sm.AddTrafficIn(udp.NewUdpPacket([]byte("a"), nil, userA)))
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/whysmx/frp/utils/accesslog"
+	frpNet "github.com/whysmx/frp/utils/net"
+)
+
+// UserConn is an active user connection of a proxy, it counts bytes read from
+// and written to the user.
+type UserConn struct {
+	// accessed atomically
+	trafficIn  int64
+	trafficOut int64
+
+	frpNet.Conn
+
+	Id        string
+	StartTime time.Time
+
+	// why the connection is closed, only the first one is kept
+	closeReason string
+	closeErr    string
+	mu          sync.Mutex
+}
+
+func NewUserConn(id string, conn frpNet.Conn) *UserConn {
+	return &UserConn{
+		Conn:      conn,
+		Id:        id,
+		StartTime: time.Now(),
+	}
+}
+
+func (uc *UserConn) Read(p []byte) (n int, err error) {
+	n, err = uc.Conn.Read(p)
+	atomic.AddInt64(&uc.trafficIn, int64(n))
+	if err != nil {
+		uc.setCloseReason(accesslog.ReasonUserClosed, nil)
+	}
+	return
+}
+
+func (uc *UserConn) Write(p []byte) (n int, err error) {
+	n, err = uc.Conn.Write(p)
+	atomic.AddInt64(&uc.trafficOut, int64(n))
+	if err != nil {
+		uc.setCloseReason(accesslog.ReasonUserClosed, nil)
+	}
+	return
+}
+
+// Close is called when the other side of the user connection is closed if
+// user doesn't close it first.
+func (uc *UserConn) Close() error {
+	uc.setCloseReason(accesslog.ReasonClientClosed, nil)
+	return uc.Conn.Close()
+}
+
+func (uc *UserConn) CloseWithReason(reason string) error {
+	uc.setCloseReason(reason, nil)
+	return uc.Conn.Close()
+}
+
+func (uc *UserConn) setCloseReason(reason string, err error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.closeReason == "" {
+		uc.closeReason = reason
+		if err != nil {
+			uc.closeErr = err.Error()
+		}
+	}
+}
+
+// recordAccessLog writes an access log entry after the user connection is closed.
+func (uc *UserConn) recordAccessLog(pxy Proxy) {
+	uc.mu.Lock()
+	reason, errStr := uc.closeReason, uc.closeErr
+	uc.mu.Unlock()
+
+	userInfo := pxy.GetUserInfo()
+	accesslog.Record(uc.StartTime, time.Now(), &accesslog.Entry{
+		ProxyName:   pxy.GetName(),
+		ProxyType:   pxy.GetConf().GetBaseInfo().ProxyType,
+		RunId:       userInfo.RunId,
+		User:        userInfo.User,
+		RemoteAddr:  uc.RemoteAddr().String(),
+		TrafficIn:   uc.TrafficIn(),
+		TrafficOut:  uc.TrafficOut(),
+		CloseReason: reason,
+		Error:       errStr,
+	})
+}
+
+// TrafficIn returns bytes received from user so far.
+func (uc *UserConn) TrafficIn() int64 {
+	return atomic.LoadInt64(&uc.trafficIn)
+}
+
+// TrafficOut returns bytes sent to user so far.
+func (uc *UserConn) TrafficOut() int64 {
+	return atomic.LoadInt64(&uc.trafficOut)
+}
+
+// UserConnManager keeps active user connections of one proxy.
+type UserConnManager struct {
+	// user connections indexed by id
+	conns map[string]*UserConn
+
+	mu sync.RWMutex
+}
+
+func NewUserConnManager() *UserConnManager {
+	return &UserConnManager{
+		conns: make(map[string]*UserConn),
+	}
+}
+
+func (ucm *UserConnManager) Add(uc *UserConn) {
+	ucm.mu.Lock()
+	defer ucm.mu.Unlock()
+	ucm.conns[uc.Id] = uc
+}
+
+func (ucm *UserConnManager) Del(id string) {
+	ucm.mu.Lock()
+	defer ucm.mu.Unlock()
+	delete(ucm.conns, id)
+}
+
+func (ucm *UserConnManager) GetById(id string) (uc *UserConn, ok bool) {
+	ucm.mu.RLock()
+	defer ucm.mu.RUnlock()
+	uc, ok = ucm.conns[id]
+	return
+}
+
+// GetAll returns all active user connections sorted by start time.
+func (ucm *UserConnManager) GetAll() (ucs []*UserConn) {
+	ucm.mu.RLock()
+	ucs = make([]*UserConn, 0, len(ucm.conns))
+	for _, uc := range ucm.conns {
+		ucs = append(ucs, uc)
+	}
+	ucm.mu.RUnlock()
+
+	sort.Slice(ucs, func(i, j int) bool {
+		return ucs[i].StartTime.Before(ucs[j].StartTime)
+	})
+	return
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/utils/accesslog"
+	frpNet "github.com/whysmx/frp/utils/net"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserConnTraffic(t *testing.T) {
+	assert := assert.New(t)
+
+	testcases := []struct {
+		reads      []string
+		writes     []string
+		trafficIn  int64
+		trafficOut int64
+	}{
+		{nil, nil, 0, 0},
+		{[]string{"hello"}, nil, 5, 0},
+		{nil, []string{"hi", "frp"}, 0, 5},
+		{[]string{"a", "bc", "def"}, []string{"1234567890"}, 6, 10},
+	}
+
+	for _, tc := range testcases {
+		c1, c2 := net.Pipe()
+		uc := NewUserConn("id", frpNet.WrapConn(c1))
+
+		go func(reads []string, writes []string) {
+			for _, s := range reads {
+				c2.Write([]byte(s))
+			}
+			for range writes {
+				// drain data written to user
+				buf := make([]byte, 64)
+				c2.Read(buf)
+			}
+		}(tc.reads, tc.writes)
+		for _, s := range tc.reads {
+			buf := make([]byte, len(s))
+			_, err := io.ReadFull(uc, buf)
+			assert.NoError(err)
+			assert.Equal(s, string(buf))
+		}
+		for _, s := range tc.writes {
+			_, err := uc.Write([]byte(s))
+			assert.NoError(err)
+		}
+
+		// traffic is counted before the connection is closed
+		assert.Equal(tc.trafficIn, uc.TrafficIn())
+		assert.Equal(tc.trafficOut, uc.TrafficOut())
+		uc.Close()
+		c2.Close()
+	}
+}
+
+func TestUserConnManager(t *testing.T) {
+	assert := assert.New(t)
+
+	ucm := NewUserConnManager()
+	now := time.Now()
+	first := &UserConn{Id: "1", StartTime: now}
+	second := &UserConn{Id: "2", StartTime: now.Add(time.Second)}
+	third := &UserConn{Id: "3", StartTime: now.Add(2 * time.Second)}
+	ucm.Add(third)
+	ucm.Add(first)
+	ucm.Add(second)
+
+	assert.Equal([]*UserConn{first, second, third}, ucm.GetAll())
+	uc, ok := ucm.GetById("2")
+	assert.True(ok)
+	assert.Equal(second, uc)
+
+	ucm.Del("2")
+	_, ok = ucm.GetById("2")
+	assert.False(ok)
+	assert.Equal([]*UserConn{first, third}, ucm.GetAll())
+}
+
+func TestUserConnCloseReason(t *testing.T) {
+	assert := assert.New(t)
+
+	testcases := []struct {
+		name   string
+		action func(uc *UserConn, peer net.Conn)
+		reason string
+	}{
+		{"closed by user", func(uc *UserConn, peer net.Conn) {
+			peer.Close()
+			uc.Read(make([]byte, 1))
+			uc.Close()
+		}, accesslog.ReasonUserClosed},
+		{"closed by client", func(uc *UserConn, peer net.Conn) {
+			uc.Close()
+			uc.Read(make([]byte, 1))
+		}, accesslog.ReasonClientClosed},
+		{"closed from dashboard", func(uc *UserConn, peer net.Conn) {
+			uc.CloseWithReason(accesslog.ReasonClosedFromDashboard)
+			uc.Read(make([]byte, 1))
+			uc.Close()
+		}, accesslog.ReasonClosedFromDashboard},
+		{"write error", func(uc *UserConn, peer net.Conn) {
+			peer.Close()
+			uc.Write([]byte("data"))
+			uc.CloseWithReason(accesslog.ReasonProxyClosed)
+		}, accesslog.ReasonUserClosed},
+	}
+
+	for _, tc := range testcases {
+		c1, c2 := net.Pipe()
+		uc := NewUserConn("id", frpNet.WrapConn(c1))
+		tc.action(uc, c2)
+		// only the first reason is kept
+		assert.Equal(tc.reason, uc.closeReason, tc.name)
+		c2.Close()
+	}
+}
@@ -36,7 +36,8 @@ func (pxy *XtcpProxy) Run() (remoteAddr string, err error) {
 		err = fmt.Errorf("xtcp is not supported in frps")
 		return
 	}
-	sidCh := pxy.rc.NatHoleController.ListenClient(pxy.GetName(), pxy.cfg.Sk)
+	sidCh := pxy.rc.NatHoleController.ListenClient(pxy.GetName(), pxy.cfg.Sk, pxy.cfg.Sks,
+		pxy.userInfo.User, pxy.cfg.AllowUsers)
 	go func() {
 		for {
 			select {
@@ -49,7 +50,8 @@ func (pxy *XtcpProxy) Run() (remoteAddr string, err error) {
 					continue
 				}
 				m := &msg.NatHoleSid{
-					Sid: sr.Sid,
+					Sid:           sr.Sid,
+					SkFingerprint: sr.SkFingerprint,
 				}
 				errRet = msg.WriteMsg(workConn, m)
 				if errRet != nil {
@@ -0,0 +1,213 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/server/ports"
+	"github.com/whysmx/frp/utils/audit"
+	"github.com/whysmx/frp/utils/log"
+)
+
+// Fields of ServerCommonConf which take effect without restarting frps.
+// Most of them are only used by new clients, proxies or connections.
+var reloadableSettings = map[string]bool{
+	"DashboardUser":            true,
+	"DashboardPwd":             true,
+	"LogLevel":                 true,
+	"Token":                    true,
+	"UsersFile":                true,
+	"SubDomainHost":            true,
+	"AuthenticateHeartBeats":   true,
+	"AuthenticateNewWorkConns": true,
+	"AllowPorts":               true,
+	"MaxPoolCount":             true,
+	"MaxPortsPerClient":        true,
+	"HeartBeatTimeout":         true,
+	"DrainTimeout":             true,
+	"PortReservationsFile":     true,
+	"Webhooks":                 true,
+}
+
+// Names of settings in ini file if they are different from json tags.
+var settingNames = map[string]string{
+	"AssetsDir":        "assets_dir",
+	"HeartBeatTimeout": "heartbeat_timeout",
+	"AllowPorts":       "allow_ports",
+	"HTTPPlugins":      "plugin.*",
+	"Webhooks":         "webhook.*",
+}
+
+type ReloadResult struct {
+	// settings changed and applied
+	Applied []string `json:"applied"`
+
+	// settings changed but only take effect after restarting frps
+	NeedRestart []string `json:"need_restart"`
+}
+
+// loadPortReservationsFile returns reservations indexed by port.
+func loadPortReservationsFile(file string) (reservations map[int]*ports.PortReservation, err error) {
+	content, err := config.GetRenderedConfFromFile(file)
+	if err != nil {
+		err = fmt.Errorf("Load port reservations file error: %v", err)
+		return
+	}
+	confs, err := config.LoadAllPortReservationConfFromIni(content)
+	if err != nil {
+		return
+	}
+	reservations = make(map[int]*ports.PortReservation)
+	for _, cfg := range confs {
+		r := &ports.PortReservation{
+			Name:      cfg.Name,
+			User:      cfg.User,
+			ProxyName: cfg.ProxyName,
+		}
+		for _, port := range cfg.Ports {
+			reservations[port] = r
+		}
+	}
+	return
+}
+
+func loadUsersFile(file string) (users map[string]*config.UserConf, err error) {
+	content, err := config.GetRenderedConfFromFile(file)
+	if err != nil {
+		err = fmt.Errorf("Load users file error: %v", err)
+		return
+	}
+	return config.LoadAllUserConfFromIni(content)
+}
+
+// ReloadConf reads the config file again and applies settings which can be
+// changed at runtime. Nothing is changed if the config file is invalid.
+func (svr *Service) ReloadConf(source string) (res *ReloadResult, err error) {
+	svr.reloadMu.Lock()
+	defer svr.reloadMu.Unlock()
+
+	defer func() {
+		fields := audit.Fields{
+			"source": source,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			fields["applied"] = res.Applied
+			fields["need_restart"] = res.NeedRestart
+		}
+		audit.Record(audit.EventReload, fields)
+	}()
+
+	if g.GetServerCfg().CfgFile == "" {
+		err = fmt.Errorf("frps is not started with a config file")
+		return
+	}
+	content, err := config.GetRenderedConfFromFile(g.GetServerCfg().CfgFile)
+	if err != nil {
+		return
+	}
+	newCfg, err := config.UnmarshalServerConfFromIni(nil, content)
+	if err != nil {
+		return
+	}
+	if err = newCfg.Check(); err != nil {
+		return
+	}
+
+	// Users and port reservations are always loaded again even if the file is not changed.
+	var users map[string]*config.UserConf
+	if newCfg.UsersFile != "" {
+		if users, err = loadUsersFile(newCfg.UsersFile); err != nil {
+			return
+		}
+	}
+	var reservations map[int]*ports.PortReservation
+	if newCfg.PortReservationsFile != "" {
+		if reservations, err = loadPortReservationsFile(newCfg.PortReservationsFile); err != nil {
+			return
+		}
+	}
+
+	// Settings are applied to a copy of the config in use, which replaces it
+	// as a whole, so other goroutines never see a config changed halfway.
+	glbCfg := *g.GetServerCfg()
+	cfg := &glbCfg.ServerCommonConf
+	res = &ReloadResult{
+		Applied:     make([]string, 0),
+		NeedRestart: make([]string, 0),
+	}
+	webhooksChanged := !reflect.DeepEqual(cfg.Webhooks, newCfg.Webhooks)
+	oldValue := reflect.ValueOf(cfg).Elem()
+	newValue := reflect.ValueOf(newCfg).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+
+		name, ok := settingNames[field.Name]
+		if !ok {
+			name = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		// users_file can't be enabled or disabled at runtime
+		reloadable := reloadableSettings[field.Name]
+		if field.Name == "UsersFile" && (cfg.UsersFile == "" || newCfg.UsersFile == "") {
+			reloadable = false
+		}
+		// log_way is changed with log_file
+		if field.Name == "LogWay" {
+			continue
+		}
+
+		if reloadable {
+			oldValue.Field(i).Set(newValue.Field(i))
+			res.Applied = append(res.Applied, name)
+		} else {
+			res.NeedRestart = append(res.NeedRestart, name)
+		}
+	}
+
+	g.SetServerCfg(&glbCfg)
+
+	svr.rc.TcpPortManager.SetAllowPorts(cfg.AllowPorts)
+	svr.rc.UdpPortManager.SetAllowPorts(cfg.AllowPorts)
+	svr.rc.TcpPortManager.SetReservations(reservations)
+	svr.rc.UdpPortManager.SetReservations(reservations)
+	if cfg.PortReservationsFile != "" {
+		log.Info("reload %d reserved ports from port reservations file [%s]", len(reservations), cfg.PortReservationsFile)
+	}
+	config.InitServerCfg(cfg)
+	log.SetLogLevel(cfg.LogLevel)
+	if svr.dashboardAuth != nil {
+		svr.dashboardAuth.SetAuth(cfg.DashboardUser, cfg.DashboardPwd)
+	}
+	if svr.rc.UserManager != nil && cfg.UsersFile == newCfg.UsersFile {
+		svr.rc.UserManager.Reload(users)
+		log.Info("reload %d users from users file [%s]", len(users), cfg.UsersFile)
+	}
+	if webhooksChanged {
+		svr.rc.WebhookManager.Reload(cfg.Webhooks)
+		log.Info("reload %d webhooks", len(cfg.Webhooks))
+	}
+
+	log.Info("reload frps conf success, applied: %v, need restart: %v", res.Applied, res.NeedRestart)
+	return
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/webhook"
+	"github.com/whysmx/frp/server/controller"
+	"github.com/whysmx/frp/server/ports"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadConf(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frps_reload")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "frps.ini")
+
+	content := "[common]\nbind_port = 7000\ntoken = old\n"
+	assert.NoError(ioutil.WriteFile(cfgFile, []byte(content), 0600))
+	cfg, err := config.UnmarshalServerConfFromIni(nil, content)
+	assert.NoError(err)
+	oldCfg := &g.ServerCfg{
+		ServerCommonConf: *cfg,
+		CfgFile:          cfgFile,
+	}
+	defaultCfg := g.GetServerCfg()
+	g.SetServerCfg(oldCfg)
+	defer g.SetServerCfg(defaultCfg)
+
+	svr := &Service{
+		rc: &controller.ResourceController{
+			TcpPortManager: ports.NewPortManager("tcp", "", nil),
+			UdpPortManager: ports.NewPortManager("udp", "", nil),
+			WebhookManager: webhook.NewManager(),
+		},
+	}
+
+	// settings are read from a new config while reloading
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < 1000; i++ {
+			_ = g.GetServerCfg().Token
+		}
+	}()
+
+	content = "[common]\nbind_port = 7001\ntoken = new\n"
+	assert.NoError(ioutil.WriteFile(cfgFile, []byte(content), 0600))
+	res, err := svr.ReloadConf("test")
+	<-doneCh
+	assert.NoError(err)
+	assert.Equal([]string{"token"}, res.Applied)
+	assert.Equal([]string{"bind_port"}, res.NeedRestart)
+
+	newCfg := g.GetServerCfg()
+	assert.Equal("new", newCfg.Token)
+	assert.Equal(7000, newCfg.BindPort)
+	assert.Equal(cfgFile, newCfg.CfgFile)
+	// config in use before reloading is not changed
+	assert.Equal("old", oldCfg.Token)
+
+	// nothing is changed if config file is invalid
+	assert.NoError(ioutil.WriteFile(cfgFile, []byte("[common]\nbind_port = abc\n"), 0600))
+	_, err = svr.ReloadConf("test")
+	assert.Error(err)
+	assert.Equal(newCfg, g.GetServerCfg())
+}
@@ -16,27 +16,28 @@ package server
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"math/big"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/whysmx/frp/assets"
 	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	frpErr "github.com/whysmx/frp/models/errors"
 	"github.com/whysmx/frp/models/msg"
 	"github.com/whysmx/frp/models/nathole"
+	plugin "github.com/whysmx/frp/models/plugin/server"
+	"github.com/whysmx/frp/models/webhook"
 	"github.com/whysmx/frp/server/controller"
 	"github.com/whysmx/frp/server/group"
 	"github.com/whysmx/frp/server/ports"
 	"github.com/whysmx/frp/server/proxy"
 	"github.com/whysmx/frp/server/stats"
+	"github.com/whysmx/frp/utils/audit"
 	"github.com/whysmx/frp/utils/log"
 	frpNet "github.com/whysmx/frp/utils/net"
 	"github.com/whysmx/frp/utils/util"
@@ -82,20 +83,87 @@ type Service struct {
 	// stats collector to store server and proxies stats info
 	statsCollector stats.Collector
 
+	// Prometheus metrics exposed in dashboard, nil if disabled
+	promCollector *stats.PrometheusCollector
+
 	tlsConfig *tls.Config
+
+	// basic auth of dashboard, nil if dashboard is disabled
+	dashboardAuth *frpNet.HttpAuthMiddleware
+
+	// only one reload at the same time
+	reloadMu sync.Mutex
+
+	// 1 means frps is draining, accessed atomically
+	draining uint32
+
+	// closed after draining finished, then Run returns
+	drainedCh chan struct{}
+
+	// Run returns at once with the error received
+	exitCh chan error
 }
 
 func NewService() (svr *Service, err error) {
-	cfg := &g.GlbServerCfg.ServerCommonConf
+	cfg := &g.GetServerCfg().ServerCommonConf
+	replayFilter := util.NewReplayFilter(cfg.VisitorMaxClockSkew, int(cfg.VisitorReplayCacheSize))
 	svr = &Service{
 		ctlManager: NewControlManager(),
 		pxyManager: proxy.NewProxyManager(),
+		drainedCh:  make(chan struct{}),
+		exitCh:     make(chan error, 1),
 		rc: &controller.ResourceController{
-			VisitorManager: controller.NewVisitorManager(),
+			VisitorManager: controller.NewVisitorManager(replayFilter, cfg.MinAuthScheme),
 			TcpPortManager: ports.NewPortManager("tcp", cfg.ProxyBindAddr, cfg.AllowPorts),
 			UdpPortManager: ports.NewPortManager("udp", cfg.ProxyBindAddr, cfg.AllowPorts),
+			PluginManager:  plugin.NewManager(),
+			WebhookManager: webhook.NewManager(),
 		},
-		tlsConfig: generateTLSConfig(),
+	}
+
+	svr.tlsConfig, err = frpNet.NewServerTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSTrustedCaFile)
+	if err != nil {
+		err = fmt.Errorf("Create TLS config error: %v", err)
+		return
+	}
+
+	// Init users
+	if cfg.UsersFile != "" {
+		var users map[string]*config.UserConf
+		users, err = loadUsersFile(cfg.UsersFile)
+		if err != nil {
+			return
+		}
+		svr.rc.UserManager = controller.NewUserManager()
+		svr.rc.UserManager.Reload(users)
+		log.Info("load %d users from users file [%s]", len(users), cfg.UsersFile)
+	}
+
+	// Init port reservations
+	if cfg.PortReservationsFile != "" {
+		var reservations map[int]*ports.PortReservation
+		reservations, err = loadPortReservationsFile(cfg.PortReservationsFile)
+		if err != nil {
+			return
+		}
+		svr.rc.TcpPortManager.SetReservations(reservations)
+		svr.rc.UdpPortManager.SetReservations(reservations)
+		log.Info("load %d reserved ports from port reservations file [%s]", len(reservations), cfg.PortReservationsFile)
+		if cfg.UsersFile == "" {
+			log.Warn("users_file is not set, port reservations rely on 'user' declared by frpc itself")
+		}
+	}
+
+	// Init all plugins
+	for name, options := range cfg.HTTPPlugins {
+		svr.rc.PluginManager.Register(plugin.NewHTTPPlugin(options))
+		log.Info("plugin [%s] has been registered", name)
+	}
+
+	// Init webhooks
+	svr.rc.WebhookManager.Reload(cfg.Webhooks)
+	for name := range cfg.Webhooks {
+		log.Info("webhook [%s] has been registered", name)
 	}
 
 	// Init group controller
@@ -212,7 +280,7 @@ func NewService() (svr *Service, err error) {
 	if cfg.BindUdpPort > 0 {
 		var nc *nathole.NatHoleController
 		addr := fmt.Sprintf("%s:%d", cfg.BindAddr, cfg.BindUdpPort)
-		nc, err = nathole.NewNatHoleController(addr)
+		nc, err = nathole.NewNatHoleController(addr, replayFilter, cfg.MinAuthScheme, svr.authVisitor)
 		if err != nil {
 			err = fmt.Errorf("Create nat hole controller error, %v", err)
 			return
@@ -221,7 +289,18 @@ func NewService() (svr *Service, err error) {
 		log.Info("nat hole udp service listen on %s:%d", cfg.BindAddr, cfg.BindUdpPort)
 	}
 
-	var statsEnable bool
+	// Stats are only available if dashboard is enabled or they are saved to file.
+	svr.statsCollector = stats.NewInternalCollector(cfg.DashboardPort > 0 || cfg.StatsFile != "", cfg.StatsReserveDays,
+		cfg.StatsFile, time.Duration(cfg.StatsFlushInterval)*time.Second)
+	if cfg.DashboardPort > 0 && cfg.EnablePrometheus {
+		svr.promCollector = stats.NewPrometheusCollector()
+		svr.statsCollector = stats.NewMultiCollector(svr.statsCollector, svr.promCollector)
+	}
+
+	if errRet := svr.statsCollector.Run(); errRet != nil {
+		log.Warn("%v", errRet)
+	}
+
 	// Create dashboard web server.
 	if cfg.DashboardPort > 0 {
 		err = svr.RunDashboardServer(cfg.DashboardAddr, cfg.DashboardPort)
@@ -230,25 +309,43 @@ func NewService() (svr *Service, err error) {
 			return
 		}
 		log.Info("Dashboard listen on %s:%d", cfg.DashboardAddr, cfg.DashboardPort)
-		statsEnable = true
 	}
-
-	svr.statsCollector = stats.NewInternalCollector(statsEnable)
 	return
 }
 
-func (svr *Service) Run() {
+// Run returns after draining finished, or an error if frps can't accept
+// connections from client any more or Exit is called.
+func (svr *Service) Run() (err error) {
 	if svr.rc.NatHoleController != nil {
 		go svr.rc.NatHoleController.Run()
 	}
-	if g.GlbServerCfg.KcpBindPort > 0 {
+	if g.GetServerCfg().KcpBindPort > 0 {
 		go svr.HandleListener(svr.kcpListener)
 	}
 
 	go svr.HandleListener(svr.websocketListener)
 	go svr.HandleListener(svr.tlsListener)
+	go func() {
+		svr.HandleListener(svr.listener)
+		svr.Exit(fmt.Errorf("listener for incoming connections from client closed"))
+	}()
+
+	select {
+	case <-svr.drainedCh:
+	case err = <-svr.exitCh:
+	}
+	if errRet := svr.statsCollector.Close(); errRet != nil {
+		log.Warn("save stats file error: %v", errRet)
+	}
+	return
+}
 
-	svr.HandleListener(svr.listener)
+// Exit makes Run return with err at once without draining.
+func (svr *Service) Exit(err error) {
+	select {
+	case svr.exitCh <- err:
+	default:
+	}
 }
 
 func (svr *Service) HandleListener(l frpNet.Listener) {
@@ -260,20 +357,24 @@ func (svr *Service) HandleListener(l frpNet.Listener) {
 			return
 		}
 
-		log.Trace("start check TLS connection...")
-		originConn := c
-		c, err = frpNet.CheckAndEnableTLSServerConnWithTimeout(c, svr.tlsConfig, connReadTimeout)
-		if err != nil {
-			log.Warn("CheckAndEnableTLSServerConnWithTimeout error: %v", err)
-			originConn.Close()
-			continue
-		}
-		log.Trace("success check TLS connection")
+		// Start a new goroutine for dealing connections, TLS handshake of a
+		// slow client shouldn't block others.
+		go func(originConn frpNet.Conn) {
+			log.Trace("start check TLS connection...")
+			frpConn, err := frpNet.CheckAndEnableTLSServerConnWithTimeout(originConn, svr.tlsConfig,
+				g.GetServerCfg().TLSTrustedCaFile != "", connReadTimeout)
+			if err != nil {
+				log.Warn("CheckAndEnableTLSServerConnWithTimeout error: %v", err)
+				originConn.Close()
+				return
+			}
+			log.Trace("success check TLS connection")
 
-		// Start a new goroutine for dealing connections.
-		go func(frpConn frpNet.Conn) {
 			dealFn := func(conn frpNet.Conn) {
-				var rawMsg msg.Message
+				var (
+					rawMsg msg.Message
+					err    error
+				)
 				conn.SetReadDeadline(time.Now().Add(connReadTimeout))
 				if rawMsg, err = msg.ReadMsg(conn); err != nil {
 					log.Trace("Failed to read message: %v", err)
@@ -284,11 +385,28 @@ func (svr *Service) HandleListener(l frpNet.Listener) {
 
 				switch m := rawMsg.(type) {
 				case *msg.Login:
-					err = svr.RegisterControl(conn, m)
+					content := &plugin.LoginContent{
+						Login:         *m,
+						ClientAddress: conn.RemoteAddr().String(),
+					}
+					retContent, errRet := svr.rc.PluginManager.Login(content)
+					if errRet == nil {
+						m = &retContent.Login
+						err = svr.RegisterControl(conn, m)
+					} else {
+						err = errRet
+					}
 					// If login failed, send error message there.
 					// Otherwise send success message in control's work goroutine.
 					if err != nil {
 						conn.Warn("%v", err)
+						audit.Record(audit.EventLoginFailed, audit.Fields{
+							"user":        m.User,
+							"run_id":      m.RunId,
+							"remote_addr": conn.RemoteAddr().String(),
+							"version":     m.Version,
+							"reason":      err.Error(),
+						})
 						msg.WriteMsg(conn, &msg.LoginResp{
 							Version: version.Full(),
 							Error:   err.Error(),
@@ -296,19 +414,31 @@ func (svr *Service) HandleListener(l frpNet.Listener) {
 						conn.Close()
 					}
 				case *msg.NewWorkConn:
-					svr.RegisterWorkConn(conn, m)
+					if err = svr.RegisterWorkConn(conn, m); err != nil {
+						conn.Warn("%v", err)
+						conn.Close()
+					}
 				case *msg.NewVisitorConn:
-					if err = svr.RegisterVisitorConn(conn, m); err != nil {
+					var skFingerprint string
+					if skFingerprint, err = svr.RegisterVisitorConn(conn, m); err != nil {
 						conn.Warn("%v", err)
+						audit.Record(audit.EventVisitorAuthFailed, audit.Fields{
+							"proxy_name":  m.ProxyName,
+							"run_id":      m.RunId,
+							"remote_addr": conn.RemoteAddr().String(),
+							"reason":      err.Error(),
+						})
 						msg.WriteMsg(conn, &msg.NewVisitorConnResp{
 							ProxyName: m.ProxyName,
 							Error:     err.Error(),
 						})
 						conn.Close()
 					} else {
+						conn.Info("visitor connection of [%s] uses sk [%s]", m.ProxyName, skFingerprint)
 						msg.WriteMsg(conn, &msg.NewVisitorConnResp{
-							ProxyName: m.ProxyName,
-							Error:     "",
+							ProxyName:     m.ProxyName,
+							SkFingerprint: skFingerprint,
+							Error:         "",
 						})
 					}
 				default:
@@ -317,7 +447,7 @@ func (svr *Service) HandleListener(l frpNet.Listener) {
 				}
 			}
 
-			if g.GlbServerCfg.TcpMux {
+			if g.GetServerCfg().TcpMux {
 				fmuxCfg := fmux.DefaultConfig()
 				fmuxCfg.KeepAliveInterval = 20 * time.Second
 				fmuxCfg.LogOutput = ioutil.Discard
@@ -346,8 +476,13 @@ func (svr *Service) HandleListener(l frpNet.Listener) {
 }
 
 func (svr *Service) RegisterControl(ctlConn frpNet.Conn, loginMsg *msg.Login) (err error) {
-	ctlConn.Info("client login info: ip [%s] version [%s] hostname [%s] os [%s] arch [%s]",
-		ctlConn.RemoteAddr().String(), loginMsg.Version, loginMsg.Hostname, loginMsg.Os, loginMsg.Arch)
+	ctlConn.Info("client login info: ip [%s] version [%s] hostname [%s] os [%s] arch [%s] user [%s]",
+		ctlConn.RemoteAddr().String(), loginMsg.Version, loginMsg.Hostname, loginMsg.Os, loginMsg.Arch, loginMsg.User)
+
+	if svr.IsDraining() {
+		err = frpErr.ErrDraining
+		return
+	}
 
 	// Check client version.
 	if ok, msg := version.Compat(loginMsg.Version); !ok {
@@ -356,8 +491,17 @@ func (svr *Service) RegisterControl(ctlConn frpNet.Conn, loginMsg *msg.Login) (e
 	}
 
 	// Check auth.
-	if util.GetAuthKey(g.GlbServerCfg.Token, loginMsg.Timestamp) != loginMsg.PrivilegeKey {
-		err = fmt.Errorf("authorization failed")
+	token, authScheme, err := svr.authLogin(loginMsg)
+	if err != nil {
+		ctlConn.Warn("user [%s] login failed: %v", loginMsg.User, err)
+		svr.statsCollector.Mark(stats.TypeLoginFailed, &stats.LoginFailedPayload{
+			User:   loginMsg.User,
+			Reason: err.Error(),
+		})
+		return
+	}
+
+	if err = svr.ctlManager.CheckBlocked(loginMsg.RunId, loginMsg.User); err != nil {
 		return
 	}
 
@@ -370,7 +514,7 @@ func (svr *Service) RegisterControl(ctlConn frpNet.Conn, loginMsg *msg.Login) (e
 		}
 	}
 
-	ctl := NewControl(svr.rc, svr.pxyManager, svr.statsCollector, ctlConn, loginMsg)
+	ctl := NewControl(svr.rc, svr.pxyManager, svr.statsCollector, ctlConn, loginMsg, token, authScheme)
 
 	if oldCtl := svr.ctlManager.Add(loginMsg.RunId, ctl); oldCtl != nil {
 		oldCtl.allShutdown.WaitDone()
@@ -378,6 +522,16 @@ func (svr *Service) RegisterControl(ctlConn frpNet.Conn, loginMsg *msg.Login) (e
 
 	ctlConn.AddLogPrefix(loginMsg.RunId)
 	ctl.Start()
+	audit.Record(audit.EventLogin, audit.Fields{
+		"run_id":      loginMsg.RunId,
+		"user":        loginMsg.User,
+		"remote_addr": ctlConn.RemoteAddr().String(),
+		"version":     loginMsg.Version,
+		"hostname":    loginMsg.Hostname,
+		"os":          loginMsg.Os,
+		"arch":        loginMsg.Arch,
+	})
+	ctl.notifyWebhook(webhook.EventLogin, nil, "")
 
 	// for statistics
 	svr.statsCollector.Mark(stats.TypeNewClient, &stats.NewClientPayload{})
@@ -390,39 +544,89 @@ func (svr *Service) RegisterControl(ctlConn frpNet.Conn, loginMsg *msg.Login) (e
 	return
 }
 
+// authLogin checks the privilege key in login message with all auth schemes
+// allowed by min_auth_scheme, and returns the token of this client and the
+// scheme of the key.
+func (svr *Service) authLogin(loginMsg *msg.Login) (token string, authScheme string, err error) {
+	if err = util.CheckClockSkew(loginMsg.Timestamp, g.GetServerCfg().AuthMaxClockSkew); err != nil {
+		return
+	}
+
+	minScheme := g.GetServerCfg().MinAuthScheme
+	defer func() {
+		// give a hint if frpc is too old to support min_auth_scheme
+		if err == controller.ErrAuthFailed {
+			if scheme := util.NegotiateAuthScheme(loginMsg.Version); !util.AuthSchemeAllowed(scheme, minScheme) {
+				err = fmt.Errorf("auth scheme [%s] of frpc is not allowed, please upgrade frpc", scheme)
+			}
+		}
+	}()
+
+	if svr.rc.UserManager != nil {
+		return svr.rc.UserManager.Auth(loginMsg.User, minScheme, loginMsg.Timestamp, loginMsg.PrivilegeKey)
+	}
+
+	var ok bool
+	if authScheme, ok = util.CheckAuthKey(minScheme, g.GetServerCfg().Token, loginMsg.Timestamp, loginMsg.PrivilegeKey); !ok {
+		err = controller.ErrAuthFailed
+		return
+	}
+	token = g.GetServerCfg().Token
+	return
+}
+
 // RegisterWorkConn register a new work connection to control and proxies need it.
-func (svr *Service) RegisterWorkConn(workConn frpNet.Conn, newMsg *msg.NewWorkConn) {
+func (svr *Service) RegisterWorkConn(workConn frpNet.Conn, newMsg *msg.NewWorkConn) (err error) {
 	ctl, exist := svr.ctlManager.GetById(newMsg.RunId)
 	if !exist {
-		workConn.Warn("No client control found for run id [%s]", newMsg.RunId)
+		err = fmt.Errorf("no client control found for run id [%s]", newMsg.RunId)
+		return
+	}
+
+	if g.GetServerCfg().AuthenticateNewWorkConns {
+		if err = ctl.authPrivilegeKey(util.AuthPurposeNewWorkConn, newMsg.Timestamp, newMsg.PrivilegeKey); err != nil {
+			err = fmt.Errorf("work connection of run id [%s] authorization failed", newMsg.RunId)
+			return
+		}
+	}
+
+	content := &plugin.NewWorkConnContent{
+		User:        ctl.getUserInfo(),
+		NewWorkConn: *newMsg,
+	}
+	if _, err = svr.rc.PluginManager.NewWorkConn(content); err != nil {
+		err = fmt.Errorf("work connection rejected by plugin: %v", err)
 		return
 	}
 	ctl.RegisterWorkConn(workConn)
 	return
 }
 
-func (svr *Service) RegisterVisitorConn(visitorConn frpNet.Conn, newMsg *msg.NewVisitorConn) error {
-	return svr.rc.VisitorManager.NewConn(newMsg.ProxyName, visitorConn, newMsg.Timestamp, newMsg.SignKey,
-		newMsg.UseEncryption, newMsg.UseCompression)
-}
-
-// Setup a bare-bones TLS config for the server
-func generateTLSConfig() *tls.Config {
-	key, err := rsa.GenerateKey(rand.Reader, 1024)
-	if err != nil {
-		panic(err)
+// RegisterVisitorConn returns the fingerprint of the secret key used by the visitor.
+func (svr *Service) RegisterVisitorConn(visitorConn frpNet.Conn, newMsg *msg.NewVisitorConn) (skFingerprint string, err error) {
+	if svr.IsDraining() {
+		err = frpErr.ErrDraining
+		return
 	}
-	template := x509.Certificate{SerialNumber: big.NewInt(1)}
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	user, err := svr.authVisitor(util.AuthPurposeNewVisitorConn, newMsg.RunId, newMsg.Timestamp, newMsg.PrivilegeKey)
 	if err != nil {
-		panic(err)
+		err = fmt.Errorf("visitor connection of [%s] auth failed: %v", newMsg.ProxyName, err)
+		return
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return svr.rc.VisitorManager.NewConn(newMsg.ProxyName, visitorConn, user, newMsg.Timestamp, newMsg.Nonce, newMsg.SignKey,
+		newMsg.UseEncryption, newMsg.UseCompression)
+}
 
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		panic(err)
+// authVisitor checks the privilege key of a visitor and returns the user of
+// the client it belongs to. Visitors must come from a logged-in client.
+func (svr *Service) authVisitor(purpose string, runId string, timestamp int64, privilegeKey string) (user string, err error) {
+	ctl, exist := svr.ctlManager.GetById(runId)
+	if !exist {
+		err = fmt.Errorf("no client control found for run id [%s]", runId)
+		return
+	}
+	if err = ctl.authPrivilegeKey(purpose, timestamp, privilegeKey); err != nil {
+		return
 	}
-	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	return ctl.loginMsg.User, nil
 }
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/whysmx/frp/g"
+	"github.com/whysmx/frp/models/config"
+	"github.com/whysmx/frp/models/msg"
+	"github.com/whysmx/frp/server/controller"
+	"github.com/whysmx/frp/server/stats"
+	frpNet "github.com/whysmx/frp/utils/net"
+	"github.com/whysmx/frp/utils/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T) (svr *Service, ln net.Listener) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	svr = &Service{
+		listener:          frpNet.WrapLogListener(ln),
+		websocketListener: frpNet.NewCustomListener(),
+		tlsListener:       frpNet.NewCustomListener(),
+		rc:                &controller.ResourceController{},
+		statsCollector:    stats.NewInternalCollector(false, 0, "", time.Minute),
+		drainedCh:         make(chan struct{}),
+		exitCh:            make(chan error, 1),
+	}
+	return
+}
+
+func TestRunExitsIfListenerClosed(t *testing.T) {
+	assert := assert.New(t)
+	svr, ln := newTestService(t)
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- svr.Run()
+	}()
+	ln.Close()
+
+	select {
+	case err := <-errCh:
+		assert.Error(err)
+	case <-time.After(time.Second):
+		assert.Fail("Run doesn't return after listener closed")
+	}
+}
+
+func TestRunExitsByExit(t *testing.T) {
+	assert := assert.New(t)
+	svr, ln := newTestService(t)
+	defer ln.Close()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- svr.Run()
+	}()
+	svr.Exit(nil)
+	// Exit doesn't block if Run is returning
+	svr.Exit(nil)
+
+	select {
+	case err := <-errCh:
+		assert.NoError(err)
+	case <-time.After(time.Second):
+		assert.Fail("Run doesn't return after Exit")
+	}
+}
+
+func TestAuthLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := *g.GetServerCfg()
+	cfg.Token = "123"
+	defaultCfg := g.GetServerCfg()
+	defer g.SetServerCfg(defaultCfg)
+
+	svr := &Service{rc: &controller.ResourceController{}}
+	now := time.Now().Unix()
+	loginMsg := func(version string, scheme string) *msg.Login {
+		return &msg.Login{
+			Version:      version,
+			Timestamp:    now,
+			PrivilegeKey: util.GetAuthKeyWithScheme(scheme, "123", now),
+		}
+	}
+
+	// new frpc of other builds may still use md5
+	cfg.MinAuthScheme = util.AuthSchemeMd5
+	g.SetServerCfg(&cfg)
+	for _, version := range []string{"0.27.1", "0.28.0"} {
+		token, scheme, err := svr.authLogin(loginMsg(version, util.AuthSchemeMd5))
+		assert.NoError(err, version)
+		assert.Equal("123", token)
+		assert.Equal(util.AuthSchemeMd5, scheme)
+	}
+	_, scheme, err := svr.authLogin(loginMsg("0.28.0", util.AuthSchemeHmacSha256))
+	assert.NoError(err)
+	assert.Equal(util.AuthSchemeHmacSha256, scheme)
+
+	cfg.MinAuthScheme = util.AuthSchemeHmacSha256
+	g.SetServerCfg(&cfg)
+	_, _, err = svr.authLogin(loginMsg("0.28.0", util.AuthSchemeMd5))
+	assert.Equal(controller.ErrAuthFailed, err)
+	_, _, err = svr.authLogin(loginMsg("0.27.1", util.AuthSchemeMd5))
+	assert.EqualError(err, "auth scheme [md5] of frpc is not allowed, please upgrade frpc")
+	_, scheme, err = svr.authLogin(loginMsg("0.28.0", util.AuthSchemeHmacSha256))
+	assert.NoError(err)
+	assert.Equal(util.AuthSchemeHmacSha256, scheme)
+
+	// users of users_file
+	um := controller.NewUserManager()
+	um.Reload(map[string]*config.UserConf{
+		"alice": {User: "alice", Token: "123", Enable: true},
+	})
+	svr.rc.UserManager = um
+	cfg.MinAuthScheme = util.AuthSchemeMd5
+	g.SetServerCfg(&cfg)
+	m := loginMsg("0.28.0", util.AuthSchemeMd5)
+	m.User = "alice"
+	_, scheme, err = svr.authLogin(m)
+	assert.NoError(err)
+	assert.Equal(util.AuthSchemeMd5, scheme)
+}
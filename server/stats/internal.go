@@ -15,6 +15,7 @@
 package stats
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -26,42 +27,100 @@ type internalCollector struct {
 	enable bool
 	info   *ServerStatistics
 	mu     sync.Mutex
+
+	// days of traffic statistics reserved
+	reserveDays int64
+
+	// if storeFile is not empty, statistics are loaded from it at startup and
+	// saved to it every flushInterval
+	storeFile     string
+	flushInterval time.Duration
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
 }
 
-func NewInternalCollector(enable bool) Collector {
+func NewInternalCollector(enable bool, reserveDays int64, storeFile string, flushInterval time.Duration) Collector {
+	if reserveDays <= 0 {
+		reserveDays = ReserveDays
+	}
 	return &internalCollector{
 		enable: enable,
 		info: &ServerStatistics{
-			TotalTrafficIn:  metric.NewDateCounter(ReserveDays),
-			TotalTrafficOut: metric.NewDateCounter(ReserveDays),
+			TotalTrafficIn:  NewTrafficCounter(reserveDays),
+			TotalTrafficOut: NewTrafficCounter(reserveDays),
 			CurConns:        metric.NewCounter(),
 
 			ClientCounts:    metric.NewCounter(),
 			ProxyTypeCounts: make(map[string]metric.Counter),
 
+			LoginFailedCounts: metric.NewCounter(),
+
+			KickedClientCounts: metric.NewCounter(),
+			KickedProxyCounts:  metric.NewCounter(),
+
 			ProxyStatistics: make(map[string]*ProxyStatistics),
 		},
+		reserveDays:   reserveDays,
+		storeFile:     storeFile,
+		flushInterval: flushInterval,
+		closeCh:       make(chan struct{}),
 	}
 }
 
-func (collector *internalCollector) Run() error {
+// Run loads statistics saved before and starts background jobs, statistics
+// are kept in memory even if loading fails.
+func (collector *internalCollector) Run() (err error) {
+	if collector.enable && collector.storeFile != "" {
+		if err = collector.Load(collector.storeFile); err != nil {
+			err = fmt.Errorf("load stats file error: %v", err)
+		}
+		go func() {
+			for {
+				select {
+				case <-collector.closeCh:
+					return
+				case <-time.After(collector.flushInterval):
+				}
+				if errRet := collector.Save(collector.storeFile); errRet != nil {
+					log.Warn("save stats file error: %v", errRet)
+				}
+			}
+		}()
+	}
+
 	go func() {
 		for {
-			time.Sleep(12 * time.Hour)
+			select {
+			case <-collector.closeCh:
+				return
+			case <-time.After(12 * time.Hour):
+			}
 			log.Debug("start to clear useless proxy statistics data...")
 			collector.ClearUselessInfo()
 			log.Debug("finish to clear useless proxy statistics data")
 		}
 	}()
-	return nil
+	return
+}
+
+// Close stops background jobs and saves statistics to file for the last time.
+func (collector *internalCollector) Close() (err error) {
+	collector.closeOnce.Do(func() {
+		close(collector.closeCh)
+		if collector.enable && collector.storeFile != "" {
+			err = collector.Save(collector.storeFile)
+		}
+	})
+	return
 }
 
 func (collector *internalCollector) ClearUselessInfo() {
-	// To check if there are proxies that closed than 7 days and drop them.
+	// To check if there are proxies that closed than reserved days and drop them.
 	collector.mu.Lock()
 	defer collector.mu.Unlock()
 	for name, data := range collector.info.ProxyStatistics {
-		if !data.LastCloseTime.IsZero() && time.Since(data.LastCloseTime) > time.Duration(7*24)*time.Hour {
+		if !data.LastCloseTime.IsZero() && time.Since(data.LastCloseTime) > time.Duration(collector.reserveDays*24)*time.Hour {
 			delete(collector.info.ProxyStatistics, name)
 			log.Trace("clear proxy [%s]'s statistics data, lastCloseTime: [%s]", name, data.LastCloseTime.String())
 		}
@@ -90,6 +149,12 @@ func (collector *internalCollector) Mark(statsType StatsType, payload interface{
 		collector.addTrafficIn(v)
 	case *AddTrafficOutPayload:
 		collector.addTrafficOut(v)
+	case *LoginFailedPayload:
+		collector.loginFailed(v)
+	case *KickClientPayload:
+		collector.kickClient(v)
+	case *KickProxyPayload:
+		collector.kickProxy(v)
 	}
 }
 
@@ -117,11 +182,12 @@ func (collector *internalCollector) newProxy(payload *NewProxyPayload) {
 			Name:       payload.Name,
 			ProxyType:  payload.ProxyType,
 			CurConns:   metric.NewCounter(),
-			TrafficIn:  metric.NewDateCounter(ReserveDays),
-			TrafficOut: metric.NewDateCounter(ReserveDays),
+			TrafficIn:  NewTrafficCounter(collector.reserveDays),
+			TrafficOut: NewTrafficCounter(collector.reserveDays),
 		}
 		collector.info.ProxyStatistics[payload.Name] = proxyStats
 	}
+	proxyStats.User = payload.User
 	proxyStats.LastStartTime = time.Now()
 }
 
@@ -186,6 +252,23 @@ func (collector *internalCollector) addTrafficOut(payload *AddTrafficOutPayload)
 	}
 }
 
+func (collector *internalCollector) loginFailed(payload *LoginFailedPayload) {
+	collector.info.LoginFailedCounts.Inc(1)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.info.LastLoginFailedUser = payload.User
+	collector.info.LastLoginFailedTime = time.Now()
+}
+
+func (collector *internalCollector) kickClient(payload *KickClientPayload) {
+	collector.info.KickedClientCounts.Inc(1)
+}
+
+func (collector *internalCollector) kickProxy(payload *KickProxyPayload) {
+	collector.info.KickedProxyCounts.Inc(1)
+}
+
 func (collector *internalCollector) GetServer() *ServerStats {
 	collector.mu.Lock()
 	defer collector.mu.Unlock()
@@ -195,6 +278,15 @@ func (collector *internalCollector) GetServer() *ServerStats {
 		CurConns:        collector.info.CurConns.Count(),
 		ClientCounts:    collector.info.ClientCounts.Count(),
 		ProxyTypeCounts: make(map[string]int64),
+
+		LoginFailedCounts:   collector.info.LoginFailedCounts.Count(),
+		LastLoginFailedUser: collector.info.LastLoginFailedUser,
+
+		KickedClientCounts: collector.info.KickedClientCounts.Count(),
+		KickedProxyCounts:  collector.info.KickedProxyCounts.Count(),
+	}
+	if !collector.info.LastLoginFailedTime.IsZero() {
+		s.LastLoginFailedTime = collector.info.LastLoginFailedTime.Format("01-02 15:04:05")
 	}
 	for k, v := range collector.info.ProxyTypeCounts {
 		s.ProxyTypeCounts[k] = v.Count()
@@ -215,6 +307,7 @@ func (collector *internalCollector) GetProxiesByType(proxyType string) []*ProxyS
 		ps := &ProxyStats{
 			Name:            name,
 			Type:            proxyStats.ProxyType,
+			User:            proxyStats.User,
 			TodayTrafficIn:  proxyStats.TrafficIn.TodayCount(),
 			TodayTrafficOut: proxyStats.TrafficOut.TodayCount(),
 			CurConns:        proxyStats.CurConns.Count(),
@@ -246,6 +339,7 @@ func (collector *internalCollector) GetProxiesByTypeAndName(proxyType string, pr
 		res = &ProxyStats{
 			Name:            name,
 			Type:            proxyStats.ProxyType,
+			User:            proxyStats.User,
 			TodayTrafficIn:  proxyStats.TrafficIn.TodayCount(),
 			TodayTrafficOut: proxyStats.TrafficOut.TodayCount(),
 			CurConns:        proxyStats.CurConns.Count(),
@@ -261,7 +355,7 @@ func (collector *internalCollector) GetProxiesByTypeAndName(proxyType string, pr
 	return
 }
 
-func (collector *internalCollector) GetProxyTraffic(name string) (res *ProxyTrafficInfo) {
+func (collector *internalCollector) GetProxyTraffic(name string, granularity string) (res *ProxyTrafficInfo) {
 	collector.mu.Lock()
 	defer collector.mu.Unlock()
 
@@ -270,8 +364,18 @@ func (collector *internalCollector) GetProxyTraffic(name string) (res *ProxyTraf
 		res = &ProxyTrafficInfo{
 			Name: name,
 		}
-		res.TrafficIn = proxyStats.TrafficIn.GetLastDaysCount(ReserveDays)
-		res.TrafficOut = proxyStats.TrafficOut.GetLastDaysCount(ReserveDays)
+		res.TrafficIn = proxyStats.TrafficIn.GetCounts(granularity)
+		res.TrafficOut = proxyStats.TrafficOut.GetCounts(granularity)
 	}
 	return
 }
+
+func (collector *internalCollector) GetServerTraffic(granularity string) (res *ProxyTrafficInfo) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	res = &ProxyTrafficInfo{}
+	res.TrafficIn = collector.info.TotalTrafficIn.GetCounts(granularity)
+	res.TrafficOut = collector.info.TotalTrafficOut.GetCounts(granularity)
+	return
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Upper bounds in seconds of GetWorkConn latency histogram buckets.
+var getWorkConnBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type promProxyStats struct {
+	ProxyType  string
+	TrafficIn  int64
+	TrafficOut int64
+	CurConns   int64
+}
+
+// PrometheusCollector keeps the current values of metrics and exposes them in
+// Prometheus text format by ServeHTTP. Statistics of closed proxies are dropped.
+type PrometheusCollector struct {
+	clientCounts     int64
+	proxyTypeCounts  map[string]int64
+	curConns         int64
+	workConnPoolSize int64
+	loginFailed      int64
+
+	// key is proxy name
+	proxies map[string]*promProxyStats
+
+	// counts of every bucket in getWorkConnBuckets, the last one is +Inf
+	getWorkConnCounts []int64
+	getWorkConnSum    float64
+	getWorkConnTotal  int64
+
+	mu sync.Mutex
+}
+
+func NewPrometheusCollector() *PrometheusCollector {
+	return &PrometheusCollector{
+		proxyTypeCounts:   make(map[string]int64),
+		proxies:           make(map[string]*promProxyStats),
+		getWorkConnCounts: make([]int64, len(getWorkConnBuckets)+1),
+	}
+}
+
+func (collector *PrometheusCollector) Run() error {
+	return nil
+}
+
+func (collector *PrometheusCollector) Close() error {
+	return nil
+}
+
+func (collector *PrometheusCollector) Mark(statsType StatsType, payload interface{}) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	switch v := payload.(type) {
+	case *NewClientPayload:
+		collector.clientCounts++
+	case *CloseClientPayload:
+		collector.clientCounts--
+	case *NewProxyPayload:
+		collector.proxyTypeCounts[v.ProxyType]++
+		collector.proxies[v.Name] = &promProxyStats{ProxyType: v.ProxyType}
+	case *CloseProxyPayload:
+		collector.proxyTypeCounts[v.ProxyType]--
+		delete(collector.proxies, v.Name)
+	case *OpenConnectionPayload:
+		collector.curConns++
+		if ps, ok := collector.proxies[v.ProxyName]; ok {
+			ps.CurConns++
+		}
+	case *CloseConnectionPayload:
+		collector.curConns--
+		if ps, ok := collector.proxies[v.ProxyName]; ok {
+			ps.CurConns--
+		}
+	case *AddTrafficInPayload:
+		if ps, ok := collector.proxies[v.ProxyName]; ok {
+			ps.TrafficIn += v.TrafficBytes
+		}
+	case *AddTrafficOutPayload:
+		if ps, ok := collector.proxies[v.ProxyName]; ok {
+			ps.TrafficOut += v.TrafficBytes
+		}
+	case *LoginFailedPayload:
+		collector.loginFailed++
+	case *WorkConnPoolPayload:
+		collector.workConnPoolSize += v.Delta
+	case *GetWorkConnPayload:
+		seconds := v.Duration.Seconds()
+		i := sort.SearchFloat64s(getWorkConnBuckets, seconds)
+		collector.getWorkConnCounts[i]++
+		collector.getWorkConnSum += seconds
+		collector.getWorkConnTotal++
+	}
+}
+
+func (collector *PrometheusCollector) GetServer() *ServerStats {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	s := &ServerStats{
+		CurConns:          collector.curConns,
+		ClientCounts:      collector.clientCounts,
+		ProxyTypeCounts:   make(map[string]int64),
+		LoginFailedCounts: collector.loginFailed,
+	}
+	for k, v := range collector.proxyTypeCounts {
+		s.ProxyTypeCounts[k] = v
+	}
+	return s
+}
+
+func (collector *PrometheusCollector) GetProxiesByType(proxyType string) []*ProxyStats {
+	return nil
+}
+
+func (collector *PrometheusCollector) GetProxiesByTypeAndName(proxyType string, proxyName string) *ProxyStats {
+	return nil
+}
+
+func (collector *PrometheusCollector) GetProxyTraffic(name string, granularity string) *ProxyTrafficInfo {
+	return nil
+}
+
+func (collector *PrometheusCollector) GetServerTraffic(granularity string) *ProxyTrafficInfo {
+	return nil
+}
+
+func (collector *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(collector.Expose())
+}
+
+// Expose returns all metrics in Prometheus text format.
+func (collector *PrometheusCollector) Expose() []byte {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	buf := bytes.NewBuffer(nil)
+	writeHeader := func(name string, typ string, help string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	writeHeader("frps_server_client_counts", "gauge", "Number of clients logged in.")
+	fmt.Fprintf(buf, "frps_server_client_counts %d\n", collector.clientCounts)
+
+	writeHeader("frps_server_proxy_counts", "gauge", "Number of proxies by type.")
+	types := make([]string, 0, len(collector.proxyTypeCounts))
+	for t := range collector.proxyTypeCounts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Fprintf(buf, "frps_server_proxy_counts{type=\"%s\"} %d\n", escapeLabel(t), collector.proxyTypeCounts[t])
+	}
+
+	writeHeader("frps_server_connections", "gauge", "Number of current user connections.")
+	fmt.Fprintf(buf, "frps_server_connections %d\n", collector.curConns)
+
+	writeHeader("frps_server_login_failed_total", "counter", "Number of failed logins.")
+	fmt.Fprintf(buf, "frps_server_login_failed_total %d\n", collector.loginFailed)
+
+	writeHeader("frps_server_work_conn_pool_size", "gauge", "Number of idle work connections in pools of all clients.")
+	fmt.Fprintf(buf, "frps_server_work_conn_pool_size %d\n", collector.workConnPoolSize)
+
+	name := "frps_server_get_work_conn_duration_seconds"
+	writeHeader(name, "histogram", "Latency of getting a work connection for a user connection.")
+	var cumulative int64
+	for i, le := range getWorkConnBuckets {
+		cumulative += collector.getWorkConnCounts[i]
+		fmt.Fprintf(buf, "%s_bucket{le=\"%g\"} %d\n", name, le, cumulative)
+	}
+	cumulative += collector.getWorkConnCounts[len(getWorkConnBuckets)]
+	fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(buf, "%s_sum %g\n", name, collector.getWorkConnSum)
+	fmt.Fprintf(buf, "%s_count %d\n", name, collector.getWorkConnTotal)
+
+	names := make([]string, 0, len(collector.proxies))
+	for n := range collector.proxies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	proxyMetrics := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(ps *promProxyStats) int64
+	}{
+		{"frps_proxy_connections", "gauge", "Number of current user connections of proxy.",
+			func(ps *promProxyStats) int64 { return ps.CurConns }},
+		{"frps_proxy_traffic_in_bytes_total", "counter", "Traffic in bytes of proxy.",
+			func(ps *promProxyStats) int64 { return ps.TrafficIn }},
+		{"frps_proxy_traffic_out_bytes_total", "counter", "Traffic out bytes of proxy.",
+			func(ps *promProxyStats) int64 { return ps.TrafficOut }},
+	}
+	for _, m := range proxyMetrics {
+		writeHeader(m.name, m.typ, m.help)
+		for _, n := range names {
+			ps := collector.proxies[n]
+			fmt.Fprintf(buf, "%s{name=\"%s\",type=\"%s\"} %d\n", m.name, escapeLabel(n), escapeLabel(ps.ProxyType), m.value(ps))
+		}
+	}
+	return buf.Bytes()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
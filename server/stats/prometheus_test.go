@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusCollectorExpose(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := NewPrometheusCollector()
+	collector.Mark(TypeNewClient, &NewClientPayload{})
+	collector.Mark(TypeNewProxy, &NewProxyPayload{Name: "web", ProxyType: "http"})
+	collector.Mark(TypeNewProxy, &NewProxyPayload{Name: `a"b`, ProxyType: "tcp"})
+	collector.Mark(TypeNewProxy, &NewProxyPayload{Name: "closed", ProxyType: "tcp"})
+	collector.Mark(TypeCloseProxy, &CloseProxyPayload{Name: "closed", ProxyType: "tcp"})
+	collector.Mark(TypeOpenConnection, &OpenConnectionPayload{ProxyName: "web"})
+	collector.Mark(TypeAddTrafficIn, &AddTrafficInPayload{ProxyName: "web", TrafficBytes: 100})
+	collector.Mark(TypeAddTrafficOut, &AddTrafficOutPayload{ProxyName: "web", TrafficBytes: 200})
+	collector.Mark(TypeLoginFailed, &LoginFailedPayload{User: "u", Reason: "invalid token"})
+	collector.Mark(TypeWorkConnPool, &WorkConnPoolPayload{Delta: 3})
+	collector.Mark(TypeGetWorkConn, &GetWorkConnPayload{Duration: 20 * time.Millisecond})
+	collector.Mark(TypeGetWorkConn, &GetWorkConnPayload{Duration: 20 * time.Second})
+
+	lines := strings.Split(string(collector.Expose()), "\n")
+	for _, expected := range []string{
+		"# TYPE frps_server_client_counts gauge",
+		"frps_server_client_counts 1",
+		`frps_server_proxy_counts{type="http"} 1`,
+		`frps_server_proxy_counts{type="tcp"} 1`,
+		"frps_server_connections 1",
+		"frps_server_login_failed_total 1",
+		"frps_server_work_conn_pool_size 3",
+		"# TYPE frps_server_get_work_conn_duration_seconds histogram",
+		`frps_server_get_work_conn_duration_seconds_bucket{le="0.01"} 0`,
+		`frps_server_get_work_conn_duration_seconds_bucket{le="0.025"} 1`,
+		`frps_server_get_work_conn_duration_seconds_bucket{le="10"} 1`,
+		`frps_server_get_work_conn_duration_seconds_bucket{le="+Inf"} 2`,
+		"frps_server_get_work_conn_duration_seconds_count 2",
+		`frps_proxy_connections{name="web",type="http"} 1`,
+		`frps_proxy_traffic_in_bytes_total{name="web",type="http"} 100`,
+		`frps_proxy_traffic_out_bytes_total{name="web",type="http"} 200`,
+		`frps_proxy_traffic_in_bytes_total{name="a\"b",type="tcp"} 0`,
+	} {
+		assert.Contains(lines, expected)
+	}
+	for _, line := range lines {
+		assert.NotContains(line, `name="closed"`)
+	}
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal("text/plain; version=0.0.4", w.Header().Get("Content-Type"))
+	assert.Equal(collector.Expose(), w.Body.Bytes())
+}
@@ -35,6 +35,11 @@ const (
 	TypeCloseConnection
 	TypeAddTrafficIn
 	TypeAddTrafficOut
+	TypeLoginFailed
+	TypeKickClient
+	TypeKickProxy
+	TypeWorkConnPool
+	TypeGetWorkConn
 )
 
 type ServerStats struct {
@@ -43,11 +48,19 @@ type ServerStats struct {
 	CurConns        int64
 	ClientCounts    int64
 	ProxyTypeCounts map[string]int64
+
+	LoginFailedCounts   int64
+	LastLoginFailedUser string
+	LastLoginFailedTime string
+
+	KickedClientCounts int64
+	KickedProxyCounts  int64
 }
 
 type ProxyStats struct {
 	Name            string
 	Type            string
+	User            string
 	TodayTrafficIn  int64
 	TodayTrafficOut int64
 	LastStartTime   string
@@ -64,16 +77,17 @@ type ProxyTrafficInfo struct {
 type ProxyStatistics struct {
 	Name          string
 	ProxyType     string
-	TrafficIn     metric.DateCounter
-	TrafficOut    metric.DateCounter
+	User          string
+	TrafficIn     *TrafficCounter
+	TrafficOut    *TrafficCounter
 	CurConns      metric.Counter
 	LastStartTime time.Time
 	LastCloseTime time.Time
 }
 
 type ServerStatistics struct {
-	TotalTrafficIn  metric.DateCounter
-	TotalTrafficOut metric.DateCounter
+	TotalTrafficIn  *TrafficCounter
+	TotalTrafficOut *TrafficCounter
 	CurConns        metric.Counter
 
 	// counter for clients
@@ -82,6 +96,15 @@ type ServerStatistics struct {
 	// counter for proxy types
 	ProxyTypeCounts map[string]metric.Counter
 
+	// counter for failed logins
+	LoginFailedCounts   metric.Counter
+	LastLoginFailedUser string
+	LastLoginFailedTime time.Time
+
+	// counter for clients and proxies kicked from dashboard
+	KickedClientCounts metric.Counter
+	KickedProxyCounts  metric.Counter
+
 	// statistics for different proxies
 	// key is proxy name
 	ProxyStatistics map[string]*ProxyStatistics
@@ -90,10 +113,12 @@ type ServerStatistics struct {
 type Collector interface {
 	Mark(statsType StatsType, payload interface{})
 	Run() error
+	Close() error
 	GetServer() *ServerStats
 	GetProxiesByType(proxyType string) []*ProxyStats
 	GetProxiesByTypeAndName(proxyType string, proxyName string) *ProxyStats
-	GetProxyTraffic(name string) *ProxyTrafficInfo
+	GetProxyTraffic(name string, granularity string) *ProxyTrafficInfo
+	GetServerTraffic(granularity string) *ProxyTrafficInfo
 }
 
 type NewClientPayload struct{}
@@ -103,6 +128,7 @@ type CloseClientPayload struct{}
 type NewProxyPayload struct {
 	Name      string
 	ProxyType string
+	User      string
 }
 
 type CloseProxyPayload struct {
@@ -127,3 +153,82 @@ type AddTrafficOutPayload struct {
 	ProxyName    string
 	TrafficBytes int64
 }
+
+type LoginFailedPayload struct {
+	User   string
+	Reason string
+}
+
+type KickClientPayload struct {
+	User string
+}
+
+type KickProxyPayload struct {
+	Name      string
+	ProxyType string
+}
+
+// WorkConnPoolPayload changes the number of idle work connections in pools.
+type WorkConnPoolPayload struct {
+	Delta int64
+}
+
+type GetWorkConnPayload struct {
+	Duration time.Duration
+}
+
+type multiCollector struct {
+	collectors []Collector
+}
+
+// NewMultiCollector returns a collector marking stats in all collectors,
+// stats are got from the first one.
+func NewMultiCollector(collectors ...Collector) Collector {
+	return &multiCollector{
+		collectors: collectors,
+	}
+}
+
+func (mc *multiCollector) Mark(statsType StatsType, payload interface{}) {
+	for _, c := range mc.collectors {
+		c.Mark(statsType, payload)
+	}
+}
+
+func (mc *multiCollector) Run() (err error) {
+	for _, c := range mc.collectors {
+		if errRet := c.Run(); errRet != nil && err == nil {
+			err = errRet
+		}
+	}
+	return
+}
+
+func (mc *multiCollector) Close() (err error) {
+	for _, c := range mc.collectors {
+		if errRet := c.Close(); errRet != nil && err == nil {
+			err = errRet
+		}
+	}
+	return
+}
+
+func (mc *multiCollector) GetServer() *ServerStats {
+	return mc.collectors[0].GetServer()
+}
+
+func (mc *multiCollector) GetProxiesByType(proxyType string) []*ProxyStats {
+	return mc.collectors[0].GetProxiesByType(proxyType)
+}
+
+func (mc *multiCollector) GetProxiesByTypeAndName(proxyType string, proxyName string) *ProxyStats {
+	return mc.collectors[0].GetProxiesByTypeAndName(proxyType, proxyName)
+}
+
+func (mc *multiCollector) GetProxyTraffic(name string, granularity string) *ProxyTrafficInfo {
+	return mc.collectors[0].GetProxyTraffic(name, granularity)
+}
+
+func (mc *multiCollector) GetServerTraffic(granularity string) *ProxyTrafficInfo {
+	return mc.collectors[0].GetServerTraffic(granularity)
+}
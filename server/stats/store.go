@@ -0,0 +1,173 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/whysmx/frp/utils/metric"
+)
+
+// trafficSnapshot keeps counts of one direction, traffic of days is saved
+// with the key of the direction itself, like "traffic_in".
+type trafficSnapshot struct {
+	Days    []int64
+	Hours   []int64
+	Minutes []int64
+}
+
+func newTrafficSnapshot(tc *TrafficCounter) trafficSnapshot {
+	return trafficSnapshot{
+		Days:    tc.GetCounts(GranularityDay),
+		Hours:   tc.GetCounts(GranularityHour),
+		Minutes: tc.GetCounts(GranularityMinute),
+	}
+}
+
+func (ts trafficSnapshot) restore(reserveDays int64, t time.Time) *TrafficCounter {
+	return restoreTrafficCounter(reserveDays, t, ts.Minutes, ts.Hours, ts.Days)
+}
+
+type proxySnapshot struct {
+	Name              string    `json:"name"`
+	ProxyType         string    `json:"proxy_type"`
+	User              string    `json:"user"`
+	TrafficIn         []int64   `json:"traffic_in"`
+	TrafficInHours    []int64   `json:"traffic_in_hours"`
+	TrafficInMinutes  []int64   `json:"traffic_in_minutes"`
+	TrafficOut        []int64   `json:"traffic_out"`
+	TrafficOutHours   []int64   `json:"traffic_out_hours"`
+	TrafficOutMinutes []int64   `json:"traffic_out_minutes"`
+	LastStartTime     time.Time `json:"last_start_time"`
+	LastCloseTime     time.Time `json:"last_close_time"`
+}
+
+// statsSnapshot is saved in stats file, traffic counts start from the
+// minute, hour and day of SaveTime.
+type statsSnapshot struct {
+	SaveTime               time.Time        `json:"save_time"`
+	TotalTrafficIn         []int64          `json:"total_traffic_in"`
+	TotalTrafficInHours    []int64          `json:"total_traffic_in_hours"`
+	TotalTrafficInMinutes  []int64          `json:"total_traffic_in_minutes"`
+	TotalTrafficOut        []int64          `json:"total_traffic_out"`
+	TotalTrafficOutHours   []int64          `json:"total_traffic_out_hours"`
+	TotalTrafficOutMinutes []int64          `json:"total_traffic_out_minutes"`
+	Proxies                []*proxySnapshot `json:"proxies"`
+}
+
+// Save writes traffic statistics to file. It writes a temporary file first
+// so the old one is kept if frps exits while saving.
+func (collector *internalCollector) Save(file string) error {
+	collector.mu.Lock()
+	in := newTrafficSnapshot(collector.info.TotalTrafficIn)
+	out := newTrafficSnapshot(collector.info.TotalTrafficOut)
+	snapshot := &statsSnapshot{
+		SaveTime:               time.Now(),
+		TotalTrafficIn:         in.Days,
+		TotalTrafficInHours:    in.Hours,
+		TotalTrafficInMinutes:  in.Minutes,
+		TotalTrafficOut:        out.Days,
+		TotalTrafficOutHours:   out.Hours,
+		TotalTrafficOutMinutes: out.Minutes,
+		Proxies:                make([]*proxySnapshot, 0, len(collector.info.ProxyStatistics)),
+	}
+	for _, ps := range collector.info.ProxyStatistics {
+		in = newTrafficSnapshot(ps.TrafficIn)
+		out = newTrafficSnapshot(ps.TrafficOut)
+		snapshot.Proxies = append(snapshot.Proxies, &proxySnapshot{
+			Name:              ps.Name,
+			ProxyType:         ps.ProxyType,
+			User:              ps.User,
+			TrafficIn:         in.Days,
+			TrafficInHours:    in.Hours,
+			TrafficInMinutes:  in.Minutes,
+			TrafficOut:        out.Days,
+			TrafficOutHours:   out.Hours,
+			TrafficOutMinutes: out.Minutes,
+			LastStartTime:     ps.LastStartTime,
+			LastCloseTime:     ps.LastCloseTime,
+		})
+	}
+	collector.mu.Unlock()
+
+	buf, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmpFile := file + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// Load restores traffic statistics from file, it's not an error if file
+// doesn't exist.
+func (collector *internalCollector) Load(file string) error {
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	snapshot := &statsSnapshot{}
+	if err = json.Unmarshal(buf, snapshot); err != nil {
+		return err
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	t := snapshot.SaveTime
+	collector.info.TotalTrafficIn = trafficSnapshot{
+		Days:    snapshot.TotalTrafficIn,
+		Hours:   snapshot.TotalTrafficInHours,
+		Minutes: snapshot.TotalTrafficInMinutes,
+	}.restore(collector.reserveDays, t)
+	collector.info.TotalTrafficOut = trafficSnapshot{
+		Days:    snapshot.TotalTrafficOut,
+		Hours:   snapshot.TotalTrafficOutHours,
+		Minutes: snapshot.TotalTrafficOutMinutes,
+	}.restore(collector.reserveDays, t)
+	for _, p := range snapshot.Proxies {
+		ps := &ProxyStatistics{
+			Name:      p.Name,
+			ProxyType: p.ProxyType,
+			User:      p.User,
+			CurConns:  metric.NewCounter(),
+			TrafficIn: trafficSnapshot{
+				Days:    p.TrafficIn,
+				Hours:   p.TrafficInHours,
+				Minutes: p.TrafficInMinutes,
+			}.restore(collector.reserveDays, t),
+			TrafficOut: trafficSnapshot{
+				Days:    p.TrafficOut,
+				Hours:   p.TrafficOutHours,
+				Minutes: p.TrafficOutMinutes,
+			}.restore(collector.reserveDays, t),
+			LastStartTime: p.LastStartTime,
+			LastCloseTime: p.LastCloseTime,
+		}
+		// Proxies online when saving are closed since then.
+		if ps.LastCloseTime.Before(ps.LastStartTime) {
+			ps.LastCloseTime = snapshot.SaveTime
+		}
+		collector.info.ProxyStatistics[p.Name] = ps
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frps_stats")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "stats.json")
+
+	collector := NewInternalCollector(true, 7, file, time.Hour).(*internalCollector)
+	collector.Mark(TypeNewProxy, &NewProxyPayload{Name: "web", ProxyType: "http", User: "u"})
+	collector.Mark(TypeAddTrafficIn, &AddTrafficInPayload{ProxyName: "web", TrafficBytes: 100})
+	collector.Mark(TypeAddTrafficOut, &AddTrafficOutPayload{ProxyName: "web", TrafficBytes: 200})
+	collector.Mark(TypeNewProxy, &NewProxyPayload{Name: "ssh", ProxyType: "tcp"})
+	collector.Mark(TypeAddTrafficIn, &AddTrafficInPayload{ProxyName: "ssh", TrafficBytes: 10})
+	collector.Mark(TypeCloseProxy, &CloseProxyPayload{Name: "ssh", ProxyType: "tcp"})
+	assert.NoError(collector.Run())
+	assert.NoError(collector.Close())
+
+	// Close saves only once.
+	assert.NoError(os.Remove(file))
+	assert.NoError(collector.Close())
+	_, err = os.Stat(file)
+	assert.True(os.IsNotExist(err))
+	assert.NoError(collector.Save(file))
+
+	loaded := NewInternalCollector(true, 7, file, time.Hour).(*internalCollector)
+	assert.NoError(loaded.Run())
+	defer loaded.Close()
+
+	for _, granularity := range []string{GranularityDay, GranularityHour, GranularityMinute} {
+		assert.Equal(collector.GetServerTraffic(granularity), loaded.GetServerTraffic(granularity))
+		assert.Equal(collector.GetProxyTraffic("web", granularity), loaded.GetProxyTraffic("web", granularity))
+		assert.Equal(collector.GetProxyTraffic("ssh", granularity), loaded.GetProxyTraffic("ssh", granularity))
+	}
+	assert.EqualValues(110, loaded.GetServerTraffic(GranularityDay).TrafficIn[0])
+	assert.EqualValues(200, loaded.GetServerTraffic(GranularityDay).TrafficOut[0])
+
+	web := loaded.GetProxiesByTypeAndName("http", "web")
+	if assert.NotNil(web) {
+		assert.Equal("u", web.User)
+		assert.EqualValues(100, web.TodayTrafficIn)
+		assert.EqualValues(200, web.TodayTrafficOut)
+		// proxies online when saving are closed after loading
+		assert.NotEmpty(web.LastCloseTime)
+	}
+	ssh := loaded.GetProxiesByTypeAndName("tcp", "ssh")
+	if assert.NotNil(ssh) {
+		assert.EqualValues(10, ssh.TodayTrafficIn)
+	}
+}
+
+func TestLoadNotExist(t *testing.T) {
+	assert := assert.New(t)
+
+	collector := NewInternalCollector(true, 7, "", time.Hour).(*internalCollector)
+	assert.NoError(collector.Load("/not/exist/stats.json"))
+}
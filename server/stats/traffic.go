@@ -0,0 +1,94 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"time"
+
+	"github.com/whysmx/frp/utils/metric"
+)
+
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+)
+
+const (
+	ReserveMinutes = 60
+	ReserveHours   = 72
+)
+
+func IsValidGranularity(granularity string) bool {
+	switch granularity {
+	case GranularityMinute, GranularityHour, GranularityDay:
+		return true
+	default:
+		return false
+	}
+}
+
+// TrafficCounter counts traffic of one direction per minute for the last
+// hour, per hour for the last days and per day for reserved days.
+type TrafficCounter struct {
+	Minute metric.TimeCounter
+	Hour   metric.TimeCounter
+	Day    metric.DateCounter
+
+	reserveDays int64
+}
+
+func NewTrafficCounter(reserveDays int64) *TrafficCounter {
+	return &TrafficCounter{
+		Minute:      metric.NewTimeCounter(time.Minute, ReserveMinutes),
+		Hour:        metric.NewTimeCounter(time.Hour, ReserveHours),
+		Day:         metric.NewDateCounter(reserveDays),
+		reserveDays: reserveDays,
+	}
+}
+
+func (tc *TrafficCounter) Inc(count int64) {
+	tc.Minute.Inc(count)
+	tc.Hour.Inc(count)
+	tc.Day.Inc(count)
+}
+
+func (tc *TrafficCounter) TodayCount() int64 {
+	return tc.Day.TodayCount()
+}
+
+// GetCounts returns all counts of granularity from now on, counts of day are
+// returned if granularity is unknown.
+func (tc *TrafficCounter) GetCounts(granularity string) []int64 {
+	switch granularity {
+	case GranularityMinute:
+		return tc.Minute.GetLastCounts(ReserveMinutes)
+	case GranularityHour:
+		return tc.Hour.GetLastCounts(ReserveHours)
+	default:
+		return tc.Day.GetLastDaysCount(tc.reserveDays)
+	}
+}
+
+// restoreTrafficCounter returns a traffic counter restored from counts got
+// by GetCounts at time t.
+func restoreTrafficCounter(reserveDays int64, t time.Time, minutes []int64, hours []int64, days []int64) *TrafficCounter {
+	return &TrafficCounter{
+		Minute:      metric.NewTimeCounterWithCounts(time.Minute, ReserveMinutes, t, minutes),
+		Hour:        metric.NewTimeCounterWithCounts(time.Hour, ReserveHours, t, hours),
+		Day:         metric.NewDateCounterWithCounts(reserveDays, t, days),
+		reserveDays: reserveDays,
+	}
+}
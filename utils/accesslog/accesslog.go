@@ -0,0 +1,106 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog writes one JSON object per line for every user connection
+// of proxies. It's separated from the debug log so it can be retained longer.
+package accesslog
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/whysmx/frp/utils/log"
+)
+
+// Reasons why a user connection is closed.
+const (
+	ReasonUserClosed          = "user_closed"
+	ReasonClientClosed        = "client_closed"
+	ReasonClosedFromDashboard = "closed_from_dashboard"
+	ReasonRejected            = "rejected"
+	ReasonNoWorkConn          = "no_work_conn"
+	ReasonIdleTimeout         = "idle_timeout"
+	ReasonProxyClosed         = "proxy_closed"
+	ReasonError               = "error"
+)
+
+// Entry is one user connection, Time and DurationMs are set by Record.
+type Entry struct {
+	Time        string `json:"time"`
+	ProxyName   string `json:"proxy_name"`
+	ProxyType   string `json:"proxy_type"`
+	RunId       string `json:"run_id"`
+	User        string `json:"user"`
+	RemoteAddr  string `json:"remote_addr"`
+	DurationMs  int64  `json:"duration_ms"`
+	TrafficIn   int64  `json:"traffic_in"`
+	TrafficOut  int64  `json:"traffic_out"`
+	CloseReason string `json:"close_reason"`
+	Error       string `json:"error,omitempty"`
+}
+
+type Logger struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// Access is the default logger, entries are dropped if it's nil.
+var Access *Logger
+
+// InitAccessLog opens the access log file, empty file means access log is
+// disabled.
+func InitAccessLog(file string) (err error) {
+	if file == "" {
+		return
+	}
+	Access, err = NewLogger(file)
+	return
+}
+
+func NewLogger(file string) (*Logger, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{f: f}, nil
+}
+
+// Record writes one entry of the user connection lasted from start to end.
+func (l *Logger) Record(start time.Time, end time.Time, e *Entry) {
+	e.Time = start.Format(time.RFC3339)
+	e.DurationMs = int64(end.Sub(start) / time.Millisecond)
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		log.Warn("marshal access log of proxy [%s] error: %v", e.ProxyName, err)
+		return
+	}
+	buf = append(buf, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.f.Write(buf); err != nil {
+		log.Warn("write access log of proxy [%s] error: %v", e.ProxyName, err)
+	}
+}
+
+// Record writes one entry to the default logger.
+func Record(start time.Time, end time.Time, e *Entry) {
+	if Access == nil {
+		return
+	}
+	Access.Record(start, end, e)
+}
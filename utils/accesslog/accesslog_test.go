@@ -0,0 +1,69 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "frp_accesslog")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "access.log")
+
+	// entries are dropped if access log is disabled
+	assert.NoError(InitAccessLog(""))
+	assert.Nil(Access)
+	Record(time.Now(), time.Now(), &Entry{ProxyName: "dropped"})
+
+	assert.NoError(InitAccessLog(file))
+	defer func() {
+		Access = nil
+	}()
+
+	start := time.Date(2019, 10, 1, 8, 0, 0, 0, time.UTC)
+	Record(start, start.Add(1500*time.Millisecond), &Entry{
+		ProxyName:   "ssh",
+		ProxyType:   "tcp",
+		RemoteAddr:  "127.0.0.1:12345",
+		TrafficIn:   10,
+		TrafficOut:  20,
+		CloseReason: ReasonUserClosed,
+	})
+	Record(start, start, &Entry{
+		ProxyName:   "ssh",
+		CloseReason: ReasonError,
+		Error:       "connection refused",
+	})
+
+	buf, err := ioutil.ReadFile(file)
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if !assert.Len(lines, 2) {
+		return
+	}
+
+	e := &Entry{}
+	assert.NoError(json.Unmarshal([]byte(lines[0]), e))
+	assert.Equal(&Entry{
+		Time:        "2019-10-01T08:00:00Z",
+		ProxyName:   "ssh",
+		ProxyType:   "tcp",
+		RemoteAddr:  "127.0.0.1:12345",
+		DurationMs:  1500,
+		TrafficIn:   10,
+		TrafficOut:  20,
+		CloseReason: ReasonUserClosed,
+	}, e)
+	assert.NotContains(lines[0], `"error"`)
+	assert.Contains(lines[1], `"error":"connection refused"`)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit writes control-plane events to an append-only file, one JSON
+// object per line.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/whysmx/frp/utils/log"
+)
+
+// Events of frps.
+const (
+	EventLogin             = "login"
+	EventLoginFailed       = "login_failed"
+	EventNewProxy          = "new_proxy"
+	EventCloseProxy        = "close_proxy"
+	EventVisitorAuthFailed = "visitor_auth_failed"
+	EventKick              = "kick"
+	EventDrain             = "drain"
+	EventCloseUserConn     = "close_user_conn"
+)
+
+// Events of frpc.
+const (
+	EventConfigUpdate = "config_update"
+)
+
+// Events of both frps and frpc.
+const (
+	EventReload = "reload"
+)
+
+type Fields map[string]interface{}
+
+type Logger struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// Audit is the default logger, events are dropped if it's nil.
+var Audit *Logger
+
+// InitAudit opens the audit log file, empty file means audit log is disabled.
+func InitAudit(file string) (err error) {
+	if file == "" {
+		return
+	}
+	Audit, err = NewLogger(file)
+	return
+}
+
+func NewLogger(file string) (*Logger, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{f: f}, nil
+}
+
+// Record writes one event with its fields, "time" and "event" fields are
+// added automatically.
+func (l *Logger) Record(event string, fields Fields) {
+	record := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		record[k] = v
+	}
+	record["time"] = time.Now().Format(time.RFC3339)
+	record["event"] = event
+
+	buf, err := json.Marshal(record)
+	if err != nil {
+		log.Warn("marshal audit event [%s] error: %v", event, err)
+		return
+	}
+	buf = append(buf, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.f.Write(buf); err != nil {
+		log.Warn("write audit event [%s] error: %v", event, err)
+	}
+}
+
+// Record writes one event to the default logger.
+func Record(event string, fields Fields) {
+	if Audit == nil {
+		return
+	}
+	Audit.Record(event, fields)
+}
@@ -35,6 +35,20 @@ func NewDateCounter(reserveDays int64) DateCounter {
 	return newStandardDateCounter(reserveDays)
 }
 
+// NewDateCounterWithCounts returns a date counter restored from counts of
+// reserved days, counts[0] is the count of the day date.
+func NewDateCounterWithCounts(reserveDays int64, date time.Time, counts []int64) DateCounter {
+	if reserveDays <= 0 {
+		reserveDays = 1
+	}
+	c := newStandardDateCounter(reserveDays)
+	for i := 0; i < len(counts) && i < int(reserveDays); i++ {
+		c.counts[i] = counts[i]
+	}
+	c.lastUpdateDate = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, c.lastUpdateDate.Location())
+	return c
+}
+
 type StandardDateCounter struct {
 	reserveDays int64
 	counts      []int64
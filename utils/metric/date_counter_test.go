@@ -2,6 +2,7 @@ package metric
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,3 +26,16 @@ func TestDateCounter(t *testing.T) {
 	dcTmp := dc.Snapshot()
 	assert.EqualValues(5, dcTmp.TodayCount())
 }
+
+func TestDateCounterWithCounts(t *testing.T) {
+	assert := assert.New(t)
+
+	dc := NewDateCounterWithCounts(3, time.Now(), []int64{1, 2, 3, 4})
+	assert.EqualValues([]int64{1, 2, 3}, dc.GetLastDaysCount(3))
+
+	dc = NewDateCounterWithCounts(3, time.Now().AddDate(0, 0, -1), []int64{1, 2})
+	assert.EqualValues([]int64{0, 1, 2}, dc.GetLastDaysCount(3))
+
+	dc = NewDateCounterWithCounts(3, time.Now().AddDate(0, 0, -3), []int64{1, 2, 3})
+	assert.EqualValues([]int64{0, 0, 0}, dc.GetLastDaysCount(3))
+}
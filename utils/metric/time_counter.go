@@ -0,0 +1,124 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeCounter counts in rolling buckets of a fixed interval like one minute
+// or one hour, buckets older than reserve intervals are dropped.
+type TimeCounter interface {
+	CurrentCount() int64
+	GetLastCounts(last int64) []int64
+	Inc(int64)
+	Dec(int64)
+}
+
+func NewTimeCounter(interval time.Duration, reserve int64) TimeCounter {
+	if reserve <= 0 {
+		reserve = 1
+	}
+	return newStandardTimeCounter(interval, reserve)
+}
+
+// NewTimeCounterWithCounts returns a time counter restored from counts,
+// counts[0] is the count of the bucket t belongs to.
+func NewTimeCounterWithCounts(interval time.Duration, reserve int64, t time.Time, counts []int64) TimeCounter {
+	if reserve <= 0 {
+		reserve = 1
+	}
+	c := newStandardTimeCounter(interval, reserve)
+	for i := 0; i < len(counts) && i < int(reserve); i++ {
+		c.counts[i] = counts[i]
+	}
+	c.lastUpdateTime = t.Truncate(interval)
+	return c
+}
+
+type StandardTimeCounter struct {
+	interval time.Duration
+	reserve  int64
+	counts   []int64
+
+	lastUpdateTime time.Time
+	mu             sync.Mutex
+}
+
+func newStandardTimeCounter(interval time.Duration, reserve int64) *StandardTimeCounter {
+	return &StandardTimeCounter{
+		interval:       interval,
+		reserve:        reserve,
+		counts:         make([]int64, reserve),
+		lastUpdateTime: time.Now().Truncate(interval),
+	}
+}
+
+func (c *StandardTimeCounter) CurrentCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rotate(time.Now())
+	return c.counts[0]
+}
+
+func (c *StandardTimeCounter) GetLastCounts(last int64) []int64 {
+	if last > c.reserve {
+		last = c.reserve
+	}
+	counts := make([]int64, last)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate(time.Now())
+	copy(counts, c.counts)
+	return counts
+}
+
+func (c *StandardTimeCounter) Inc(count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate(time.Now())
+	c.counts[0] += count
+}
+
+func (c *StandardTimeCounter) Dec(count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate(time.Now())
+	c.counts[0] -= count
+}
+
+// rotate
+// Must hold the lock before calling this function.
+func (c *StandardTimeCounter) rotate(now time.Time) {
+	now = now.Truncate(c.interval)
+	n := int64(now.Sub(c.lastUpdateTime) / c.interval)
+
+	defer func() {
+		c.lastUpdateTime = now
+	}()
+
+	if n <= 0 {
+		return
+	} else if n >= c.reserve {
+		c.counts = make([]int64, c.reserve)
+		return
+	}
+	newCounts := make([]int64, c.reserve)
+	copy(newCounts[n:], c.counts)
+	c.counts = newCounts
+}
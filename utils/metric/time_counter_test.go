@@ -0,0 +1,30 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	tc := NewTimeCounter(time.Minute, 3)
+	tc.Inc(10)
+	tc.Dec(5)
+	assert.EqualValues(5, tc.CurrentCount())
+
+	counts := tc.GetLastCounts(5)
+	assert.EqualValues([]int64{5, 0, 0}, counts)
+}
+
+func TestTimeCounterWithCounts(t *testing.T) {
+	assert := assert.New(t)
+
+	tc := NewTimeCounterWithCounts(time.Minute, 3, time.Now().Add(-time.Minute), []int64{1, 2, 3})
+	assert.EqualValues([]int64{0, 1, 2}, tc.GetLastCounts(3))
+
+	tc = NewTimeCounterWithCounts(time.Minute, 3, time.Now().Add(-3*time.Minute), []int64{1, 2, 3})
+	assert.EqualValues([]int64{0, 0, 0}, tc.GetLastCounts(3))
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type HttpAuthWraper struct {
@@ -48,6 +49,7 @@ func (aw *HttpAuthWraper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type HttpAuthMiddleware struct {
 	user   string
 	passwd string
+	mu     sync.RWMutex
 }
 
 func NewHttpAuthMiddleware(user, passwd string) *HttpAuthMiddleware {
@@ -57,11 +59,23 @@ func NewHttpAuthMiddleware(user, passwd string) *HttpAuthMiddleware {
 	}
 }
 
+// SetAuth changes user and passwd for new requests.
+func (authMid *HttpAuthMiddleware) SetAuth(user, passwd string) {
+	authMid.mu.Lock()
+	defer authMid.mu.Unlock()
+	authMid.user = user
+	authMid.passwd = passwd
+}
+
 func (authMid *HttpAuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authMid.mu.RLock()
+		user, passwd := authMid.user, authMid.passwd
+		authMid.mu.RUnlock()
+
 		reqUser, reqPasswd, hasAuth := r.BasicAuth()
-		if (authMid.user == "" && authMid.passwd == "") ||
-			(hasAuth && reqUser == authMid.user && reqPasswd == authMid.passwd) {
+		if (user == "" && passwd == "") ||
+			(hasAuth && reqUser == user && reqPasswd == passwd) {
 			next.ServeHTTP(w, r)
 		} else {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
@@ -15,7 +15,14 @@
 package net
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"time"
 
@@ -32,7 +39,10 @@ func WrapTLSClientConn(c net.Conn, tlsConfig *tls.Config) (out Conn) {
 	return
 }
 
-func CheckAndEnableTLSServerConnWithTimeout(c net.Conn, tlsConfig *tls.Config, timeout time.Duration) (out Conn, err error) {
+// CheckAndEnableTLSServerConnWithTimeout checks the first byte of c and wraps it in a TLS server
+// connection if it's FRP_TLS_HEAD_BYTE. The TLS handshake is done before returning, so a client
+// without a valid certificate is rejected here. If tlsOnly is true, plain connections are rejected.
+func CheckAndEnableTLSServerConnWithTimeout(c net.Conn, tlsConfig *tls.Config, tlsOnly bool, timeout time.Duration) (out Conn, err error) {
 	sc, r := gnet.NewSharedConnSize(c, 2)
 	buf := make([]byte, 1)
 	var n int
@@ -44,9 +54,103 @@ func CheckAndEnableTLSServerConnWithTimeout(c net.Conn, tlsConfig *tls.Config, t
 	}
 
 	if n == 1 && int(buf[0]) == FRP_TLS_HEAD_BYTE {
-		out = WrapConn(tls.Server(c, tlsConfig))
+		tlsConn := tls.Server(c, tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		err = tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			return
+		}
+		out = WrapConn(tlsConn)
 	} else {
+		if tlsOnly {
+			err = fmt.Errorf("non-TLS connection received on a TLS only server")
+			return
+		}
 		out = WrapConn(sc)
 	}
 	return
 }
+
+// NewServerTLSConfig creates the TLS config used by frps. If certFile and keyFile are empty, a
+// self-signed certificate is generated. If caFile is not empty, clients must present a certificate
+// signed by it.
+func NewServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if certFile != "" && keyFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		cert, err = newRandomTLSKeyPair()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if caFile != "" {
+		pool, err := newCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = pool
+	}
+	return config, nil
+}
+
+// NewClientTLSConfig creates the TLS config used by frpc. If caFile is empty, the certificate of
+// frps is not verified.
+func NewClientTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pool, err := newCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+		config.ServerName = serverName
+	} else {
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+func newCertPool(caFile string) (*x509.CertPool, error) {
+	caCrt, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCrt) {
+		return nil, fmt.Errorf("no valid certificate found in [%s]", caFile)
+	}
+	return pool, nil
+}
+
+func newRandomTLSKeyPair() (cert tls.Certificate, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+	template := x509.Certificate{SerialNumber: big.NewInt(1)}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/whysmx/frp/utils/version"
+)
+
+const (
+	AuthSchemeMd5        = "md5"
+	AuthSchemeHmacSha256 = "hmac_sha256"
+)
+
+// Purposes of privilege keys sent by frpc after login. A key of hmac_sha256
+// scheme is only valid for one purpose of one client, so a key captured from
+// a plaintext xtcp packet can't be used to login or for other purposes.
+const (
+	AuthPurposeNewWorkConn    = "new_work_conn"
+	AuthPurposePing           = "ping"
+	AuthPurposeNewVisitorConn = "new_visitor_conn"
+	AuthPurposeNatHoleVisitor = "nat_hole_visitor"
+)
+
+// Auth schemes from the weakest to the strongest.
+var authSchemes = []string{AuthSchemeMd5, AuthSchemeHmacSha256}
+
+// Frp versions start using hmac_sha256 auth scheme.
+const hmacSha256AuthVersion = "0.28.0"
+
+func IsValidAuthScheme(scheme string) bool {
+	return authSchemeLevel(scheme) >= 0
+}
+
+func authSchemeLevel(scheme string) int {
+	for i, s := range authSchemes {
+		if s == scheme {
+			return i
+		}
+	}
+	return -1
+}
+
+// AuthSchemeAllowed returns true if scheme is not weaker than minScheme.
+func AuthSchemeAllowed(scheme string, minScheme string) bool {
+	return authSchemeLevel(scheme) >= authSchemeLevel(minScheme)
+}
+
+// allowedAuthSchemes returns auth schemes not weaker than minScheme, from the
+// strongest to the weakest.
+func allowedAuthSchemes(minScheme string) []string {
+	schemes := make([]string, 0, len(authSchemes))
+	for i := len(authSchemes) - 1; i >= 0; i-- {
+		if AuthSchemeAllowed(authSchemes[i], minScheme) {
+			schemes = append(schemes, authSchemes[i])
+		}
+	}
+	return schemes
+}
+
+// NegotiateAuthScheme returns the auth scheme used with the peer of version peerVersion.
+func NegotiateAuthScheme(peerVersion string) string {
+	if version.LessThan(peerVersion, hmacSha256AuthVersion) {
+		return AuthSchemeMd5
+	}
+	return AuthSchemeHmacSha256
+}
+
+func GetHmacAuthKey(token string, timestamp int64) (key string) {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(fmt.Sprintf("%d", timestamp)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetAuthKeyWithScheme returns the auth key of token and timestamp, md5 is used
+// if scheme is unknown.
+func GetAuthKeyWithScheme(scheme string, token string, timestamp int64) (key string) {
+	if scheme == AuthSchemeHmacSha256 {
+		return GetHmacAuthKey(token, timestamp)
+	}
+	return GetAuthKey(token, timestamp)
+}
+
+// CheckAuthKey returns the scheme of key if it's created from token and
+// timestamp by any scheme not weaker than minScheme. All allowed schemes are
+// tried since frpc of other builds may report a new version but still use md5.
+func CheckAuthKey(minScheme string, token string, timestamp int64, key string) (scheme string, ok bool) {
+	for _, scheme = range allowedAuthSchemes(minScheme) {
+		if GetAuthKeyWithScheme(scheme, token, timestamp) == key {
+			return scheme, true
+		}
+	}
+	return "", false
+}
+
+// GetPrivilegeKey returns the privilege key of messages for purpose sent by
+// the client of runId after login. Keys of md5 scheme are the same as the
+// login key for compatibility with old versions.
+func GetPrivilegeKey(scheme string, token string, purpose string, runId string, timestamp int64) (key string) {
+	if scheme != AuthSchemeHmacSha256 {
+		return GetAuthKey(token, timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(fmt.Sprintf("%s|%s|%d", purpose, runId, timestamp)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetVisitorAuthKey returns the sign key of a visitor connection. The nonce
+// makes sign keys different even if they are created in the same second.
+func GetVisitorAuthKey(scheme string, sk string, timestamp int64, nonce string) (key string) {
+	return GetAuthKeyWithScheme(scheme, sk+nonce, timestamp)
+}
+
+// GetSkFingerprint returns a short fingerprint to tell which secret key is
+// used without exposing it.
+func GetSkFingerprint(sk string) string {
+	sum := sha256.Sum256([]byte(sk))
+	return hex.EncodeToString(sum[:4])
+}
+
+// CheckVisitorAuthKey returns true if signKey is created by any scheme not
+// weaker than minScheme. Visitors don't login with a version, so all
+// allowed schemes are tried.
+func CheckVisitorAuthKey(minScheme string, sk string, timestamp int64, nonce string, signKey string) bool {
+	for _, scheme := range allowedAuthSchemes(minScheme) {
+		if GetVisitorAuthKey(scheme, sk, timestamp, nonce) == signKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateAuthScheme(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(AuthSchemeMd5, NegotiateAuthScheme("0.27.1"))
+	assert.Equal(AuthSchemeHmacSha256, NegotiateAuthScheme("0.28.0"))
+	assert.True(AuthSchemeAllowed(AuthSchemeHmacSha256, AuthSchemeMd5))
+	assert.False(AuthSchemeAllowed(AuthSchemeMd5, AuthSchemeHmacSha256))
+}
+
+func TestCheckVisitorAuthKey(t *testing.T) {
+	assert := assert.New(t)
+	md5Key := GetVisitorAuthKey(AuthSchemeMd5, "abc", 1488720000, "")
+	assert.Equal(GetAuthKey("abc", 1488720000), md5Key)
+	hmacKey := GetVisitorAuthKey(AuthSchemeHmacSha256, "abc", 1488720000, "")
+	assert.NotEqual(md5Key, hmacKey)
+
+	assert.True(CheckVisitorAuthKey(AuthSchemeMd5, "abc", 1488720000, "", md5Key))
+	assert.True(CheckVisitorAuthKey(AuthSchemeMd5, "abc", 1488720000, "", hmacKey))
+	assert.False(CheckVisitorAuthKey(AuthSchemeHmacSha256, "abc", 1488720000, "", md5Key))
+	assert.True(CheckVisitorAuthKey(AuthSchemeHmacSha256, "abc", 1488720000, "", hmacKey))
+}
+
+func TestCheckAuthKey(t *testing.T) {
+	assert := assert.New(t)
+	md5Key := GetAuthKeyWithScheme(AuthSchemeMd5, "abc", 1488720000)
+	hmacKey := GetAuthKeyWithScheme(AuthSchemeHmacSha256, "abc", 1488720000)
+
+	scheme, ok := CheckAuthKey(AuthSchemeMd5, "abc", 1488720000, md5Key)
+	assert.True(ok)
+	assert.Equal(AuthSchemeMd5, scheme)
+	scheme, ok = CheckAuthKey(AuthSchemeMd5, "abc", 1488720000, hmacKey)
+	assert.True(ok)
+	assert.Equal(AuthSchemeHmacSha256, scheme)
+
+	_, ok = CheckAuthKey(AuthSchemeHmacSha256, "abc", 1488720000, md5Key)
+	assert.False(ok)
+	_, ok = CheckAuthKey(AuthSchemeMd5, "abd", 1488720000, md5Key)
+	assert.False(ok)
+
+	assert.Equal([]string{AuthSchemeHmacSha256, AuthSchemeMd5}, allowedAuthSchemes(AuthSchemeMd5))
+	assert.Equal([]string{AuthSchemeHmacSha256}, allowedAuthSchemes(AuthSchemeHmacSha256))
+}
+
+func TestGetPrivilegeKey(t *testing.T) {
+	assert := assert.New(t)
+	loginKey := GetAuthKeyWithScheme(AuthSchemeHmacSha256, "123", 1488720000)
+	workConnKey := GetPrivilegeKey(AuthSchemeHmacSha256, "123", AuthPurposeNewWorkConn, "a", 1488720000)
+	assert.NotEqual(loginKey, workConnKey)
+	assert.NotEqual(workConnKey, GetPrivilegeKey(AuthSchemeHmacSha256, "123", AuthPurposeNatHoleVisitor, "a", 1488720000))
+	assert.NotEqual(workConnKey, GetPrivilegeKey(AuthSchemeHmacSha256, "123", AuthPurposeNewWorkConn, "b", 1488720000))
+	assert.Equal(workConnKey, GetPrivilegeKey(AuthSchemeHmacSha256, "123", AuthPurposeNewWorkConn, "a", 1488720000))
+
+	// md5 keys are the same as login keys for old versions
+	assert.Equal(GetAuthKey("123", 1488720000), GetPrivilegeKey(AuthSchemeMd5, "123", AuthPurposePing, "a", 1488720000))
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 fatedier, fatedier@gmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTimestampExpired = fmt.Errorf("timestamp is out of allowed clock skew")
+	ErrReplayed         = fmt.Errorf("signature has already been used")
+	ErrReplayCacheFull  = fmt.Errorf("too many signatures in allowed clock skew")
+)
+
+// ReplayFilter rejects signatures with a timestamp too far from now and
+// signatures that have been seen before.
+type ReplayFilter struct {
+	// maxSkew is the max difference in seconds between timestamp and now,
+	// 0 means timestamp is not checked.
+	maxSkew int64
+
+	// capacity is the max number of signatures remembered, 0 means
+	// signatures are not remembered. A signature is only dropped after its
+	// timestamp is out of maxSkew, new signatures are rejected if all
+	// remembered ones are still in maxSkew.
+	capacity int
+
+	// signature -> unix time after which the signature is expired
+	seen map[string]int64
+
+	mu sync.Mutex
+}
+
+func NewReplayFilter(maxSkew int64, capacity int) *ReplayFilter {
+	return &ReplayFilter{
+		maxSkew:  maxSkew,
+		capacity: capacity,
+		seen:     make(map[string]int64),
+	}
+}
+
+// CheckClockSkew returns ErrTimestampExpired if timestamp differs from now by
+// more than maxSkew seconds, 0 means timestamp is not checked.
+func CheckClockSkew(timestamp int64, maxSkew int64) error {
+	if maxSkew > 0 {
+		diff := time.Now().Unix() - timestamp
+		if diff > maxSkew || diff < -maxSkew {
+			return ErrTimestampExpired
+		}
+	}
+	return nil
+}
+
+// Check returns an error if timestamp is expired or signature has been used.
+// Otherwise the signature is remembered and can't pass again until its
+// timestamp is expired.
+func (rf *ReplayFilter) Check(signature string, timestamp int64) error {
+	if err := CheckClockSkew(timestamp, rf.maxSkew); err != nil {
+		return err
+	}
+
+	if rf.capacity <= 0 {
+		return nil
+	}
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if _, ok := rf.seen[signature]; ok {
+		return ErrReplayed
+	}
+	if len(rf.seen) >= rf.capacity {
+		rf.dropExpired(time.Now().Unix())
+		if len(rf.seen) >= rf.capacity {
+			return ErrReplayCacheFull
+		}
+	}
+	rf.seen[signature] = timestamp + rf.maxSkew
+	return nil
+}
+
+// Hold lock before calling this function.
+func (rf *ReplayFilter) dropExpired(now int64) {
+	// signatures are never expired if timestamp is not checked
+	if rf.maxSkew <= 0 {
+		return
+	}
+	for signature, expireAt := range rf.seen {
+		if now > expireAt {
+			delete(rf.seen, signature)
+		}
+	}
+}
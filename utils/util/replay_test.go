@@ -0,0 +1,53 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayFilter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().Unix()
+
+	rf := NewReplayFilter(60, 2)
+	assert.NoError(rf.Check("a", now))
+	assert.Equal(ErrReplayed, rf.Check("a", now))
+	assert.Equal(ErrTimestampExpired, rf.Check("b", now-61))
+	assert.Equal(ErrTimestampExpired, rf.Check("b", now+61))
+
+	// signatures in allowed clock skew are never dropped, new ones are
+	// rejected if the filter is full.
+	assert.NoError(rf.Check("b", now))
+	assert.Equal(ErrReplayCacheFull, rf.Check("c", now))
+	assert.Equal(ErrReplayed, rf.Check("a", now))
+	assert.Equal(ErrReplayed, rf.Check("b", now))
+
+	// expired signatures are dropped to make room for new ones, they can't
+	// pass again since their timestamp is out of allowed clock skew.
+	rf = NewReplayFilter(60, 2)
+	assert.NoError(rf.Check("a", now-60))
+	assert.NoError(rf.Check("b", now))
+	rf.mu.Lock()
+	rf.dropExpired(now + 1)
+	rf.mu.Unlock()
+	assert.NoError(rf.Check("c", now))
+	assert.Equal(ErrReplayed, rf.Check("b", now))
+	assert.Equal(ErrReplayed, rf.Check("c", now))
+
+	rf = NewReplayFilter(0, 0)
+	assert.NoError(rf.Check("a", 0))
+	assert.NoError(rf.Check("a", 0))
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().Unix()
+
+	assert.NoError(CheckClockSkew(now-5, 10))
+	assert.NoError(CheckClockSkew(now+5, 10))
+	assert.Equal(ErrTimestampExpired, CheckClockSkew(now-11, 10))
+	assert.Equal(ErrTimestampExpired, CheckClockSkew(now+11, 10))
+	assert.NoError(CheckClockSkew(0, 0))
+}